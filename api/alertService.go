@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	. "dsmpartsfinder-api/models"
+	"dsmpartsfinder-api/notify"
+)
+
+const (
+	// alertFlushInterval is how often pending alerts are sent when nothing woke the service,
+	// e.g. after quiet hours ended or a delivery failed
+	alertFlushInterval = time.Minute
+	// alertBatchSize is how many parts a single notification lists at most
+	alertBatchSize = 50
+	// maxAlertAttempts is how often an alert is tried before it is failed
+	maxAlertAttempts = 5
+	// alertTimeout bounds a single notification
+	alertTimeout = 30 * time.Second
+)
+
+// AlertService notifies the owners of saved filters about new parts matching them. Matches are
+// recorded as pending alerts when a part_created event arrives and sent in batches per filter,
+// so every part is notified at most once per filter and alerts held back by quiet hours are sent
+// once they end.
+type AlertService struct {
+	sqlClient *SQLClient
+	smtp      notify.SMTPConfig
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewAlertService creates a new alert service sending email through the given SMTP server.
+// Subscribe HandleEvent to the event bus and call Start.
+func NewAlertService(sqlClient *SQLClient, smtp notify.SMTPConfig) *AlertService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &AlertService{
+		sqlClient: sqlClient,
+		smtp:      smtp,
+		wake:      make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+}
+
+// Start begins sending pending alerts, including the ones left over from before a restart
+func (s *AlertService) Start() {
+	if !s.smtp.Configured() {
+		log.Println("[AlertService] SMTP is not configured, email alerts will fail until SMTP_HOST and SMTP_FROM are set")
+	}
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(alertFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			s.flush()
+
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-s.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Println("[AlertService] Alert service started")
+}
+
+// Stop stops sending alerts. Pending alerts are sent after the next start.
+func (s *AlertService) Stop() {
+	log.Println("[AlertService] Stopping alert service...")
+	s.cancel()
+	<-s.done
+	log.Println("[AlertService] Alert service stopped")
+}
+
+// HandleEvent records a pending alert for every enabled saved filter the created part matches
+func (s *AlertService) HandleEvent(event Event) error {
+	if event.Type != EventPartCreated || event.PartID == 0 {
+		return nil
+	}
+
+	savedFilters, err := s.sqlClient.GetSavedFilters(true)
+	if err != nil {
+		return err
+	}
+
+	created := 0
+	for _, savedFilter := range savedFilters {
+		matches, err := s.sqlClient.PartMatchesFilter(event.PartID, savedFilter.Filter)
+		if err != nil {
+			return err
+		}
+		if !matches {
+			continue
+		}
+
+		ok, err := s.sqlClient.CreateAlert(savedFilter.ID, event.PartID)
+		if err != nil {
+			return err
+		}
+		if ok {
+			created++
+		}
+	}
+
+	if created > 0 {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// flush sends the pending alerts of every filter outside its quiet hours
+func (s *AlertService) flush() {
+	pending, err := s.sqlClient.GetPendingAlerts()
+	if err != nil {
+		log.Printf("[AlertService] WARNING: Failed to load pending alerts: %v", err)
+		return
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for start := 0; start < len(pending); {
+		end := start
+		for end < len(pending) && pending[end].SavedFilterID == pending[start].SavedFilterID {
+			end++
+		}
+		alerts := pending[start:end]
+		start = end
+
+		savedFilter, err := s.sqlClient.GetSavedFilterByID(alerts[0].SavedFilterID)
+		if err != nil {
+			log.Printf("[AlertService] WARNING: Failed to load saved filter %d: %v", alerts[0].SavedFilterID, err)
+			continue
+		}
+		if !savedFilter.Enabled || savedFilter.InQuietHours(now) {
+			continue
+		}
+
+		for len(alerts) > 0 {
+			batch := alerts
+			if len(batch) > alertBatchSize {
+				batch = batch[:alertBatchSize]
+			}
+			alerts = alerts[len(batch):]
+
+			if s.ctx.Err() != nil {
+				return
+			}
+			s.send(savedFilter, batch)
+		}
+	}
+}
+
+// send delivers one notification listing the parts of the given alerts and records the outcome
+func (s *AlertService) send(savedFilter *SavedFilter, alerts []SavedFilterAlert) {
+	ids := make([]int, len(alerts))
+	parts := make([]Part, 0, len(alerts))
+	for i, alert := range alerts {
+		ids[i] = alert.ID
+		part, err := s.sqlClient.GetPartByID(alert.PartID)
+		if err != nil {
+			log.Printf("[AlertService] WARNING: Failed to load part %d for saved filter %d: %v", alert.PartID, savedFilter.ID, err)
+			continue
+		}
+		parts = append(parts, *part)
+	}
+	if len(parts) == 0 {
+		s.sqlClient.MarkAlertsFailed(ids, "parts could not be loaded", maxAlertAttempts)
+		return
+	}
+
+	err := s.notify(savedFilter, notify.Alert{
+		FilterID:   savedFilter.ID,
+		FilterName: savedFilter.Name,
+		Parts:      parts,
+	})
+	if err != nil {
+		log.Printf("[AlertService] Failed to send %d alerts for saved filter %d (%s): %v", len(ids), savedFilter.ID, savedFilter.Name, err)
+		s.sqlClient.MarkAlertsFailed(ids, err.Error(), maxAlertAttempts)
+		return
+	}
+
+	log.Printf("[AlertService] Sent %d alerts for saved filter %d (%s) via %s", len(ids), savedFilter.ID, savedFilter.Name, savedFilter.Notifier)
+	s.sqlClient.MarkAlertsSent(ids)
+}
+
+// notify sends an alert through the notifier of a saved filter
+func (s *AlertService) notify(savedFilter *SavedFilter, alert notify.Alert) error {
+	notifier, err := s.notifier(savedFilter)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, alertTimeout)
+	defer cancel()
+	return notifier.Notify(ctx, alert)
+}
+
+// notifier creates the notifier configured for a saved filter
+func (s *AlertService) notifier(savedFilter *SavedFilter) (notify.Notifier, error) {
+	switch savedFilter.Notifier {
+	case notify.TypeWebhook:
+		return notify.NewWebhook(savedFilter.Target), nil
+	case notify.TypeEmail:
+		return notify.NewEmail(s.smtp, savedFilter.Target), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", savedFilter.Notifier)
+	}
+}
+
+// SendTestAlert sends a test notification listing the newest parts matching a saved filter,
+// ignoring quiet hours. No alerts are recorded.
+func (s *AlertService) SendTestAlert(savedFilter *SavedFilter) error {
+	parts, err := s.sqlClient.GetFilteredParts(3, 0, savedFilter.Filter)
+	if err != nil {
+		return err
+	}
+
+	return s.notify(savedFilter, notify.Alert{
+		FilterID:   savedFilter.ID,
+		FilterName: savedFilter.Name,
+		Parts:      parts,
+		Test:       true,
+	})
+}
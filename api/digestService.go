@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	. "dsmpartsfinder-api/models"
+	"dsmpartsfinder-api/notify"
+)
+
+const (
+	// Digests are sent at 07:00, the weekly one on Mondays
+	dailyDigestSchedule  = "0 0 7 * * *"
+	weeklyDigestSchedule = "0 0 7 * * 1"
+	// notablePriceDropPercent is the smallest drop listed in a digest
+	notablePriceDropPercent = 10
+	// maxDigestPriceDrops is how many price drops a digest lists at most
+	maxDigestPriceDrops = 25
+	// digestTimeout bounds sending a single digest
+	digestTimeout = time.Minute
+)
+
+// DigestService builds the daily and weekly digests of new, cheaper and removed listings and
+// mails them to their subscribers
+type DigestService struct {
+	sqlClient *SQLClient
+	smtp      notify.SMTPConfig
+}
+
+// NewDigestService creates a new digest service sending mail through the given SMTP server
+func NewDigestService(sqlClient *SQLClient, smtp notify.SMTPConfig) *DigestService {
+	return &DigestService{
+		sqlClient: sqlClient,
+		smtp:      smtp,
+	}
+}
+
+// BuildDigest collects what happened to the listings between since and until
+func (s *DigestService) BuildDigest(frequency string, since, until time.Time) (*Digest, error) {
+	digest := &Digest{
+		Frequency:  frequency,
+		Since:      since,
+		Until:      until,
+		NewParts:   make([]DigestGroup, 0),
+		PriceDrops: make([]DigestPriceDrop, 0),
+	}
+
+	sites, err := s.sqlClient.GetAllSites()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sites: %w", err)
+	}
+	siteNames := make(map[int]string, len(sites))
+	for _, site := range sites {
+		siteNames[site.ID] = site.Name
+	}
+
+	// Parts come ordered by site and category
+	parts, err := s.sqlClient.GetPartsStoredBetween(since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load new parts: %w", err)
+	}
+	for _, part := range parts {
+		last := len(digest.NewParts) - 1
+		if last < 0 || digest.NewParts[last].SiteID != part.SiteID || digest.NewParts[last].TypeName != part.TypeName {
+			digest.NewParts = append(digest.NewParts, DigestGroup{
+				SiteID:   part.SiteID,
+				SiteName: siteNames[part.SiteID],
+				TypeName: part.TypeName,
+			})
+			last++
+		}
+		digest.NewParts[last].Parts = append(digest.NewParts[last].Parts, part)
+	}
+
+	drops, err := s.sqlClient.GetPriceDropsBetween(since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load price drops: %w", err)
+	}
+	for _, drop := range drops {
+		if drop.Percent >= notablePriceDropPercent {
+			digest.PriceDrops = append(digest.PriceDrops, drop)
+		}
+	}
+	sort.SliceStable(digest.PriceDrops, func(i, j int) bool {
+		return digest.PriceDrops[i].Percent > digest.PriceDrops[j].Percent
+	})
+	if len(digest.PriceDrops) > maxDigestPriceDrops {
+		digest.PriceDrops = digest.PriceDrops[:maxDigestPriceDrops]
+	}
+
+	digest.Removed, err = s.sqlClient.GetPartsRemovedBetween(since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load removed parts: %w", err)
+	}
+	return digest, nil
+}
+
+// Preview renders the digest of a frequency covering the period from since until now, without
+// sending it. A zero since covers one period of the frequency.
+func (s *DigestService) Preview(frequency string, since time.Time) (notify.Mail, error) {
+	until := time.Now()
+	if since.IsZero() {
+		since = until.Add(-DigestPeriod(frequency))
+	}
+
+	digest, err := s.BuildDigest(frequency, since, until)
+	if err != nil {
+		return notify.Mail{}, err
+	}
+	return notify.RenderDigest(digest)
+}
+
+// SendDue sends the digest of a frequency to its enabled subscriptions. Called by the scheduler.
+func (s *DigestService) SendDue(frequency string) {
+	subscriptions, err := s.sqlClient.GetDigestSubscriptions(frequency, true)
+	if err != nil {
+		log.Printf("[DigestService] ERROR: Failed to load %s digest subscriptions: %v", frequency, err)
+		return
+	}
+
+	sent := 0
+	for i := range subscriptions {
+		if err := s.Send(&subscriptions[i]); err != nil {
+			log.Printf("[DigestService] ERROR: Failed to send %s digest to %s: %v", frequency, subscriptions[i].Email, err)
+			continue
+		}
+		sent++
+	}
+	log.Printf("[DigestService] Sent %d of %d %s digest(s)", sent, len(subscriptions), frequency)
+}
+
+// Send mails a subscription the digest of the period since its last digest. The period of a
+// first digest is one day or one week.
+func (s *DigestService) Send(subscription *DigestSubscription) error {
+	until := time.Now()
+	since := until.Add(-DigestPeriod(subscription.Frequency))
+	if subscription.LastSentAt != nil {
+		since = *subscription.LastSentAt
+	}
+
+	digest, err := s.BuildDigest(subscription.Frequency, since, until)
+	if err != nil {
+		return err
+	}
+	mail, err := notify.RenderDigest(digest)
+	if err != nil {
+		return err
+	}
+	mail.To = []string{subscription.Email}
+
+	ctx, cancel := context.WithTimeout(context.Background(), digestTimeout)
+	defer cancel()
+	if err := notify.SendMail(ctx, s.smtp, mail); err != nil {
+		return err
+	}
+	return s.sqlClient.MarkDigestSent(subscription.ID, until)
+}
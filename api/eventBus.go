@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	. "dsmpartsfinder-api/models"
+)
+
+const (
+	// eventBatchSize is how many events a subscriber reads from the outbox at once
+	eventBatchSize = 100
+	// eventPollInterval is how often subscribers look for events when they were not woken up,
+	// e.g. for events written by another process
+	eventPollInterval = 5 * time.Second
+	// eventRetryBaseDelay is the delay before redelivering an event a handler failed on, doubled
+	// for every further failure
+	eventRetryBaseDelay = time.Second
+	eventRetryMaxDelay  = 5 * time.Minute
+	// eventRetention is how long handled events are kept in the outbox
+	eventRetention     = 30 * 24 * time.Hour
+	eventPruneInterval = time.Hour
+)
+
+// EventHandler handles an event delivered by the event bus. Returning an error redelivers the
+// event after a delay; the subscriber gets no later events until it succeeds.
+type EventHandler func(event Event) error
+
+// eventSubscriber is a named handler with its own position in the outbox
+type eventSubscriber struct {
+	name    string
+	types   map[string]bool // Nil for every type
+	handler EventHandler
+	wake    chan struct{}
+}
+
+// EventBus delivers the domain events in the event_outbox table to its subscribers, in order
+// and at least once. Every subscriber keeps its position in the event_cursors table, so events
+// written while it was down, or that it failed on, are delivered after a restart.
+type EventBus struct {
+	sqlClient   *SQLClient
+	subscribers []*eventSubscriber
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewEventBus creates a new event bus and wakes it whenever sqlClient stores events. Register
+// subscribers with Subscribe, then call Start.
+func NewEventBus(sqlClient *SQLClient) *EventBus {
+	ctx, cancel := context.WithCancel(context.Background())
+	bus := &EventBus{
+		sqlClient: sqlClient,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	sqlClient.SetEventHook(bus.notify)
+	return bus
+}
+
+// Subscribe registers a handler for the given event types, or for every type when none are
+// given. The name identifies the subscriber across restarts and must not change.
+func (b *EventBus) Subscribe(name string, handler EventHandler, types ...string) {
+	subscriber := &eventSubscriber{
+		name:    name,
+		handler: handler,
+		wake:    make(chan struct{}, 1),
+	}
+	if len(types) > 0 {
+		subscriber.types = make(map[string]bool, len(types))
+		for _, eventType := range types {
+			subscriber.types[eventType] = true
+		}
+	}
+	b.subscribers = append(b.subscribers, subscriber)
+}
+
+// Start begins delivering events. The cursors of new subscribers are created before it returns,
+// so they get every event published after the call.
+func (b *EventBus) Start() {
+	for _, subscriber := range b.subscribers {
+		cursor, err := b.sqlClient.GetEventCursor(subscriber.name)
+		if err != nil {
+			log.Printf("[EventBus] WARNING: Failed to load cursor of %s: %v", subscriber.name, err)
+			cursor = -1
+		}
+
+		b.wg.Add(1)
+		go func(subscriber *eventSubscriber, cursor int) {
+			defer b.wg.Done()
+			b.deliver(subscriber, cursor)
+		}(subscriber, cursor)
+	}
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.prune()
+	}()
+	log.Printf("[EventBus] Event bus started with %d subscribers", len(b.subscribers))
+}
+
+// Stop stops delivering events. An event whose handler is cut off is delivered again on the
+// next start.
+func (b *EventBus) Stop() {
+	log.Println("[EventBus] Stopping event bus...")
+	b.cancel()
+	b.wg.Wait()
+	log.Println("[EventBus] Event bus stopped")
+}
+
+// notify wakes up every subscriber
+func (b *EventBus) notify() {
+	for _, subscriber := range b.subscribers {
+		select {
+		case subscriber.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// sleep waits for the given duration, reporting false when the bus stopped in the meantime
+func (b *EventBus) sleep(delay time.Duration) bool {
+	select {
+	case <-b.ctx.Done():
+		return false
+	case <-time.After(delay):
+		return true
+	}
+}
+
+// deliver hands the events after its cursor to a subscriber until the bus stops. A cursor of -1
+// is loaded first.
+func (b *EventBus) deliver(subscriber *eventSubscriber, cursor int) {
+	for cursor < 0 {
+		if !b.sleep(eventPollInterval) {
+			return
+		}
+		loaded, err := b.sqlClient.GetEventCursor(subscriber.name)
+		if err != nil {
+			log.Printf("[EventBus] WARNING: Failed to load cursor of %s: %v", subscriber.name, err)
+			continue
+		}
+		cursor = loaded
+	}
+
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		events, err := b.sqlClient.GetEventsAfter(cursor, eventBatchSize)
+		if err != nil {
+			log.Printf("[EventBus] WARNING: Failed to load events for %s: %v", subscriber.name, err)
+			events = nil
+		}
+
+		handled := cursor
+		for _, event := range events {
+			if subscriber.types != nil && !subscriber.types[event.Type] {
+				handled = event.ID
+				continue
+			}
+
+			if err := subscriber.handler(event); err != nil {
+				failures++
+				log.Printf("[EventBus] %s failed on event %d (%s), attempt %d: %v", subscriber.name, event.ID, event.Type, failures, err)
+				break
+			}
+			failures = 0
+			handled = event.ID
+		}
+
+		if handled != cursor {
+			if err := b.sqlClient.AdvanceEventCursor(subscriber.name, handled); err == nil {
+				cursor = handled
+			}
+		}
+
+		if failures > 0 {
+			if !b.sleep(eventRetryDelay(failures)) {
+				return
+			}
+			continue
+		}
+		if len(events) == eventBatchSize {
+			continue
+		}
+
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-subscriber.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// prune deletes the events every subscriber handled once they are older than the retention
+func (b *EventBus) prune() {
+	ticker := time.NewTicker(eventPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		upToID := -1
+		for _, subscriber := range b.subscribers {
+			cursor, err := b.sqlClient.GetEventCursor(subscriber.name)
+			if err != nil {
+				upToID = -1
+				break
+			}
+			if upToID < 0 || cursor < upToID {
+				upToID = cursor
+			}
+		}
+
+		if upToID > 0 {
+			if pruned, err := b.sqlClient.PruneEvents(time.Now().Add(-eventRetention), upToID); err == nil && pruned > 0 {
+				log.Printf("[EventBus] Pruned %d events", pruned)
+			}
+		}
+
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// eventRetryDelay returns the delay before redelivering an event after the given number of
+// failures
+func eventRetryDelay(failures int) time.Duration {
+	delay := eventRetryBaseDelay
+	for i := 1; i < failures && delay < eventRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > eventRetryMaxDelay {
+		delay = eventRetryMaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"dsmpartsfinder-api/images"
+	"dsmpartsfinder-api/prices"
+
+	"github.com/pressly/goose/v3"
+)
+
+// goMigrations are migrations that need Go code, they run in version order with the SQL files.
+// Images are moved into imageStore.
+func goMigrations(imageStore *images.Store) []*goose.Migration {
+	return []*goose.Migration{
+		goose.NewGoMigration(20251022090100,
+			&goose.GoFunc{RunTx: backfillStructuredPrices},
+			&goose.GoFunc{RunTx: clearStructuredPrices},
+		),
+		goose.NewGoMigration(20251024090100,
+			&goose.GoFunc{RunTx: backfillContentHashes},
+			&goose.GoFunc{RunTx: clearContentHashes},
+		),
+		goose.NewGoMigration(20251104090100,
+			&goose.GoFunc{RunTx: func(ctx context.Context, tx *sql.Tx) error { return extractImages(ctx, tx, imageStore) }},
+			&goose.GoFunc{RunTx: func(ctx context.Context, tx *sql.Tx) error { return restoreImages(ctx, tx, imageStore) }},
+		),
+	}
+}
+
+// backfillStructuredPrices parses the free text price of parts stored before prices were structured
+func backfillStructuredPrices(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, COALESCE(price, '') FROM parts WHERE price_currency IS NULL")
+	if err != nil {
+		return fmt.Errorf("failed to query parts for price backfill: %w", err)
+	}
+
+	type storedPrice struct {
+		id    int
+		price string
+	}
+	var stored []storedPrice
+	for rows.Next() {
+		var p storedPrice
+		if err := rows.Scan(&p.id, &p.price); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan part price: %w", err)
+		}
+		stored = append(stored, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range stored {
+		parsed := prices.Parse(p.price, "")
+		_, err := tx.ExecContext(ctx, `
+			UPDATE parts
+			SET price_amount = ?, price_currency = ?, price_negotiable = ?, price_free = ?, shipping_cost = ?
+			WHERE id = ?
+		`, nullableInt64(parsed.Amount), parsed.Currency, parsed.Negotiable, parsed.Free, nullableInt64(parsed.ShippingCost), p.id)
+		if err != nil {
+			return fmt.Errorf("failed to backfill price for part %d: %w", p.id, err)
+		}
+	}
+
+	log.Printf("[Migrations] Parsed prices for %d existing parts", len(stored))
+	return nil
+}
+
+// clearStructuredPrices resets the backfilled columns so the backfill can run again
+func clearStructuredPrices(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE parts
+		SET price_amount = NULL, price_currency = NULL, price_negotiable = 0, price_free = 0, shipping_cost = NULL
+	`)
+	return err
+}
+
+// backfillContentHashes computes the content hash of parts stored before edits were detected
+func backfillContentHashes(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, name, description, type_name, image_base64, url, COALESCE(price, '')
+		FROM parts
+		WHERE content_hash = ''
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query parts for content hash backfill: %w", err)
+	}
+
+	hashes := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var content partContent
+		var imageBase64 string
+		if err := rows.Scan(&id, &content.Name, &content.Description, &content.TypeName, &imageBase64, &content.URL, &content.Price); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan part content: %w", err)
+		}
+		content.ImageHash, _ = images.HashBase64(imageBase64)
+		hashes[id] = content.hash()
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, hash := range hashes {
+		if _, err := tx.ExecContext(ctx, "UPDATE parts SET content_hash = ? WHERE id = ?", hash, id); err != nil {
+			return fmt.Errorf("failed to backfill content hash for part %d: %w", id, err)
+		}
+	}
+
+	log.Printf("[Migrations] Computed content hashes for %d existing parts", len(hashes))
+	return nil
+}
+
+// clearContentHashes resets the backfilled hashes so the backfill can run again
+func clearContentHashes(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "UPDATE parts SET content_hash = ''")
+	return err
+}
+
+// extractImages moves the base64 images of parts into the image store, replacing them with their
+// hash, and recomputes the content hashes, which now cover the image hash. Images that are not
+// valid base64 are dropped.
+func extractImages(ctx context.Context, tx *sql.Tx, imageStore *images.Store) error {
+	partIDs, err := queryIDs(tx, "SELECT id FROM parts WHERE COALESCE(image_base64, '') != ''")
+	if err != nil {
+		return fmt.Errorf("failed to query parts for image extraction: %w", err)
+	}
+
+	// One part at a time, so the images never have to be in memory together
+	extracted := 0
+	for _, id := range partIDs {
+		var content partContent
+		var imageBase64 string
+		err := tx.QueryRowContext(ctx, `
+			SELECT name, description, type_name, image_base64, url, COALESCE(price, '')
+			FROM parts
+			WHERE id = ?
+		`, id).Scan(&content.Name, &content.Description, &content.TypeName, &imageBase64, &content.URL, &content.Price)
+		if err != nil {
+			return fmt.Errorf("failed to read image of part %d: %w", id, err)
+		}
+
+		hash, err := imageStore.PutBase64(imageBase64)
+		if err != nil {
+			log.Printf("[Migrations] WARNING: Dropping image of part %d: %v", id, err)
+			hash = ""
+		}
+		content.ImageHash = hash
+
+		_, err = tx.ExecContext(ctx, "UPDATE parts SET image_hash = ?, image_base64 = NULL, content_hash = ? WHERE id = ?",
+			hash, content.hash(), id)
+		if err != nil {
+			return fmt.Errorf("failed to store image hash of part %d: %w", id, err)
+		}
+		if hash != "" {
+			extracted++
+		}
+	}
+
+	log.Printf("[Migrations] Moved %d images into the image store", extracted)
+	return nil
+}
+
+// restoreImages copies the images of parts back into image_base64, with the content hashes
+// computed over the base64 data as before the image store. The store keeps the images.
+func restoreImages(ctx context.Context, tx *sql.Tx, imageStore *images.Store) error {
+	partIDs, err := queryIDs(tx, "SELECT id FROM parts WHERE image_hash != ''")
+	if err != nil {
+		return fmt.Errorf("failed to query parts for image restore: %w", err)
+	}
+
+	for _, id := range partIDs {
+		var name, description, typeName, imageHash, url, price string
+		err := tx.QueryRowContext(ctx, `
+			SELECT name, description, type_name, image_hash, url, COALESCE(price, '')
+			FROM parts
+			WHERE id = ?
+		`, id).Scan(&name, &description, &typeName, &imageHash, &url, &price)
+		if err != nil {
+			return fmt.Errorf("failed to read image hash of part %d: %w", id, err)
+		}
+
+		imageBase64 := ""
+		if path, err := imageStore.Path(imageHash, false); err == nil {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read image of part %d: %w", id, err)
+			}
+			imageBase64 = base64.StdEncoding.EncodeToString(data)
+		}
+
+		sum := sha256.Sum256([]byte(strings.Join([]string{name, description, typeName, imageBase64, url, price}, "\x00")))
+		_, err = tx.ExecContext(ctx, "UPDATE parts SET image_base64 = ?, content_hash = ? WHERE id = ?",
+			imageBase64, hex.EncodeToString(sum[:]), id)
+		if err != nil {
+			return fmt.Errorf("failed to restore image of part %d: %w", id, err)
+		}
+	}
+
+	log.Printf("[Migrations] Restored the images of %d parts", len(partIDs))
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"dsmpartsfinder-api/images"
+	"dsmpartsfinder-api/siteclients"
+)
+
+// storedImageIndex tells the image fetcher which photos are stored already, by the source URLs
+// recorded in the galleries. An image is only reported when the store still holds it.
+type storedImageIndex struct {
+	sqlClient *SQLClient
+	store     *images.Store
+}
+
+// NewStoredImageIndex creates the image index of the image fetcher
+func NewStoredImageIndex(sqlClient *SQLClient, store *images.Store) siteclients.ImageIndex {
+	return &storedImageIndex{sqlClient: sqlClient, store: store}
+}
+
+// StoredImageHash returns the hash of the image stored for sourceURL
+func (i *storedImageIndex) StoredImageHash(sourceURL string) (string, bool) {
+	if sourceURL == "" {
+		return "", false
+	}
+	hash, err := i.sqlClient.GetImageHashBySourceURL(sourceURL)
+	if err != nil || hash == "" || !i.store.Has(hash) {
+		return "", false
+	}
+	return hash, true
+}
+
+// UnchangedListings returns the IDs of the parts stored with the same content and cover photo
+// and a gallery of more than one photo, whose gallery pages need not be loaded again
+func (i *storedImageIndex) UnchangedListings(siteID int, parts []siteclients.Part) map[string]bool {
+	unchanged := make(map[string]bool)
+	partIDs := make([]string, 0, len(parts))
+	for _, part := range parts {
+		partIDs = append(partIDs, part.ID)
+	}
+	storedParts, err := i.sqlClient.GetStoredParts(partIDs, siteID)
+	if err != nil {
+		return unchanged
+	}
+
+	for _, part := range parts {
+		stored, ok := storedParts[part.ID]
+		if !ok || len(stored.Images) < 2 || len(part.Images) == 0 {
+			continue
+		}
+		displayPrice, _ := normalizePrice(part)
+		if stored.Name == part.Name && stored.Description == part.Description &&
+			stored.TypeName == part.TypeName && stored.URL == part.URL && stored.Price == displayPrice &&
+			stored.Images[0].SourceURL == part.Images[0].SourceURL {
+			unchanged[part.ID] = true
+		}
+	}
+	return unchanged
+}
@@ -0,0 +1,202 @@
+// Package images stores listing images on disk by the SHA-256 of their content, with a
+// thumbnail next to every image that can be decoded
+package images
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Errors of the store
+var (
+	ErrNotFound = errors.New("image not found")
+	ErrNotImage = errors.New("data is not an image")
+)
+
+// contentTypes are the image formats the store accepts, as sniffed by http.DetectContentType.
+// SVG is left out as it may carry scripts.
+var contentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+}
+
+// ContentType returns the media type of image data, or ErrNotImage when it is not one of the
+// formats the store accepts
+func ContentType(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if !contentTypes[contentType] {
+		return "", fmt.Errorf("%w: detected %s", ErrNotImage, contentType)
+	}
+	return contentType, nil
+}
+
+// Store is a content addressed image store. Originals live in originals/ab/<hash> and
+// thumbnails in thumbnails/ab/<hash>.jpg, where ab are the first two characters of the hash.
+// Writes are atomic, so a store can be shared by concurrent writers and readers.
+type Store struct {
+	root string
+}
+
+// NewStore creates a store in dir, creating the directory when it does not exist
+func NewStore(dir string) (*Store, error) {
+	for _, sub := range []string{"originals", "thumbnails"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create image store: %w", err)
+		}
+	}
+	return &Store{root: dir}, nil
+}
+
+// Hash returns the hex SHA-256 an image is stored under
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashBase64 returns the hash of base64 encoded image data, or an empty hash for no data
+func HashBase64(imageBase64 string) (string, error) {
+	if imageBase64 == "" {
+		return "", nil
+	}
+	data, err := base64.StdEncoding.DecodeString(imageBase64)
+	if err != nil {
+		return "", fmt.Errorf("invalid base64 image: %w", err)
+	}
+	return Hash(data), nil
+}
+
+// ValidHash reports whether s looks like a hash returned by the store, lowercase hex only
+func ValidHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Put stores an image and its thumbnail and returns its hash. Storing an image that is already
+// stored only returns the hash. Data that is not a JPEG, PNG, GIF, WebP or BMP image is refused
+// with ErrNotImage; images Go cannot decode, or too large to decode, are stored without a
+// thumbnail.
+func (s *Store) Put(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", fmt.Errorf("image is empty")
+	}
+	if _, err := ContentType(data); err != nil {
+		return "", err
+	}
+
+	hash := Hash(data)
+	if _, err := os.Stat(s.originalPath(hash)); err == nil {
+		return hash, nil
+	}
+
+	if err := writeAtomic(s.originalPath(hash), data); err != nil {
+		return "", fmt.Errorf("failed to store image %s: %w", hash, err)
+	}
+	if thumbnail, err := Thumbnail(data, ThumbnailSize); err == nil {
+		if err := writeAtomic(s.thumbnailPath(hash), thumbnail); err != nil {
+			return "", fmt.Errorf("failed to store thumbnail of image %s: %w", hash, err)
+		}
+	}
+	return hash, nil
+}
+
+// PutBase64 stores base64 encoded image data, returning an empty hash for no data
+func (s *Store) PutBase64(imageBase64 string) (string, error) {
+	if imageBase64 == "" {
+		return "", nil
+	}
+	data, err := base64.StdEncoding.DecodeString(imageBase64)
+	if err != nil {
+		return "", fmt.Errorf("invalid base64 image: %w", err)
+	}
+	return s.Put(data)
+}
+
+// Path returns the file of an image, or of its thumbnail when there is one and thumbnail is set
+func (s *Store) Path(hash string, thumbnail bool) (string, error) {
+	if !ValidHash(hash) {
+		return "", ErrNotFound
+	}
+	if thumbnail {
+		if _, err := os.Stat(s.thumbnailPath(hash)); err == nil {
+			return s.thumbnailPath(hash), nil
+		}
+	}
+	if _, err := os.Stat(s.originalPath(hash)); err != nil {
+		return "", ErrNotFound
+	}
+	return s.originalPath(hash), nil
+}
+
+// ContentType returns the media type of a stored image, or of its thumbnail when thumbnail is
+// set, sniffed from its first bytes
+func (s *Store) ContentType(hash string, thumbnail bool) (string, error) {
+	path, err := s.Path(hash, thumbnail)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", ErrNotFound
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to read image %s: %w", hash, err)
+	}
+	return ContentType(head[:n])
+}
+
+// Has reports whether an image is stored
+func (s *Store) Has(hash string) bool {
+	_, err := s.Path(hash, false)
+	return err == nil
+}
+
+func (s *Store) originalPath(hash string) string {
+	return filepath.Join(s.root, "originals", hash[:2], hash)
+}
+
+func (s *Store) thumbnailPath(hash string) string {
+	return filepath.Join(s.root, "thumbnails", hash[:2], hash+".jpg")
+}
+
+// writeAtomic writes a file through a temporary file in the same directory, so readers never
+// see a partial image
+func writeAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,132 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"testing"
+)
+
+// testPNG encodes a width by height PNG
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 0x80, A: 0xff})
+		}
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestPutRefusesNonImages(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	for name, data := range map[string][]byte{
+		"html":   []byte("<!DOCTYPE html><html><script>alert(1)</script></html>"),
+		"svg":    []byte(`<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"></svg>`),
+		"text":   []byte("just some text"),
+		"binary": {0x00, 0x01, 0x02, 0x03},
+	} {
+		if _, err := store.Put(data); !errors.Is(err, ErrNotImage) {
+			t.Errorf("Put(%s) error = %v, want ErrNotImage", name, err)
+		}
+	}
+}
+
+func TestPutStoresImageAndThumbnail(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	hash, err := store.Put(testPNG(t, 640, 480))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if !store.Has(hash) {
+		t.Fatalf("stored image %s is missing", hash)
+	}
+
+	for thumbnail, want := range map[bool]string{false: "image/png", true: "image/jpeg"} {
+		contentType, err := store.ContentType(hash, thumbnail)
+		if err != nil {
+			t.Fatalf("ContentType(thumbnail %v): %v", thumbnail, err)
+		}
+		if contentType != want {
+			t.Errorf("ContentType(thumbnail %v) = %s, want %s", thumbnail, contentType, want)
+		}
+	}
+}
+
+func TestContentTypeOfStoredNonImage(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	// A file that was stored before Put checked the data is not served as an image
+	data := []byte("<html><script>alert(1)</script></html>")
+	hash := Hash(data)
+	if err := writeAtomic(store.originalPath(hash), data); err != nil {
+		t.Fatalf("writeAtomic: %v", err)
+	}
+	if _, err := store.ContentType(hash, false); !errors.Is(err, ErrNotImage) {
+		t.Errorf("ContentType error = %v, want ErrNotImage", err)
+	}
+	if _, err := store.ContentType("not-a-hash", false); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ContentType of an invalid hash error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	thumbnail, err := Thumbnail(testPNG(t, 640, 160), ThumbnailSize)
+	if err != nil {
+		t.Fatalf("Thumbnail: %v", err)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(thumbnail))
+	if err != nil {
+		t.Fatalf("DecodeConfig: %v", err)
+	}
+	if format != "jpeg" || config.Width != ThumbnailSize || config.Height != ThumbnailSize/4 {
+		t.Errorf("thumbnail is a %dx%d %s, want a %dx%d jpeg", config.Width, config.Height, format, ThumbnailSize, ThumbnailSize/4)
+	}
+}
+
+func TestThumbnailRefusesDecompressionBomb(t *testing.T) {
+	var b bytes.Buffer
+	if err := gif.Encode(&b, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black}), nil); err != nil {
+		t.Fatalf("gif.Encode: %v", err)
+	}
+	// Claim 65535x65535 pixels in the logical screen descriptor of the tiny file
+	data := b.Bytes()
+	copy(data[6:10], []byte{0xff, 0xff, 0xff, 0xff})
+
+	if _, err := Thumbnail(data, ThumbnailSize); err == nil {
+		t.Fatal("Thumbnail decoded an image of 65535x65535 pixels")
+	}
+
+	// The image is still stored, without a thumbnail
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	hash, err := store.Put(data)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := os.Stat(store.thumbnailPath(hash)); !os.IsNotExist(err) {
+		t.Errorf("thumbnail of the oversized image was stored (%v)", err)
+	}
+}
@@ -0,0 +1,99 @@
+package images
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	// Decoders for the formats listing images come in
+	_ "image/gif"
+	_ "image/png"
+)
+
+// ThumbnailSize is the longest side of a thumbnail in pixels
+const ThumbnailSize = 320
+
+// thumbnailQuality is the JPEG quality of thumbnails
+const thumbnailQuality = 80
+
+// MaxPixels is the largest image, in pixels, that is decoded for a thumbnail. A small file can
+// claim huge dimensions and would take gigabytes of memory to decode.
+const MaxPixels = 50_000_000
+
+// Thumbnail decodes a JPEG, PNG or GIF image and returns it as a JPEG scaled down to fit in a
+// size by size square. Smaller images keep their size. Images of more than MaxPixels are refused
+// before they are decoded.
+func Thumbnail(data []byte, size int) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, fmt.Errorf("image has no pixels")
+	}
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, fmt.Errorf("image is %dx%d pixels, at most %d pixels are decoded", config.Width, config.Height, MaxPixels)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("image has no pixels")
+	}
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/width)
+		} else {
+			width, height = max(1, width*size/height), size
+		}
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, resize(src, width, height), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// resize scales src to width by height by averaging the source pixels each target pixel
+// covers, which keeps downscaled photos free of aliasing. Transparent areas become white.
+func resize(src image.Image, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*srcHeight/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*srcHeight/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*srcWidth/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*srcWidth/width)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			// Colors are premultiplied, so adding the missing alpha composites onto white
+			white := n*0xffff - a
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((r + white) / n >> 8),
+				G: uint8((g + white) / n >> 8),
+				B: uint8((b + white) / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	. "dsmpartsfinder-api/models"
+	"dsmpartsfinder-api/siteclients"
+)
+
+const (
+	// maxConcurrentJobs limits how many sites are fetched at the same time
+	maxConcurrentJobs = 4
+	// jobTimeout bounds a single attempt of a job
+	jobTimeout = 5 * time.Minute
+	// defaultJobAttempts is how often a job is tried before it is failed
+	defaultJobAttempts = 3
+	// jobRetryBaseDelay is the delay before the first retry, doubled for every further attempt
+	jobRetryBaseDelay = time.Minute
+	jobRetryMaxDelay  = time.Hour
+	// jobPollInterval is how often the queue looks for jobs whose retry delay passed
+	jobPollInterval = 5 * time.Second
+)
+
+// jobOutcome is handed to the callers waiting for a job
+type jobOutcome struct {
+	job   *FetchJob
+	parts []Part
+}
+
+// JobQueue runs the fetch jobs stored in the fetch_jobs table. Jobs of the same site run one at
+// a time, duplicate queued jobs are coalesced and failed jobs are retried with backoff. Queued
+// jobs survive a restart.
+type JobQueue struct {
+	sqlClient    *SQLClient
+	partsService *PartsService
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu        sync.Mutex
+	running   map[int]int                // Site ID by running job ID
+	cancels   map[int]context.CancelFunc // Cancels the context of a running job by job ID
+	cancelled map[int]bool               // Running jobs that were cancelled by job ID, also before they registered their context
+	waiters   map[int][]chan jobOutcome  // Callers waiting for a job by job ID
+}
+
+// NewJobQueue creates a new job queue, call Start to begin running jobs
+func NewJobQueue(sqlClient *SQLClient, partsService *PartsService) *JobQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &JobQueue{
+		sqlClient:    sqlClient,
+		partsService: partsService,
+		wake:         make(chan struct{}, 1),
+		ctx:          ctx,
+		cancel:       cancel,
+		done:         make(chan struct{}),
+		running:      make(map[int]int),
+		cancels:      make(map[int]context.CancelFunc),
+		cancelled:    make(map[int]bool),
+		waiters:      make(map[int][]chan jobOutcome),
+	}
+}
+
+// Start requeues the jobs a previous shutdown interrupted and begins running jobs
+func (q *JobQueue) Start() {
+	requeued, err := q.sqlClient.RequeueInterruptedFetchJobs()
+	if err != nil {
+		log.Printf("[JobQueue] WARNING: Failed to requeue interrupted jobs: %v", err)
+	} else if requeued > 0 {
+		log.Printf("[JobQueue] Requeued %d jobs interrupted by the last shutdown", requeued)
+	}
+
+	go q.dispatch()
+	log.Println("[JobQueue] Job queue started")
+}
+
+// Stop cancels the running jobs and stops taking new ones. Jobs cut off this way stay running
+// in the database and are requeued on the next start.
+func (q *JobQueue) Stop() {
+	log.Println("[JobQueue] Stopping job queue...")
+	q.cancel()
+	<-q.done
+	log.Println("[JobQueue] Job queue stopped")
+}
+
+// Enqueue queues a fetch of a site, or returns the queued job with the same params
+func (q *JobQueue) Enqueue(siteID int, params siteclients.SearchParams, trigger string) (*FetchJob, error) {
+	job, coalesced, err := q.sqlClient.EnqueueFetchJob(siteID, params.ProfileID, trigger, params, defaultJobAttempts)
+	if err != nil {
+		return nil, err
+	}
+
+	if coalesced {
+		log.Printf("[JobQueue] Coalesced %s fetch of site %d into queued job %d", trigger, siteID, job.ID)
+	} else {
+		log.Printf("[JobQueue] Queued job %d: %s fetch of site %d", job.ID, trigger, siteID)
+	}
+	q.notify()
+	return job, nil
+}
+
+// Wait blocks until a job succeeded or failed for good and returns it with the parts it stored.
+// The parts are only known when the job finished while waiting.
+func (q *JobQueue) Wait(ctx context.Context, jobID int) (*FetchJob, []Part, error) {
+	outcome := make(chan jobOutcome, 1)
+	q.mu.Lock()
+	q.waiters[jobID] = append(q.waiters[jobID], outcome)
+	q.mu.Unlock()
+	defer q.removeWaiter(jobID, outcome)
+
+	// The job may have finished before the waiter was registered
+	job, err := q.sqlClient.GetFetchJobByID(jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.Finished() {
+		return job, nil, nil
+	}
+
+	select {
+	case result := <-outcome:
+		return result.job, result.parts, nil
+	case <-ctx.Done():
+		return job, nil, ctx.Err()
+	}
+}
+
+// removeWaiter unregisters a caller waiting for a job
+func (q *JobQueue) removeWaiter(jobID int, outcome chan jobOutcome) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	waiters := q.waiters[jobID]
+	for i, waiter := range waiters {
+		if waiter == outcome {
+			q.waiters[jobID] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(q.waiters[jobID]) == 0 {
+		delete(q.waiters, jobID)
+	}
+}
+
+// Cancel cancels a queued job, or the context of a running one. Finished jobs are left alone.
+func (q *JobQueue) Cancel(jobID int) error {
+	if q.cancelRunning(jobID) {
+		return nil
+	}
+
+	cancelled, err := q.sqlClient.CancelQueuedFetchJob(jobID)
+	if err != nil {
+		return err
+	}
+	if cancelled {
+		log.Printf("[JobQueue] Job %d cancelled before it started", jobID)
+		if job, err := q.sqlClient.GetFetchJobByID(jobID); err == nil {
+			q.deliver(job, nil)
+		}
+		return nil
+	}
+
+	// The job may have started in the meantime, possibly without having registered its context
+	// yet. The cancel is then kept for run to pick up.
+	if q.cancelRunning(jobID) {
+		return nil
+	}
+	job, err := q.sqlClient.GetFetchJobByID(jobID)
+	if err != nil {
+		return err
+	}
+	if job.Status == FetchJobRunning {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if cancel, running := q.cancels[jobID]; running {
+			cancel()
+		}
+		q.cancelled[jobID] = true
+		log.Printf("[JobQueue] Cancelling running job %d", jobID)
+	}
+	return nil
+}
+
+// cancelRunning cancels the context of a running job, reporting whether the job was running
+func (q *JobQueue) cancelRunning(jobID int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cancel, running := q.cancels[jobID]
+	if !running {
+		return false
+	}
+	q.cancelled[jobID] = true
+	cancel()
+	log.Printf("[JobQueue] Cancelling running job %d", jobID)
+	return true
+}
+
+// EnqueueBatch queues a fetch of every given site with the same params and records them as
+// one batch
+func (q *JobQueue) EnqueueBatch(siteIDs []int, params siteclients.SearchParams, trigger string) (*FetchBatch, error) {
+	jobIDs := make([]int, 0, len(siteIDs))
+	for _, siteID := range siteIDs {
+		job, err := q.Enqueue(siteID, params, trigger)
+		if err != nil {
+			return nil, err
+		}
+		jobIDs = append(jobIDs, job.ID)
+	}
+
+	batchID, err := q.sqlClient.CreateFetchBatch(params, jobIDs)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[JobQueue] Queued batch %d with %d jobs", batchID, len(jobIDs))
+	return q.sqlClient.GetFetchBatchByID(batchID)
+}
+
+// GetBatch returns a batch with the progress of its jobs
+func (q *JobQueue) GetBatch(batchID int) (*FetchBatch, error) {
+	return q.sqlClient.GetFetchBatchByID(batchID)
+}
+
+// CancelBatch cancels the jobs of a batch that did not finish yet
+func (q *JobQueue) CancelBatch(batchID int) (*FetchBatch, error) {
+	if err := q.sqlClient.MarkFetchBatchCancelled(batchID); err != nil {
+		return nil, err
+	}
+
+	batch, err := q.sqlClient.GetFetchBatchByID(batchID)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range batch.Jobs {
+		if job.Finished() {
+			continue
+		}
+		if err := q.Cancel(job.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("[JobQueue] Cancelled batch %d", batchID)
+	return q.sqlClient.GetFetchBatchByID(batchID)
+}
+
+// SiteRunning reports whether a job of the site is running
+func (q *JobQueue) SiteRunning(siteID int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, runningSiteID := range q.running {
+		if runningSiteID == siteID {
+			return true
+		}
+	}
+	return false
+}
+
+// notify wakes up the dispatcher
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch starts every job that can run, then waits for a new job, a finished job or the
+// next poll
+func (q *JobQueue) dispatch() {
+	var wg sync.WaitGroup
+	defer close(q.done)
+	defer wg.Wait()
+
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for q.runningCount() < maxConcurrentJobs {
+			job, err := q.sqlClient.ClaimNextFetchJob()
+			if err != nil || job == nil {
+				break
+			}
+
+			q.mu.Lock()
+			q.running[job.ID] = job.SiteID
+			q.mu.Unlock()
+
+			wg.Add(1)
+			go func(job *FetchJob) {
+				defer wg.Done()
+				q.run(job)
+
+				q.mu.Lock()
+				delete(q.running, job.ID)
+				q.mu.Unlock()
+				q.notify()
+			}(job)
+		}
+
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runningCount returns the number of running jobs
+func (q *JobQueue) runningCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.running)
+}
+
+// run runs one attempt of a job and stores its outcome
+func (q *JobQueue) run(job *FetchJob) {
+	log.Printf("[JobQueue] Running job %d: %s fetch of site %d (attempt %d/%d)", job.ID, job.Trigger, job.SiteID, job.Attempts, job.MaxAttempts)
+
+	var params siteclients.SearchParams
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		q.mu.Lock()
+		delete(q.cancelled, job.ID)
+		q.mu.Unlock()
+		q.finish(job, nil, fmt.Errorf("invalid job params: %w", err), false)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(q.ctx, jobTimeout)
+	defer cancel()
+	ctx = siteclients.WithProgress(ctx, func(event siteclients.ProgressEvent) {
+		if event.Type == siteclients.ProgressPageFetched {
+			q.sqlClient.UpdateFetchJobProgress(job.ID, event.PagesDone, event.PartsFound)
+		}
+	})
+
+	// A cancel that arrived between claiming the job and here is applied right away
+	q.mu.Lock()
+	q.cancels[job.ID] = cancel
+	if q.cancelled[job.ID] {
+		cancel()
+	}
+	q.mu.Unlock()
+
+	parts, err := q.partsService.FetchAndStoreParts(ctx, job.SiteID, params, job.Trigger)
+
+	q.mu.Lock()
+	cancelled := q.cancelled[job.ID]
+	delete(q.cancels, job.ID)
+	delete(q.cancelled, job.ID)
+	q.mu.Unlock()
+
+	// A fetch that completed before the cancel arrived still counts
+	if cancelled && err != nil {
+		job.Status = FetchJobCancelled
+		if err := q.sqlClient.FinishFetchJob(job.ID, job.Status, "cancelled", len(parts)); err != nil {
+			log.Printf("[JobQueue] WARNING: Failed to store outcome of job %d: %v", job.ID, err)
+		}
+		log.Printf("[JobQueue] Job %d cancelled", job.ID)
+		q.deliver(job, parts)
+		return
+	}
+	if err != nil && q.ctx.Err() != nil {
+		// Shutting down, the job is requeued on the next start
+		log.Printf("[JobQueue] Job %d interrupted by shutdown", job.ID)
+		return
+	}
+	q.finish(job, parts, err, true)
+}
+
+// finish stores the outcome of an attempt, queueing a retry when attempts are left
+func (q *JobQueue) finish(job *FetchJob, parts []Part, jobErr error, retryable bool) {
+	if jobErr == nil {
+		job.Status = FetchJobSucceeded
+		job.LastError = ""
+		if err := q.sqlClient.FinishFetchJob(job.ID, job.Status, "", len(parts)); err != nil {
+			log.Printf("[JobQueue] WARNING: Failed to store outcome of job %d: %v", job.ID, err)
+		}
+		log.Printf("[JobQueue] Job %d succeeded: %d new parts", job.ID, len(parts))
+		q.deliver(job, parts)
+		return
+	}
+
+	job.LastError = jobErr.Error()
+	if retryable && job.Attempts < job.MaxAttempts {
+		delay := retryDelay(job.Attempts)
+		if err := q.sqlClient.RetryFetchJob(job.ID, job.LastError, time.Now().Add(delay)); err != nil {
+			log.Printf("[JobQueue] WARNING: Failed to queue retry of job %d: %v", job.ID, err)
+		}
+		log.Printf("[JobQueue] Job %d failed, retrying in %v: %v", job.ID, delay, jobErr)
+		return
+	}
+
+	job.Status = FetchJobFailed
+	if err := q.sqlClient.FinishFetchJob(job.ID, job.Status, job.LastError, 0); err != nil {
+		log.Printf("[JobQueue] WARNING: Failed to store outcome of job %d: %v", job.ID, err)
+	}
+	log.Printf("[JobQueue] Job %d failed after %d attempts: %v", job.ID, job.Attempts, jobErr)
+	q.deliver(job, nil)
+}
+
+// deliver hands the outcome of a finished job to the callers waiting for it
+func (q *JobQueue) deliver(job *FetchJob, parts []Part) {
+	if stored, err := q.sqlClient.GetFetchJobByID(job.ID); err == nil {
+		job = stored
+	} else if err != sql.ErrNoRows {
+		log.Printf("[JobQueue] WARNING: Failed to reload job %d: %v", job.ID, err)
+	}
+
+	q.mu.Lock()
+	waiters := q.waiters[job.ID]
+	delete(q.waiters, job.ID)
+	q.mu.Unlock()
+
+	for _, waiter := range waiters {
+		waiter <- jobOutcome{job: job, parts: parts}
+	}
+}
+
+// retryDelay returns the backoff before the next attempt after the given number of attempts
+func retryDelay(attempts int) time.Duration {
+	delay := jobRetryBaseDelay
+	for i := 1; i < attempts && delay < jobRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > jobRetryMaxDelay {
+		delay = jobRetryMaxDelay
+	}
+	return delay
+}
@@ -12,8 +12,11 @@ import (
 	"strings"
 	"time"
 
+	"dsmpartsfinder-api/images"
+	. "dsmpartsfinder-api/models"
+	"dsmpartsfinder-api/notify"
 	"dsmpartsfinder-api/routes"
-	"dsmpartsfinder-api/scrapers"
+	_ "dsmpartsfinder-api/scrapers" // registers the scraper based site clients
 	"dsmpartsfinder-api/siteclients"
 
 	"github.com/gin-contrib/cors"
@@ -86,11 +89,21 @@ func main() {
 	}
 	defer sqlClient.Close()
 
+	// Open the image store, the migrations move images stored in the parts table into it
+	imageStorePath := os.Getenv("IMAGE_STORE_PATH")
+	if imageStorePath == "" {
+		imageStorePath = "./images"
+	}
+	imageStore, err := images.NewStore(imageStorePath)
+	if err != nil {
+		log.Fatalf("Failed to open image store: %v", err)
+	}
+
 	subFS, err := fs.Sub(migrationsFS, "migrations")
 	if err != nil {
 		log.Fatalf("Failed to create sub FS: %v", err)
 	}
-	provider, err := goose.NewProvider(goose.DialectSQLite3, sqlClient.db, subFS)
+	provider, err := goose.NewProvider(goose.DialectSQLite3, sqlClient.db, subFS, goose.WithGoMigrations(goMigrations(imageStore)...))
 	if err != nil {
 		log.Fatalf("Failed to create migration provider: %v", err)
 	}
@@ -99,8 +112,49 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
-	// Initialize PartsService
-	partsService := NewPartsService(sqlClient)
+	// Runs still marked as running were cut off by the last shutdown
+	if interrupted, err := sqlClient.FailInterruptedFetchRuns(); err != nil {
+		log.Printf("Failed to mark interrupted fetch runs: %v", err)
+	} else if interrupted > 0 {
+		log.Printf("Marked %d interrupted fetch runs as failed", interrupted)
+	}
+
+	// Load a custom vehicle taxonomy if configured
+	if taxonomyPath := os.Getenv("VEHICLE_TAXONOMY_FILE"); taxonomyPath != "" {
+		if err := siteclients.LoadTaxonomy(taxonomyPath); err != nil {
+			log.Fatalf("Failed to load vehicle taxonomy: %v", err)
+		}
+		log.Printf("Loaded vehicle taxonomy from %s", taxonomyPath)
+	}
+
+	// Start the event bus delivering domain events from the outbox. New parts wake up the
+	// clients of /api/parts/stream and are matched against the saved filters, and webhook
+	// subscriptions get the events they asked for.
+	eventBus := NewEventBus(sqlClient)
+	partFeed := NewPartFeed()
+	eventBus.Subscribe("part-stream", func(Event) error {
+		partFeed.Notify()
+		return nil
+	}, EventPartCreated)
+	alertService := NewAlertService(sqlClient, notify.SMTPConfigFromEnv())
+	eventBus.Subscribe("alerts", alertService.HandleEvent, EventPartCreated)
+	alertService.Start()
+	defer alertService.Stop()
+	webhookService := NewWebhookService(sqlClient)
+	eventBus.Subscribe("webhooks", webhookService.HandleEvent, EventPartCreated, EventPriceChanged, EventPartRemoved, EventFetchRunFinished)
+	webhookService.Start()
+	defer webhookService.Stop()
+	eventBus.Start()
+	defer eventBus.Stop()
+
+	// Initialize PartsService, publishing fetch progress for /api/events/fetch
+	progressHub := NewProgressHub()
+	partsService := NewPartsService(sqlClient, progressHub, imageStore)
+
+	// Every site client downloads photos through one fetcher and sends its requests through one
+	// transport, so their limits hold across sites
+	transport := siteclients.NewTransport(siteclients.HTTPConfigFromEnv(), nil)
+	imageFetcher := siteclients.NewImageFetcher(siteclients.ImageFetcherConfigFromEnv(), NewStoredImageIndex(sqlClient, imageStore), transport)
 
 	sites, err := sqlClient.GetAllSites()
 	if err != nil {
@@ -109,25 +163,32 @@ func main() {
 
 	// Register site clients dynamically based on DB entries
 	for _, site := range sites {
-		switch site.Name {
-		case "SchadeAutos":
-			client := siteclients.NewSchadeAutosClient(site.ID)
-			partsService.RegisterSiteClient(site.ID, client)
-		case "Kleinanzeigen":
-			client := scrapers.NewKleinanzeigenClient(site.ID)
-			partsService.RegisterSiteClient(site.ID, client)
-		case "Ebay":
-			clientID := os.Getenv("EBAY_CLIENT_ID")
-			clientSecret := os.Getenv("EBAY_CLIENT_SECRET")
-			client := siteclients.NewEbayClient(site.ID, clientID, clientSecret, false)
-			partsService.RegisterSiteClient(site.ID, client)
-		default:
-			log.Printf("No client implementation for site '%s' (site ID: %d), skipping registration", site.Name, site.ID)
+		if site.ClientType == "" {
+			log.Printf("No client type configured for site '%s' (site ID: %d), skipping registration", site.Name, site.ID)
+			continue
 		}
+
+		client, err := siteclients.NewClient(site.ClientType, siteclients.ClientOptions{
+			SiteID:    site.ID,
+			Config:    site.Config,
+			Images:    imageFetcher,
+			Transport: transport,
+		})
+		if err != nil {
+			log.Printf("Failed to create client for site '%s' (site ID: %d): %v, skipping registration", site.Name, site.ID, err)
+			continue
+		}
+		partsService.RegisterSiteClient(site.ID, client)
 	}
 
-	// Initialize and start scheduler for automatic fetching
-	scheduler := NewScheduler(partsService)
+	// Start the job queue that runs every fetch
+	jobQueue := NewJobQueue(sqlClient, partsService)
+	jobQueue.Start()
+	defer jobQueue.Stop()
+
+	// Initialize and start scheduler for automatic fetching and the email digests
+	digestService := NewDigestService(sqlClient, notify.SMTPConfigFromEnv())
+	scheduler := NewScheduler(partsService, sqlClient, jobQueue, digestService)
 	go func() {
 		if err := scheduler.Start(); err != nil {
 			log.Printf("Scheduler error: %v", err)
@@ -154,8 +215,14 @@ func main() {
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// Token guarding the admin endpoints such as /api/fetch-jobs
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" {
+		log.Println("Warning: ADMIN_TOKEN is not set, admin endpoints are disabled")
+	}
+
 	// Register API endpoints from routes.go
-	routes.RegisterAPIRoutes(r, sqlClient, partsService)
+	routes.RegisterAPIRoutes(r, sqlClient, partsService, scheduler, jobQueue, progressHub, partFeed, alertService, digestService, webhookService, imageStore, adminToken)
 
 	// Serve embedded frontend files
 	frontendSubFS, err := fs.Sub(frontendFS, "frontend/dist")
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE sites ADD COLUMN client_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE sites ADD COLUMN config TEXT NOT NULL DEFAULT '{}';
+
+-- +goose StatementBegin
+UPDATE sites SET client_type = 'schadeautos' WHERE site_name = 'SchadeAutos';
+UPDATE sites SET client_type = 'kleinanzeigen', config = '{"keywords": "Mitsubishi Eclipse D30", "category_id": "223", "location": "Deutschland"}' WHERE site_name = 'Kleinanzeigen';
+UPDATE sites SET client_type = 'ebay', config = '{"query": "(Mitsubishi Eclipse 2g, D32A)", "category_ids": "6030"}' WHERE site_name = 'Ebay';
+-- +goose StatementEnd
+
+-- +goose Down
+ALTER TABLE sites DROP COLUMN config;
+ALTER TABLE sites DROP COLUMN client_type;
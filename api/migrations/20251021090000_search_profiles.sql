@@ -0,0 +1,39 @@
+-- +goose Up
+CREATE TABLE search_profiles (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    vehicle_type TEXT NOT NULL DEFAULT 'P',
+    make TEXT NOT NULL DEFAULT '',
+    base_model TEXT NOT NULL DEFAULT '',
+    model TEXT NOT NULL DEFAULT '',
+    year_from INTEGER NOT NULL DEFAULT 0,
+    year_to INTEGER NOT NULL DEFAULT 0,
+    keywords TEXT NOT NULL DEFAULT '',
+    min_price INTEGER NOT NULL DEFAULT 0,
+    max_price INTEGER NOT NULL DEFAULT 0,
+    site_ids TEXT NOT NULL DEFAULT '[]',
+    enabled INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE part_search_profiles (
+    part_id INTEGER NOT NULL,
+    profile_id INTEGER NOT NULL,
+    matched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (part_id, profile_id),
+    FOREIGN KEY (part_id) REFERENCES parts(id) ON DELETE CASCADE,
+    FOREIGN KEY (profile_id) REFERENCES search_profiles(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_part_search_profiles_profile_id ON part_search_profiles(profile_id);
+
+-- +goose StatementBegin
+INSERT INTO search_profiles (name, vehicle_type, make, base_model, model, year_from, year_to)
+VALUES ('Eclipse D30', 'P', 'Mitsubishi', 'Eclipse', 'D30', 1989, 2000);
+-- +goose StatementEnd
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_part_search_profiles_profile_id;
+DROP TABLE part_search_profiles;
+DROP TABLE search_profiles;
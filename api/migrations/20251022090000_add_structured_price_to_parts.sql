@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE parts ADD COLUMN price_amount INTEGER;
+ALTER TABLE parts ADD COLUMN price_currency TEXT;
+ALTER TABLE parts ADD COLUMN price_negotiable INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE parts ADD COLUMN price_free INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE parts ADD COLUMN shipping_cost INTEGER;
+
+CREATE INDEX idx_parts_price_amount ON parts(price_amount);
+
+-- Existing prices are parsed by the Go migration that follows this one
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_parts_price_amount;
+ALTER TABLE parts DROP COLUMN shipping_cost;
+ALTER TABLE parts DROP COLUMN price_free;
+ALTER TABLE parts DROP COLUMN price_negotiable;
+ALTER TABLE parts DROP COLUMN price_currency;
+ALTER TABLE parts DROP COLUMN price_amount;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE part_price_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    part_id INTEGER NOT NULL,
+    price TEXT NOT NULL DEFAULT '',
+    price_amount INTEGER,
+    price_currency TEXT NOT NULL DEFAULT '',
+    observed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (part_id) REFERENCES parts(id)
+);
+
+CREATE INDEX idx_part_price_history_part_id ON part_price_history(part_id, observed_at);
+
+-- +goose StatementBegin
+-- The current price of every known part is its first observation
+INSERT INTO part_price_history (part_id, price, price_amount, price_currency, observed_at)
+SELECT id, COALESCE(price, ''), price_amount, COALESCE(price_currency, ''), COALESCE(created_at, CURRENT_TIMESTAMP)
+FROM parts;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_part_price_history_part_id;
+DROP TABLE IF EXISTS part_price_history;
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE parts ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE part_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    part_id INTEGER NOT NULL,
+    field TEXT NOT NULL,
+    old_value TEXT NOT NULL DEFAULT '',
+    new_value TEXT NOT NULL DEFAULT '',
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (part_id) REFERENCES parts(id)
+);
+
+CREATE INDEX idx_part_changes_part_id ON part_changes(part_id, changed_at);
+
+-- Content hashes of existing parts are computed by the Go migration that follows this one
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_part_changes_part_id;
+DROP TABLE IF EXISTS part_changes;
+ALTER TABLE parts DROP COLUMN content_hash;
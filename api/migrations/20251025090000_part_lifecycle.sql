@@ -0,0 +1,20 @@
+-- +goose Up
+ALTER TABLE parts ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE parts ADD COLUMN missing_since TIMESTAMP;
+ALTER TABLE parts ADD COLUMN removed_at TIMESTAMP;
+ALTER TABLE parts ADD COLUMN relisted_at TIMESTAMP;
+ALTER TABLE parts ADD COLUMN relist_of INTEGER;
+
+CREATE INDEX idx_parts_site_status ON parts(site_id, status);
+
+-- Hours a part may go unseen before it is considered removed
+ALTER TABLE sites ADD COLUMN grace_period_hours INTEGER NOT NULL DEFAULT 72;
+
+-- +goose Down
+ALTER TABLE sites DROP COLUMN grace_period_hours;
+DROP INDEX IF EXISTS idx_parts_site_status;
+ALTER TABLE parts DROP COLUMN relist_of;
+ALTER TABLE parts DROP COLUMN relisted_at;
+ALTER TABLE parts DROP COLUMN removed_at;
+ALTER TABLE parts DROP COLUMN missing_since;
+ALTER TABLE parts DROP COLUMN status;
@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE fetch_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    site_id INTEGER NOT NULL,
+    profile_id INTEGER,
+    triggered_by TEXT NOT NULL,
+    params TEXT NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'running',
+    complete INTEGER NOT NULL DEFAULT 0,
+    incomplete_reason TEXT NOT NULL DEFAULT '',
+    fetched_count INTEGER NOT NULL DEFAULT 0,
+    new_count INTEGER NOT NULL DEFAULT 0,
+    updated_count INTEGER NOT NULL DEFAULT 0,
+    stale_count INTEGER NOT NULL DEFAULT 0,
+    error_count INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP,
+    FOREIGN KEY (site_id) REFERENCES sites(id)
+);
+
+CREATE INDEX idx_fetch_runs_site_started ON fetch_runs(site_id, started_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_fetch_runs_site_started;
+DROP TABLE IF EXISTS fetch_runs;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Cron expression with seconds the scheduler fetches the site on
+ALTER TABLE sites ADD COLUMN schedule TEXT NOT NULL DEFAULT '0 0 * * * *';
+-- Up to this many seconds are added to every scheduled run so fetches do not hit a site on the dot
+ALTER TABLE sites ADD COLUMN schedule_jitter_seconds INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE sites ADD COLUMN schedule_paused INTEGER NOT NULL DEFAULT 0;
+
+-- eBay counts every call against the daily API quota, Kleinanzeigen rate limits bursts
+UPDATE sites SET schedule = '0 0 */6 * * *', schedule_jitter_seconds = 600 WHERE client_type = 'ebay';
+UPDATE sites SET schedule = '0 15 */2 * * *', schedule_jitter_seconds = 900 WHERE client_type = 'kleinanzeigen';
+UPDATE sites SET schedule_jitter_seconds = 300 WHERE client_type = 'schadeautos';
+
+-- +goose Down
+ALTER TABLE sites DROP COLUMN schedule_paused;
+ALTER TABLE sites DROP COLUMN schedule_jitter_seconds;
+ALTER TABLE sites DROP COLUMN schedule;
@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE fetch_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    site_id INTEGER NOT NULL,
+    profile_id INTEGER,
+    triggered_by TEXT NOT NULL,
+    params TEXT NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'queued',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 3,
+    last_error TEXT NOT NULL DEFAULT '',
+    run_after TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Not started before this time, pushed back on retries
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    FOREIGN KEY (site_id) REFERENCES sites(id)
+);
+
+CREATE INDEX idx_fetch_jobs_status_run_after ON fetch_jobs(status, run_after);
+CREATE INDEX idx_fetch_jobs_site_status ON fetch_jobs(site_id, status);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_fetch_jobs_site_status;
+DROP INDEX IF EXISTS idx_fetch_jobs_status_run_after;
+DROP TABLE IF EXISTS fetch_jobs;
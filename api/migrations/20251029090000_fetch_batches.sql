@@ -0,0 +1,29 @@
+-- +goose Up
+-- Progress of the current attempt, reported by the site client after every page
+ALTER TABLE fetch_jobs ADD COLUMN pages_done INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE fetch_jobs ADD COLUMN parts_found INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE fetch_jobs ADD COLUMN new_count INTEGER NOT NULL DEFAULT 0;
+
+-- A fetch requested through POST /api/fetch-jobs, made of one job per site
+CREATE TABLE fetch_batches (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    params TEXT NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    cancelled_at TIMESTAMP
+);
+
+-- A job can belong to several batches when identical queued fetches were coalesced
+CREATE TABLE fetch_batch_jobs (
+    batch_id INTEGER NOT NULL,
+    job_id INTEGER NOT NULL,
+    PRIMARY KEY (batch_id, job_id),
+    FOREIGN KEY (batch_id) REFERENCES fetch_batches(id),
+    FOREIGN KEY (job_id) REFERENCES fetch_jobs(id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS fetch_batch_jobs;
+DROP TABLE IF EXISTS fetch_batches;
+ALTER TABLE fetch_jobs DROP COLUMN new_count;
+ALTER TABLE fetch_jobs DROP COLUMN parts_found;
+ALTER TABLE fetch_jobs DROP COLUMN pages_done;
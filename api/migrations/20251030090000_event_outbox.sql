@@ -0,0 +1,27 @@
+-- +goose Up
+-- Domain events, written in the same transaction as the change they describe where possible.
+-- The event bus delivers them to its subscribers in ID order.
+CREATE TABLE event_outbox (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type TEXT NOT NULL,
+    site_id INTEGER,
+    part_id INTEGER,
+    payload TEXT NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_event_outbox_type ON event_outbox(type);
+CREATE INDEX idx_event_outbox_created_at ON event_outbox(created_at);
+
+-- The last event every subscriber of the event bus handled
+CREATE TABLE event_cursors (
+    subscriber TEXT PRIMARY KEY,
+    last_event_id INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS event_cursors;
+DROP INDEX IF EXISTS idx_event_outbox_created_at;
+DROP INDEX IF EXISTS idx_event_outbox_type;
+DROP TABLE IF EXISTS event_outbox;
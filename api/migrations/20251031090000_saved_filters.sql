@@ -0,0 +1,36 @@
+-- +goose Up
+-- A named /api/parts filter whose new matches are alerted
+CREATE TABLE saved_filters (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    filter TEXT NOT NULL DEFAULT '{}',
+    notifier TEXT NOT NULL,
+    target TEXT NOT NULL,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    quiet_hours_start TEXT NOT NULL DEFAULT '',
+    quiet_hours_end TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One alert per filter and part, so a part is never alerted twice
+CREATE TABLE alerts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    saved_filter_id INTEGER NOT NULL,
+    part_id INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP,
+    UNIQUE (saved_filter_id, part_id),
+    FOREIGN KEY (saved_filter_id) REFERENCES saved_filters(id),
+    FOREIGN KEY (part_id) REFERENCES parts(id)
+);
+
+CREATE INDEX idx_alerts_status ON alerts(status);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_alerts_status;
+DROP TABLE IF EXISTS alerts;
+DROP TABLE IF EXISTS saved_filters;
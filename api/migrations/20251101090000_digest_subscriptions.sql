@@ -0,0 +1,20 @@
+-- +goose Up
+-- Email addresses that receive the daily or weekly digest of new, cheaper and removed listings
+CREATE TABLE digest_subscriptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email TEXT NOT NULL,
+    frequency TEXT NOT NULL DEFAULT 'daily',
+    enabled INTEGER NOT NULL DEFAULT 1,
+    last_sent_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Speed up finding the parts stored and removed in a digest period
+CREATE INDEX idx_parts_created_at ON parts(created_at);
+CREATE INDEX idx_parts_removed_at ON parts(removed_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_parts_removed_at;
+DROP INDEX IF EXISTS idx_parts_created_at;
+DROP TABLE IF EXISTS digest_subscriptions;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- SHA-256 of the token external scrapers push listings to /api/ingest/:siteId with, empty when
+-- ingest is disabled for the site
+ALTER TABLE sites ADD COLUMN ingest_token_hash TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE sites DROP COLUMN ingest_token_hash;
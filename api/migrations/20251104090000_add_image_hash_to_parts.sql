@@ -0,0 +1,7 @@
+-- +goose Up
+-- SHA-256 of the image of a part in the image store, empty without image. The images are moved
+-- out of image_base64 by the Go migration 20251104090100.
+ALTER TABLE parts ADD COLUMN image_hash TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE parts DROP COLUMN image_hash;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- The images live in the image store now
+ALTER TABLE parts DROP COLUMN image_base64;
+
+-- +goose Down
+ALTER TABLE parts ADD COLUMN image_base64 TEXT;
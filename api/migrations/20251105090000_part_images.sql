@@ -0,0 +1,19 @@
+-- +goose Up
+-- Every photo of a listing in the order the site shows them. parts.image_hash keeps the hash of
+-- the first one as the cover.
+CREATE TABLE part_images (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    part_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    image_hash TEXT NOT NULL,
+    source_url TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (part_id) REFERENCES parts(id),
+    UNIQUE (part_id, position)
+);
+
+INSERT INTO part_images (part_id, position, image_hash)
+SELECT id, 0, image_hash FROM parts WHERE image_hash != '';
+
+-- +goose Down
+DROP TABLE IF EXISTS part_images;
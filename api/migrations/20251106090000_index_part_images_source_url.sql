@@ -0,0 +1,6 @@
+-- +goose Up
+-- The image fetcher looks up photos by the URL they were downloaded from to skip stored ones
+CREATE INDEX idx_part_images_source_url ON part_images(source_url);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_part_images_source_url;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- JSON array of the proxies that failed during the run with their failure count and last error
+ALTER TABLE fetch_runs ADD COLUMN proxy_failures TEXT NOT NULL DEFAULT '[]';
+
+-- +goose Down
+ALTER TABLE fetch_runs DROP COLUMN proxy_failures;
@@ -0,0 +1,79 @@
+package models
+
+import "time"
+
+// Digest frequencies
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// DigestFrequencies lists every digest frequency
+var DigestFrequencies = []string{DigestDaily, DigestWeekly}
+
+// DigestPeriod returns the time a digest of the given frequency covers when no digest was sent
+// before
+func DigestPeriod(frequency string) time.Duration {
+	if frequency == DigestWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// DigestSubscription is an email address that receives the daily or weekly digest
+type DigestSubscription struct {
+	ID         int        `json:"id"`
+	Email      string     `json:"email"`
+	Frequency  string     `json:"frequency"` // "daily" or "weekly"
+	Enabled    bool       `json:"enabled"`
+	LastSentAt *time.Time `json:"last_sent_at"` // End of the period of the last digest sent
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// DigestSubscriptionRequest represents the request body for creating or updating a digest subscription
+type DigestSubscriptionRequest struct {
+	Email     string `json:"email" binding:"required"`
+	Frequency string `json:"frequency" binding:"required"`
+	Enabled   *bool  `json:"enabled"`
+}
+
+// Digest summarizes what happened to the listings in a period
+type Digest struct {
+	Frequency  string
+	Since      time.Time
+	Until      time.Time
+	NewParts   []DigestGroup     // New parts by site and category
+	PriceDrops []DigestPriceDrop // Largest drops first
+	Removed    []Part            // Listings that disappeared, probably sold
+}
+
+// DigestGroup lists the new parts of one site and category
+type DigestGroup struct {
+	SiteID   int
+	SiteName string
+	TypeName string
+	Parts    []Part
+}
+
+// DigestPriceDrop is a part whose price went down in the period
+type DigestPriceDrop struct {
+	Part      Part
+	OldPrice  string
+	OldAmount int64 // In minor units (cents)
+	Percent   int   // Drop in percent of the old price
+}
+
+// NewPartsCount returns the number of new parts in all groups
+func (d *Digest) NewPartsCount() int {
+	count := 0
+	for _, group := range d.NewParts {
+		count += len(group.Parts)
+	}
+	return count
+}
+
+// IsEmpty reports whether nothing happened in the period
+func (d *Digest) IsEmpty() bool {
+	return len(d.NewParts) == 0 && len(d.PriceDrops) == 0 && len(d.Removed) == 0
+}
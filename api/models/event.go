@@ -0,0 +1,115 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Domain event types
+const (
+	EventPartCreated      = "part_created"
+	EventPartUpdated      = "part_updated"
+	EventPriceChanged     = "price_changed"
+	EventPartRemoved      = "part_removed"
+	EventFetchRunFinished = "fetch_run_finished"
+	EventSiteFailing      = "site_failing"
+)
+
+// EventTypes lists every domain event type
+var EventTypes = []string{
+	EventPartCreated, EventPartUpdated, EventPriceChanged, EventPartRemoved, EventFetchRunFinished, EventSiteFailing,
+}
+
+// Event is a domain event as stored in the event outbox. Payload holds one of the typed events
+// below, matching Type.
+type Event struct {
+	ID        int             `json:"id"`
+	Type      string          `json:"type"`
+	SiteID    int             `json:"site_id,omitempty"`
+	PartID    int             `json:"part_id,omitempty"` // DB ID of the part
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Decode unmarshals the payload into its typed event
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// DomainEvent is implemented by the typed events
+type DomainEvent interface {
+	EventType() string
+	// Subject returns the site and the DB ID of the part the event is about, 0 when none
+	Subject() (siteID, partID int)
+}
+
+// PartCreatedEvent is published when a new listing was stored
+type PartCreatedEvent struct {
+	Part Part `json:"part"`
+}
+
+func (e PartCreatedEvent) EventType() string   { return EventPartCreated }
+func (e PartCreatedEvent) Subject() (int, int) { return e.Part.SiteID, e.Part.ID }
+
+// PartUpdatedEvent is published when the seller edited a listing
+type PartUpdatedEvent struct {
+	Part    Part         `json:"part"`
+	Changes []PartChange `json:"changes"`
+}
+
+func (e PartUpdatedEvent) EventType() string   { return EventPartUpdated }
+func (e PartUpdatedEvent) Subject() (int, int) { return e.Part.SiteID, e.Part.ID }
+
+// PriceChangedEvent is published when the price of a listing changed
+type PriceChangedEvent struct {
+	Part      Part   `json:"part"` // With the new price
+	OldPrice  string `json:"old_price"`
+	OldAmount *int64 `json:"old_amount"` // In cents
+	NewPrice  string `json:"new_price"`
+	NewAmount *int64 `json:"new_amount"` // In cents
+}
+
+func (e PriceChangedEvent) EventType() string   { return EventPriceChanged }
+func (e PriceChangedEvent) Subject() (int, int) { return e.Part.SiteID, e.Part.ID }
+
+// Dropped reports whether both amounts are known and the new one is lower
+func (e PriceChangedEvent) Dropped() bool {
+	return e.OldAmount != nil && e.NewAmount != nil && *e.NewAmount < *e.OldAmount
+}
+
+// PartRemovedEvent is published when a listing was not seen within the grace period of its
+// site, most likely because it sold
+type PartRemovedEvent struct {
+	Part Part `json:"part"`
+}
+
+func (e PartRemovedEvent) EventType() string   { return EventPartRemoved }
+func (e PartRemovedEvent) Subject() (int, int) { return e.Part.SiteID, e.Part.ID }
+
+// FetchRunFinishedEvent is published when a fetch run succeeded or failed
+type FetchRunFinishedEvent struct {
+	Run FetchRun `json:"run"`
+}
+
+func (e FetchRunFinishedEvent) EventType() string   { return EventFetchRunFinished }
+func (e FetchRunFinishedEvent) Subject() (int, int) { return e.Run.SiteID, 0 }
+
+// SiteFailingEvent is published when a fetch of a site failed and the site was not reported failing
+// since its last successful fetch
+type SiteFailingEvent struct {
+	SiteID                int        `json:"site_id"`
+	SiteName              string     `json:"site_name"`
+	RunID                 int        `json:"run_id"`
+	Error                 string     `json:"error"`
+	LastSuccessfulFetchAt *time.Time `json:"last_successful_fetch_at"`
+}
+
+func (e SiteFailingEvent) EventType() string   { return EventSiteFailing }
+func (e SiteFailingEvent) Subject() (int, int) { return e.SiteID, 0 }
+
+// EventFilter holds the filters accepted by GET /api/events
+type EventFilter struct {
+	Type   string `json:"type,omitempty"`
+	SiteID int    `json:"site_id,omitempty"`
+	PartID int    `json:"part_id,omitempty"`
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Fetch job statuses
+const (
+	FetchJobQueued    = "queued"
+	FetchJobRunning   = "running"
+	FetchJobSucceeded = "succeeded"
+	FetchJobFailed    = "failed" // Failed on its last attempt
+	FetchJobCancelled = "cancelled"
+)
+
+// FetchJob is a queued fetch of one site with one set of search params. Jobs of the same site
+// run one at a time and failed jobs are retried with backoff.
+type FetchJob struct {
+	ID          int             `json:"id"`
+	SiteID      int             `json:"site_id"`
+	ProfileID   *int            `json:"profile_id"`
+	Trigger     string          `json:"trigger"`
+	Params      json.RawMessage `json:"params"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   string          `json:"last_error"`
+	PagesDone   int             `json:"pages_done"`  // Result pages fetched by the current or last attempt
+	PartsFound  int             `json:"parts_found"` // Parts found by the current or last attempt
+	NewCount    int             `json:"new_count"`   // New parts stored by the successful attempt
+	RunAfter    *time.Time      `json:"run_after"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+}
+
+// Finished reports whether the job will not run again
+func (j *FetchJob) Finished() bool {
+	return j.Status == FetchJobSucceeded || j.Status == FetchJobFailed || j.Status == FetchJobCancelled
+}
+
+// FetchBatch is a fetch requested through POST /api/fetch-jobs, made of one job per site
+type FetchBatch struct {
+	ID          int             `json:"id"`
+	Status      string          `json:"status"` // Derived from the jobs, see FetchBatchStatus
+	Params      json.RawMessage `json:"params"`
+	PagesDone   int             `json:"pages_done"`
+	PartsFound  int             `json:"parts_found"`
+	NewCount    int             `json:"new_count"`
+	Jobs        []FetchJob      `json:"jobs"` // Status per site
+	CreatedAt   time.Time       `json:"created_at"`
+	CancelledAt *time.Time      `json:"cancelled_at"`
+}
+
+// FetchBatchStatus derives the status of a batch from its jobs: queued until a job started,
+// running until every job finished, then cancelled, failed when any job failed, or succeeded
+func FetchBatchStatus(jobs []FetchJob, cancelled bool) string {
+	started, active, failed := false, false, false
+	for _, job := range jobs {
+		switch job.Status {
+		case FetchJobQueued:
+			active = true
+			started = started || job.Attempts > 0
+		case FetchJobRunning:
+			active, started = true, true
+		case FetchJobFailed:
+			failed = true
+		}
+	}
+
+	switch {
+	case active && started:
+		return FetchJobRunning
+	case active:
+		return FetchJobQueued
+	case cancelled:
+		return FetchJobCancelled
+	case failed:
+		return FetchJobFailed
+	}
+	return FetchJobSucceeded
+}
+
+// FetchJobRequest represents the request body for POST /api/fetch-jobs
+type FetchJobRequest struct {
+	SiteIDs     []int  `json:"site_ids"` // Empty means every registered site
+	VehicleType string `json:"vehicle_type"`
+	Make        string `json:"make"`
+	BaseModel   string `json:"base_model"`
+	Model       string `json:"model"`
+	YearFrom    int    `json:"year_from"`
+	YearTo      int    `json:"year_to"`
+	Keywords    string `json:"keywords"`
+	MinPrice    int    `json:"min_price"`
+	MaxPrice    int    `json:"max_price"`
+	Limit       int    `json:"limit"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// What started a fetch run
+const (
+	FetchTriggerStartup = "startup" // The fetch the scheduler runs when the API starts
+	FetchTriggerCron    = "cron"    // A scheduled fetch
+	FetchTriggerManual  = "manual"  // Requested through the API
+	FetchTriggerIngest  = "ingest"  // A batch pushed to /api/ingest by an external scraper
+)
+
+// Fetch run statuses
+const (
+	FetchRunRunning   = "running"
+	FetchRunSucceeded = "succeeded"
+	FetchRunFailed    = "failed"
+)
+
+// FetchRun is the persisted outcome of fetching one site with one set of search params
+type FetchRun struct {
+	ID               int             `json:"id"`
+	SiteID           int             `json:"site_id"`
+	ProfileID        *int            `json:"profile_id"`
+	Trigger          string          `json:"trigger"`
+	Params           json.RawMessage `json:"params"`
+	Status           string          `json:"status"`
+	Complete         bool            `json:"complete"`          // Whether the site returned every matching listing
+	IncompleteReason string          `json:"incomplete_reason"` // Why the result was incomplete
+	FetchedCount     int             `json:"fetched_count"`
+	NewCount         int             `json:"new_count"`
+	UpdatedCount     int             `json:"updated_count"`
+	StaleCount       int             `json:"stale_count"` // Parts marked missing or removed
+	ErrorCount       int             `json:"error_count"` // Parts that failed to store
+	Error            string          `json:"error"`
+	ProxyFailures    []ProxyFailure  `json:"proxy_failures"` // Requests that failed per proxy of the site
+	StartedAt        time.Time       `json:"started_at"`
+	FinishedAt       *time.Time      `json:"finished_at"`
+}
+
+// ProxyFailure counts the requests of a fetch run that failed through one proxy
+type ProxyFailure struct {
+	Proxy     string `json:"proxy"` // The proxy URL without its password
+	Failures  int    `json:"failures"`
+	LastError string `json:"last_error"`
+}
+
+// FetchRunFilter holds the filters accepted by GET /api/fetch-runs
+type FetchRunFilter struct {
+	SiteID    int    `json:"site_id,omitempty"`
+	ProfileID int    `json:"profile_id,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Trigger   string `json:"trigger,omitempty"`
+}
@@ -0,0 +1,24 @@
+package models
+
+// Outcomes of an ingested item
+const (
+	IngestInserted  = "inserted"  // A new part was stored
+	IngestUpdated   = "updated"   // A known part changed and was updated
+	IngestDuplicate = "duplicate" // A known part without changes, only its last_seen was updated
+	IngestRejected  = "rejected"  // Not stored, see the reason
+)
+
+// IngestResult is the outcome of one item of an ingest batch
+type IngestResult struct {
+	Index  int    `json:"index"`                // Position of the item in the batch
+	ID     string `json:"id"`                   // The listing ID of the item
+	Status string `json:"status"`               // One of the Ingest outcomes
+	PartID int    `json:"part_db_id,omitempty"` // DB ID of the stored part
+	Reason string `json:"reason,omitempty"`     // Why the item was rejected
+}
+
+// IngestTokenResponse is returned once when an ingest token is created
+type IngestTokenResponse struct {
+	SiteID int    `json:"site_id"`
+	Token  string `json:"token"`
+}
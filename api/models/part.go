@@ -2,21 +2,92 @@ package models
 
 import "time"
 
+// Part lifecycle statuses. There is no sold status: sites do not say why a listing went away,
+// so removed stands in for sold.
+const (
+	PartStatusActive  = "active"  // Seen by the latest fetch
+	PartStatusMissing = "missing" // Not found by the latest fetch, still within the site's grace period
+	PartStatusRemoved = "removed" // Not seen for longer than the grace period, most likely sold
+)
+
+// PartStatuses lists the valid part statuses
+var PartStatuses = []string{PartStatusActive, PartStatusMissing, PartStatusRemoved}
+
 // Part represents a car part scraped from a site
 type Part struct {
-	ID           int        `json:"id"`
-	PartID       string     `json:"part_id"`
-	Description  string     `json:"description"`
-	TypeName     string     `json:"type_name"`
-	Name         string     `json:"name"`
-	ImageBase64  string     `json:"image_base64"`
-	URL          string     `json:"url"`
-	SiteID       int        `json:"site_id"`
-	Price        string     `json:"price"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
-	LastSeen     time.Time  `json:"last_seen"`
-	CreationDate *time.Time `json:"creation_date"`
+	ID           int         `json:"id"`
+	PartID       string      `json:"part_id"`
+	Description  string      `json:"description"`
+	TypeName     string      `json:"type_name"`
+	Name         string      `json:"name"`
+	ImageHash    string      `json:"image_hash"`       // SHA-256 of the cover image in the image store, empty without image
+	ImageURL     string      `json:"image_url"`        // Where the cover image is served, empty without image
+	ThumbnailURL string      `json:"thumbnail_url"`    // Where a small version of the cover image is served
+	Images       []PartImage `json:"images,omitempty"` // Every photo, cover first; only loaded for a single part
+	URL          string      `json:"url"`
+	SiteID       int         `json:"site_id"`
+	Price        string      `json:"price"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	LastSeen     time.Time   `json:"last_seen"`
+	CreationDate *time.Time  `json:"creation_date"`
+	ProfileIDs   []int       `json:"profile_ids,omitempty"`
+	ContentHash  string      `json:"-"` // SHA-256 of the seller editable fields
+
+	// Lifecycle, see the PartStatus constants
+	Status       string     `json:"status"`
+	MissingSince *time.Time `json:"missing_since"`
+	RemovedAt    *time.Time `json:"removed_at"`
+	RelistedAt   *time.Time `json:"relisted_at"`
+	RelistOf     *int       `json:"relist_of"` // The removed part this listing is a relist of
+
+	// Structured price, parsed from the free text Price
+	PriceAmount     *int64 `json:"price_amount"`   // In minor units (cents)
+	PriceCurrency   string `json:"price_currency"` // ISO 4217 code
+	PriceNegotiable bool   `json:"price_negotiable"`
+	PriceFree       bool   `json:"price_free"`
+	ShippingCost    *int64 `json:"shipping_cost"` // In minor units, null when unknown
+}
+
+// PartImage is one photo in the gallery of a part
+type PartImage struct {
+	Position     int    `json:"position"`
+	Hash         string `json:"hash"` // SHA-256 of the image in the image store
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	SourceURL    string `json:"source_url,omitempty"` // Where the site served the image
+}
+
+// NewPartImage creates a gallery photo with the URLs it is served at
+func NewPartImage(position int, hash, sourceURL string) PartImage {
+	return PartImage{
+		Position:     position,
+		Hash:         hash,
+		URL:          ImageURL(hash),
+		ThumbnailURL: ThumbnailURL(hash),
+		SourceURL:    sourceURL,
+	}
+}
+
+// ImageURL returns where the image with the given hash is served
+func ImageURL(hash string) string {
+	return "/api/images/" + hash
+}
+
+// ThumbnailURL returns where the thumbnail of the image with the given hash is served
+func ThumbnailURL(hash string) string {
+	return ImageURL(hash) + "?size=thumb"
+}
+
+// SetImage sets the cover image hash of a part and the URLs it is served at
+func (p *Part) SetImage(hash string) {
+	p.ImageHash = hash
+	p.ImageURL = ""
+	p.ThumbnailURL = ""
+	if hash != "" {
+		p.ImageURL = ImageURL(hash)
+		p.ThumbnailURL = ThumbnailURL(hash)
+	}
 }
 
 // FetchPartsRequest represents the request body for fetching parts from a site
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// PartChange is a field of a listing that the seller edited, detected on refetch
+type PartChange struct {
+	ID        int       `json:"id"`
+	PartID    int       `json:"part_id"`
+	Field     string    `json:"field"`
+	OldValue  string    `json:"old_value"`
+	NewValue  string    `json:"new_value"`
+	ChangedAt time.Time `json:"changed_at"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// PartFilter holds the filters and sorting accepted by GET /api/parts
+type PartFilter struct {
+	TypeName          string     `json:"type,omitempty"`
+	SiteIDs           []int      `json:"site_ids,omitempty"`
+	NewerThanHours    int        `json:"newer_than_hours,omitempty"`
+	Search            string     `json:"search,omitempty"`
+	MinPrice          *float64   `json:"min_price,omitempty"`           // In major units, e.g. euros
+	MaxPrice          *float64   `json:"max_price,omitempty"`           // In major units, e.g. euros
+	Currency          string     `json:"currency,omitempty"`            // ISO currency of MinPrice and MaxPrice, EUR when empty
+	PriceDroppedSince *time.Time `json:"price_dropped_since,omitempty"` // Parts whose price went down at or after this time
+	Status            string     `json:"status,omitempty"`              // Comma separated statuses or "all", removed parts are left out when empty
+	SortBy            string     `json:"sort,omitempty"`
+	SortDesc          bool       `json:"sort_desc,omitempty"`
+}
+
+// HasFilters reports whether any filter or sort order is set
+func (f PartFilter) HasFilters() bool {
+	return f.TypeName != "" || len(f.SiteIDs) > 0 || f.NewerThanHours > 0 || f.Search != "" ||
+		f.MinPrice != nil || f.MaxPrice != nil || f.PriceDroppedSince != nil || f.Status != "" || f.SortBy != ""
+}
+
+// PriceCurrency returns the currency the price range is in. Parts priced in another currency
+// never match a price range, amounts are not converted.
+func (f PartFilter) PriceCurrency() string {
+	if f.Currency == "" {
+		return "EUR"
+	}
+	return strings.ToUpper(f.Currency)
+}
+
+// NewerThan returns the creation date cutoff, or the zero time when unset
+func (f PartFilter) NewerThan() time.Time {
+	if f.NewerThanHours <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-time.Duration(f.NewerThanHours) * time.Hour)
+}
+
+// Statuses returns the requested statuses, nil when all statuses are requested
+func (f PartFilter) Statuses() []string {
+	if f.Status == "" {
+		return []string{PartStatusActive, PartStatusMissing}
+	}
+	if f.Status == "all" {
+		return nil
+	}
+
+	statuses := make([]string, 0)
+	for _, status := range strings.Split(f.Status, ",") {
+		if status = strings.TrimSpace(status); status != "" {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
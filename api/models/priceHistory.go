@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// PricePoint is a price observed for a part, recorded whenever it differs from the previous one
+type PricePoint struct {
+	ID            int       `json:"id"`
+	PartID        int       `json:"part_id"`
+	Price         string    `json:"price"`
+	PriceAmount   *int64    `json:"price_amount"` // In minor units (cents)
+	PriceCurrency string    `json:"price_currency"`
+	ObservedAt    time.Time `json:"observed_at"`
+}
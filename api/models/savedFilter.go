@@ -0,0 +1,82 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Alert statuses
+const (
+	AlertPending = "pending" // Waiting to be sent, e.g. during quiet hours or after a failed attempt
+	AlertSent    = "sent"
+	AlertFailed  = "failed" // Gave up after too many attempts
+)
+
+// SavedFilter is a named /api/parts filter whose new matches are sent to a notifier
+type SavedFilter struct {
+	ID              int        `json:"id"`
+	Name            string     `json:"name"`
+	Filter          PartFilter `json:"filter"`   // Same fields as the query parameters of GET /api/parts
+	Notifier        string     `json:"notifier"` // "webhook" or "email"
+	Target          string     `json:"target"`   // Webhook URL or email address
+	Enabled         bool       `json:"enabled"`
+	QuietHoursStart string     `json:"quiet_hours_start"` // HH:MM in server time, no quiet hours when empty
+	QuietHoursEnd   string     `json:"quiet_hours_end"`   // HH:MM in server time, may be before the start to span midnight
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// SavedFilterRequest represents the request body for creating or updating a saved filter
+type SavedFilterRequest struct {
+	Name            string     `json:"name" binding:"required"`
+	Filter          PartFilter `json:"filter"`
+	Notifier        string     `json:"notifier" binding:"required"`
+	Target          string     `json:"target" binding:"required"`
+	Enabled         *bool      `json:"enabled"`
+	QuietHoursStart string     `json:"quiet_hours_start"`
+	QuietHoursEnd   string     `json:"quiet_hours_end"`
+}
+
+// ParseClock parses an HH:MM time of day into minutes after midnight
+func ParseClock(value string) (int, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hours, &minutes); err != nil || hours < 0 || hours > 23 || minutes < 0 || minutes > 59 {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+// InQuietHours reports whether alerts of the filter are held back at the given time
+func (f *SavedFilter) InQuietHours(t time.Time) bool {
+	if f.QuietHoursStart == "" || f.QuietHoursEnd == "" {
+		return false
+	}
+	start, err := ParseClock(f.QuietHoursStart)
+	if err != nil {
+		return false
+	}
+	end, err := ParseClock(f.QuietHoursEnd)
+	if err != nil {
+		return false
+	}
+
+	now := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return now >= start && now < end
+	}
+	// Spans midnight, e.g. 22:00 to 07:00
+	return now >= start || now < end
+}
+
+// SavedFilterAlert records that a part matching a saved filter was, or is to be, notified. There is at most
+// one alert per filter and part.
+type SavedFilterAlert struct {
+	ID            int        `json:"id"`
+	SavedFilterID int        `json:"saved_filter_id"`
+	PartID        int        `json:"part_id"` // DB ID of the part
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SentAt        *time.Time `json:"sent_at"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInQuietHours(t *testing.T) {
+	at := func(clock string) time.Time {
+		parsed, err := time.Parse("15:04", clock)
+		if err != nil {
+			t.Fatalf("bad clock %q: %v", clock, err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name       string
+		start, end string
+		now        string
+		want       bool
+	}{
+		{"no quiet hours", "", "", "03:00", false},
+		{"only a start", "22:00", "", "23:00", false},
+		{"invalid start", "25:00", "07:00", "03:00", false},
+		{"same day inside", "12:00", "14:00", "13:30", true},
+		{"same day at start", "12:00", "14:00", "12:00", true},
+		{"same day at end", "12:00", "14:00", "14:00", false},
+		{"same day before", "12:00", "14:00", "11:59", false},
+		{"across midnight late evening", "22:00", "07:00", "23:15", true},
+		{"across midnight at midnight", "22:00", "07:00", "00:00", true},
+		{"across midnight early morning", "22:00", "07:00", "06:59", true},
+		{"across midnight at end", "22:00", "07:00", "07:00", false},
+		{"across midnight daytime", "22:00", "07:00", "12:00", false},
+		{"across midnight just before start", "22:00", "07:00", "21:59", false},
+		{"empty range", "08:00", "08:00", "08:00", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := &SavedFilter{QuietHoursStart: tt.start, QuietHoursEnd: tt.end}
+			if got := filter.InQuietHours(at(tt.now)); got != tt.want {
+				t.Errorf("InQuietHours(%s) with %q-%q = %v, want %v", tt.now, tt.start, tt.end, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"00:00", 0, false},
+		{"07:30", 450, false},
+		{"23:59", 1439, false},
+		{"24:00", 0, true},
+		{"12:60", 0, true},
+		{"noon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseClock(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseClock(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseClock(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidSchedule is returned for cron expressions the scheduler cannot parse
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// ScheduleEntry is the scheduled fetch of one site as exposed by /api/scheduler
+type ScheduleEntry struct {
+	SiteID        int        `json:"site_id"`
+	SiteName      string     `json:"site_name"`
+	Schedule      string     `json:"schedule"`
+	JitterSeconds int        `json:"jitter_seconds"`
+	Paused        bool       `json:"paused"`
+	Running       bool       `json:"running"`  // Whether a fetch job of the site is running
+	NextRun       *time.Time `json:"next_run"` // Before jitter, nil while paused
+	LastRun       *time.Time `json:"last_run"` // When the schedule or a trigger last queued a fetch since the API started
+}
+
+// UpdateScheduleRequest represents the request body for changing the schedule of a site
+type UpdateScheduleRequest struct {
+	Schedule      string `json:"schedule" binding:"required"`
+	JitterSeconds *int   `json:"jitter_seconds"` // Keeps the current jitter when omitted
+}
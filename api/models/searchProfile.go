@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// SearchProfile describes a persisted search that the scheduler runs against its target sites
+type SearchProfile struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	VehicleType string    `json:"vehicle_type"`
+	Make        string    `json:"make"`
+	BaseModel   string    `json:"base_model"`
+	Model       string    `json:"model"`
+	YearFrom    int       `json:"year_from"`
+	YearTo      int       `json:"year_to"`
+	Keywords    string    `json:"keywords"`
+	MinPrice    int       `json:"min_price"`
+	MaxPrice    int       `json:"max_price"`
+	SiteIDs     []int     `json:"site_ids"` // Empty means every registered site
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SearchProfileRequest represents the request body for creating or updating a search profile
+type SearchProfileRequest struct {
+	Name        string `json:"name" binding:"required"`
+	VehicleType string `json:"vehicle_type"`
+	Make        string `json:"make"`
+	BaseModel   string `json:"base_model"`
+	Model       string `json:"model"`
+	YearFrom    int    `json:"year_from"`
+	YearTo      int    `json:"year_to"`
+	Keywords    string `json:"keywords"`
+	MinPrice    int    `json:"min_price"`
+	MaxPrice    int    `json:"max_price"`
+	SiteIDs     []int  `json:"site_ids"`
+	Enabled     *bool  `json:"enabled"`
+}
+
+// TargetsSite reports whether the profile should run against the given site
+func (p *SearchProfile) TargetsSite(siteID int) bool {
+	if len(p.SiteIDs) == 0 {
+		return true
+	}
+	for _, id := range p.SiteIDs {
+		if id == siteID {
+			return true
+		}
+	}
+	return false
+}
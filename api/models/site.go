@@ -1,20 +1,116 @@
 package models
 
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// redactedValue replaces secrets in site configs returned by the API
+const redactedValue = "xxxxx"
+
+// secretConfigKeys are the parts of config keys whose values are never returned by the API
+var secretConfigKeys = []string{"secret", "password", "token", "api_key"}
+
 // Site represents a parts supplier website
 type Site struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
-	URL  string `json:"url"`
+	ID               int             `json:"id"`
+	Name             string          `json:"name"`
+	URL              string          `json:"url"`
+	ClientType       string          `json:"client_type"`
+	Config           json.RawMessage `json:"config"`
+	GracePeriodHours int             `json:"grace_period_hours"` // How long a part may go unseen before it is marked removed
+	IngestEnabled    bool            `json:"ingest_enabled"`     // Whether an ingest token is set, see /api/ingest
+
+	// When the scheduler fetches the site
+	Schedule              string `json:"schedule"`                // Cron expression with seconds
+	ScheduleJitterSeconds int    `json:"schedule_jitter_seconds"` // Random delay of up to this many seconds per run
+	SchedulePaused        bool   `json:"schedule_paused"`
+
+	// Outcome of the latest fetch runs, to spot failing scrapers
+	LastFetchAt           *time.Time `json:"last_fetch_at"`
+	LastFetchStatus       string     `json:"last_fetch_status"`
+	LastSuccessfulFetchAt *time.Time `json:"last_successful_fetch_at"`
+}
+
+// MarshalJSON returns the site with the secrets of its config redacted, the API is not
+// authenticated
+func (s Site) MarshalJSON() ([]byte, error) {
+	type site Site // Drops the MarshalJSON method
+	redacted := site(s)
+	redacted.Config = RedactConfig(s.Config)
+	return json.Marshal(redacted)
+}
+
+// RedactConfig replaces the values of secret keys, e.g. the eBay client_secret, and the passwords
+// of URLs, e.g. the proxy URLs, in a site config blob. Configs that are not JSON objects are
+// returned unchanged.
+func RedactConfig(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return raw
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return raw
+	}
+	redacted, err := json.Marshal(redactValue(config))
+	if err != nil {
+		return raw
+	}
+	return redacted
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			if isSecretConfigKey(key) {
+				if nested != nil && nested != "" {
+					v[key] = redactedValue
+				}
+				continue
+			}
+			v[key] = redactValue(nested)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = redactValue(nested)
+		}
+	case string:
+		if parsed, err := url.Parse(v); err == nil && parsed.User != nil {
+			if _, hasPassword := parsed.User.Password(); hasPassword {
+				return parsed.Redacted()
+			}
+		}
+	}
+	return value
+}
+
+func isSecretConfigKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range secretConfigKeys {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+	return false
 }
 
 // CreateSiteRequest represents the request body for creating a site
 type CreateSiteRequest struct {
-	Name string `json:"name" binding:"required"`
-	URL  string `json:"url" binding:"required"`
+	Name             string          `json:"name" binding:"required"`
+	URL              string          `json:"url" binding:"required"`
+	ClientType       string          `json:"client_type"`
+	Config           json.RawMessage `json:"config"`
+	GracePeriodHours int             `json:"grace_period_hours"`
 }
 
 // UpdateSiteRequest represents the request body for updating a site
 type UpdateSiteRequest struct {
-	Name string `json:"name" binding:"required"`
-	URL  string `json:"url" binding:"required"`
+	Name             string          `json:"name" binding:"required"`
+	URL              string          `json:"url" binding:"required"`
+	ClientType       string          `json:"client_type"`
+	Config           json.RawMessage `json:"config"`
+	GracePeriodHours int             `json:"grace_period_hours"`
 }
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook event types a subscriber can choose from. The part events are the domain events of the
+// same name, fetch_failed is a fetch_run_finished event of a failed run.
+const (
+	WebhookEventPartCreated  = EventPartCreated
+	WebhookEventPriceChanged = EventPriceChanged
+	WebhookEventPartRemoved  = EventPartRemoved
+	WebhookEventFetchFailed  = "fetch_failed"
+)
+
+// WebhookEvents lists every webhook event type
+var WebhookEvents = []string{WebhookEventPartCreated, WebhookEventPriceChanged, WebhookEventPartRemoved, WebhookEventFetchFailed}
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending" // Waiting for its first attempt or a retry
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed" // Gave up after too many attempts
+)
+
+// WebhookSubscription is a URL that receives signed JSON payloads for the events it subscribed to
+type WebhookSubscription struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	URL       string     `json:"url"`
+	Secret    string     `json:"secret"` // Key of the HMAC-SHA256 signature of every delivery
+	Events    []string   `json:"events"`
+	Filter    PartFilter `json:"filter"` // Limits the part events to matching parts, ignores the status
+	Enabled   bool       `json:"enabled"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Subscribes reports whether the webhook receives the given webhook event type
+func (w *WebhookSubscription) Subscribes(eventType string) bool {
+	for _, subscribed := range w.Events {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookSubscriptionRequest represents the request body for creating or updating a webhook
+type WebhookSubscriptionRequest struct {
+	Name    string     `json:"name"`
+	URL     string     `json:"url" binding:"required"`
+	Secret  string     `json:"secret"` // Generated on create and kept on update when empty
+	Events  []string   `json:"events" binding:"required"`
+	Filter  PartFilter `json:"filter"`
+	Enabled *bool      `json:"enabled"`
+}
+
+// WebhookPayload is the JSON body posted to a webhook
+type WebhookPayload struct {
+	DeliveryID int             `json:"delivery_id"`
+	EventID    int             `json:"event_id"`
+	Type       string          `json:"type"` // One of WebhookEvents
+	CreatedAt  time.Time       `json:"created_at"`
+	Data       json.RawMessage `json:"data"` // The domain event, e.g. a PartCreatedEvent with the part
+}
+
+// WebhookDelivery is an attempt to post an event to a webhook, with its retries
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	EventID        int             `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"` // The domain event, sent as WebhookPayload.Data
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"response_status"` // HTTP status of the last attempt, 0 when none arrived
+	LastError      string          `json:"last_error"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	. "dsmpartsfinder-api/models"
+)
+
+//go:embed templates
+var templatesFS embed.FS
+
+// digestFuncs are the helpers available to both digest templates
+var digestFuncs = map[string]interface{}{
+	"date": func(t time.Time) string {
+		return t.Local().Format("Mon 02 Jan 2006 15:04")
+	},
+	"title": titleCase,
+	"category": func(typeName string) string {
+		if typeName == "" {
+			return "Uncategorized"
+		}
+		return typeName
+	},
+}
+
+var (
+	digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest.html.tmpl").Funcs(digestFuncs).ParseFS(templatesFS, "templates/digest.html.tmpl"))
+	digestTextTemplate = texttemplate.Must(texttemplate.New("digest.txt.tmpl").Funcs(digestFuncs).ParseFS(templatesFS, "templates/digest.txt.tmpl"))
+)
+
+// titleCase upper cases the first letter, e.g. "daily" becomes "Daily"
+func titleCase(s string) string {
+	if s == "" {
+		return ""
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// DigestSubject returns the subject line of a digest mail
+func DigestSubject(digest *Digest) string {
+	return fmt.Sprintf("%s parts digest: %d new, %d cheaper, %d gone", titleCase(digest.Frequency),
+		digest.NewPartsCount(), len(digest.PriceDrops), len(digest.Removed))
+}
+
+// RenderDigest renders a digest as a mail with a plain text and an HTML body
+func RenderDigest(digest *Digest) (Mail, error) {
+	var html, text bytes.Buffer
+	if err := digestHTMLTemplate.Execute(&html, digest); err != nil {
+		return Mail{}, fmt.Errorf("failed to render digest HTML: %w", err)
+	}
+	if err := digestTextTemplate.Execute(&text, digest); err != nil {
+		return Mail{}, fmt.Errorf("failed to render digest text: %w", err)
+	}
+
+	return Mail{
+		Subject: DigestSubject(digest),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
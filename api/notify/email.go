@@ -0,0 +1,198 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// smtpTimeout bounds the whole conversation with the SMTP server
+const smtpTimeout = 30 * time.Second
+
+// SMTPConfig is the mail server alerts and digests are sent through. A local stand-in such as
+// MailHog works without credentials.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPConfigFromEnv reads SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME, SMTP_PASSWORD and
+// SMTP_FROM
+func SMTPConfigFromEnv() SMTPConfig {
+	config := SMTPConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if config.Port == "" {
+		config.Port = "587"
+	}
+	if config.From == "" {
+		config.From = config.Username
+	}
+	return config
+}
+
+// Configured reports whether mail can be sent
+func (c SMTPConfig) Configured() bool {
+	return c.Host != "" && c.From != ""
+}
+
+// Mail is a message with a plain text body and an optional HTML alternative
+type Mail struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// SendMail delivers a message, upgrading to TLS when the server offers STARTTLS
+func SendMail(ctx context.Context, config SMTPConfig, mail Mail) error {
+	if !config.Configured() {
+		return fmt.Errorf("SMTP is not configured, set SMTP_HOST and SMTP_FROM")
+	}
+	if len(mail.To) == 0 {
+		return fmt.Errorf("mail has no recipients")
+	}
+
+	message, err := buildMessage(config.From, mail)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(smtpTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(config.Host, config.Port))
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: config.Host}); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if config.Username != "" {
+		// PlainAuth refuses to send credentials over an unencrypted connection to a remote host
+		if err := client.Auth(smtp.PlainAuth("", config.Username, config.Password, config.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(config.From); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	for _, to := range mail.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("SMTP RCPT TO %s failed: %w", to, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := writer.Write(message); err != nil {
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected mail: %w", err)
+	}
+	return client.Quit()
+}
+
+// buildMessage renders the headers and a text or multipart/alternative body
+func buildMessage(from string, mail Mail) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(mail.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", mail.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	if mail.HTML == "" {
+		b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&b, mail.Text); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+
+	boundaryBytes := make([]byte, 12)
+	if _, err := rand.Read(boundaryBytes); err != nil {
+		return nil, fmt.Errorf("failed to create MIME boundary: %w", err)
+	}
+	boundary := "dsmparts-" + hex.EncodeToString(boundaryBytes)
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	for _, alternative := range []struct{ contentType, body string }{
+		{"text/plain", mail.Text},
+		{"text/html", mail.HTML},
+	} {
+		fmt.Fprintf(&b, "--%s\r\n", boundary)
+		fmt.Fprintf(&b, "Content-Type: %s; charset=utf-8\r\n", alternative.contentType)
+		b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&b, alternative.body); err != nil {
+			return nil, err
+		}
+		b.WriteString("\r\n")
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+func writeQuotedPrintable(b *bytes.Buffer, body string) error {
+	writer := quotedprintable.NewWriter(b)
+	if _, err := writer.Write([]byte(body)); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// Email sends alerts to an address over SMTP
+type Email struct {
+	Config SMTPConfig
+	To     string
+}
+
+// NewEmail creates an email notifier for an address
+func NewEmail(config SMTPConfig, to string) *Email {
+	return &Email{Config: config, To: to}
+}
+
+// Notify mails the alert as plain text
+func (e *Email) Notify(ctx context.Context, alert Alert) error {
+	return SendMail(ctx, e.Config, Mail{
+		To:      []string{e.To},
+		Subject: alert.Subject(),
+		Text:    alert.Text(),
+	})
+}
@@ -0,0 +1,195 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// fakeSMTPServer accepts one SMTP session on a local port and records the envelope and message
+type fakeSMTPServer struct {
+	listener net.Listener
+	from     string
+	to       []string
+	data     string
+	done     chan struct{}
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server := &fakeSMTPServer{listener: listener, done: make(chan struct{})}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+func (s *fakeSMTPServer) config() SMTPConfig {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return SMTPConfig{Host: host, Port: port, From: "alerts@example.com"}
+}
+
+func (s *fakeSMTPServer) serve() {
+	defer close(s.done)
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP fake")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			s.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			s.to = append(s.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			s.data = data.String()
+			reply("250 OK queued")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestSendMail(t *testing.T) {
+	server := newFakeSMTPServer(t)
+
+	err := SendMail(context.Background(), server.config(), Mail{
+		To:      []string{"owner@example.com", "other@example.com"},
+		Subject: "Neue Teile für Turbos",
+		Text:    "TD05H turbo\nPrice: 300 €\n",
+	})
+	if err != nil {
+		t.Fatalf("SendMail: %v", err)
+	}
+	<-server.done
+
+	if server.from != "alerts@example.com" {
+		t.Errorf("MAIL FROM = %q, want alerts@example.com", server.from)
+	}
+	if strings.Join(server.to, ",") != "owner@example.com,other@example.com" {
+		t.Errorf("RCPT TO = %v, want both recipients", server.to)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(server.data))
+	if err != nil {
+		t.Fatalf("failed to parse sent message: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil || subject != "Neue Teile für Turbos" {
+		t.Errorf("Subject = %q (%v), want the encoded subject", subject, err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(message.Body))
+	if err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	if got := strings.ReplaceAll(string(body), "\r\n", "\n"); got != "TD05H turbo\nPrice: 300 €\n" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestSendMailNotConfigured(t *testing.T) {
+	if err := SendMail(context.Background(), SMTPConfig{}, Mail{To: []string{"owner@example.com"}}); err == nil {
+		t.Error("SendMail without a server returned no error")
+	}
+	config := SMTPConfig{Host: "127.0.0.1", Port: "25", From: "alerts@example.com"}
+	if err := SendMail(context.Background(), config, Mail{}); err == nil {
+		t.Error("SendMail without recipients returned no error")
+	}
+}
+
+func TestBuildMessageMultipart(t *testing.T) {
+	raw, err := buildMessage("alerts@example.com", Mail{
+		To:      []string{"owner@example.com"},
+		Subject: "Weekly digest",
+		Text:    "3 new parts",
+		HTML:    "<p>3 new parts</p>",
+	})
+	if err != nil {
+		t.Fatalf("buildMessage: %v", err)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+	if from := message.Header.Get("From"); from != "alerts@example.com" {
+		t.Errorf("From = %q", from)
+	}
+	if to := message.Header.Get("To"); to != "owner@example.com" {
+		t.Errorf("To = %q", to)
+	}
+	if _, err := mail.ParseDate(message.Header.Get("Date")); err != nil {
+		t.Errorf("invalid Date header: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q (%v), want multipart/alternative", message.Header.Get("Content-Type"), err)
+	}
+
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	want := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", "3 new parts"},
+		{"text/html; charset=utf-8", "<p>3 new parts</p>"},
+	}
+	for _, alternative := range want {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatalf("missing %s part: %v", alternative.contentType, err)
+		}
+		if got := part.Header.Get("Content-Type"); got != alternative.contentType {
+			t.Errorf("part Content-Type = %q, want %q", got, alternative.contentType)
+		}
+		// multipart.Reader decodes quoted-printable parts itself
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+		if got := strings.TrimRight(string(body), "\r\n"); got != alternative.body {
+			t.Errorf("part body = %q, want %q", got, alternative.body)
+		}
+	}
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Errorf("expected two parts, got more (%v)", err)
+	}
+}
@@ -0,0 +1,58 @@
+// Package notify sends alerts about new parts through pluggable notifiers
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	. "dsmpartsfinder-api/models"
+)
+
+// Notifier types, as stored with a saved filter
+const (
+	TypeWebhook = "webhook"
+	TypeEmail   = "email"
+)
+
+// Alert tells the owner of a saved filter about the new parts matching it
+type Alert struct {
+	FilterID   int    `json:"filter_id"`
+	FilterName string `json:"filter_name"`
+	Parts      []Part `json:"parts"`
+	Test       bool   `json:"test,omitempty"` // Sent on request to check the notifier
+}
+
+// Notifier delivers alerts. Implementations must be safe for concurrent use.
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// Subject returns a one line summary of an alert
+func (a Alert) Subject() string {
+	prefix := ""
+	if a.Test {
+		prefix = "[Test] "
+	}
+	if len(a.Parts) == 1 {
+		return fmt.Sprintf("%sNew part for %s: %s", prefix, a.FilterName, a.Parts[0].Name)
+	}
+	return fmt.Sprintf("%s%d new parts for %s", prefix, len(a.Parts), a.FilterName)
+}
+
+// Text renders an alert as plain text, one part per paragraph
+func (a Alert) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", a.Subject())
+	for _, part := range a.Parts {
+		fmt.Fprintf(&b, "%s\n", part.Name)
+		if part.Price != "" {
+			fmt.Fprintf(&b, "Price: %s\n", part.Price)
+		}
+		if part.TypeName != "" {
+			fmt.Fprintf(&b, "Type: %s\n", part.TypeName)
+		}
+		fmt.Fprintf(&b, "%s\n\n", part.URL)
+	}
+	return b.String()
+}
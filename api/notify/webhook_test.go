@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "dsmpartsfinder-api/models"
+)
+
+func TestWebhookNotify(t *testing.T) {
+	var received Alert
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		contentType = r.Header.Get("Content-Type")
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode alert: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	alert := Alert{
+		FilterID:   7,
+		FilterName: "Turbos",
+		Parts:      []Part{{ID: 1, Name: "TD05H turbo", URL: "https://example.com/1"}},
+	}
+	if err := NewWebhook(server.URL).Notify(context.Background(), alert); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+	if received.FilterID != 7 || received.FilterName != "Turbos" {
+		t.Errorf("received filter %d %q, want 7 \"Turbos\"", received.FilterID, received.FilterName)
+	}
+	if len(received.Parts) != 1 || received.Parts[0].Name != "TD05H turbo" {
+		t.Errorf("received parts %+v, want the TD05H turbo", received.Parts)
+	}
+}
+
+func TestWebhookNotifyErrorStatus(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusInternalServerError, http.StatusServiceUnavailable} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+
+		err := NewWebhook(server.URL).Notify(context.Background(), Alert{FilterName: "Turbos"})
+		server.Close()
+		if err == nil {
+			t.Errorf("status %d: Notify returned no error", status)
+			continue
+		}
+		if !strings.Contains(err.Error(), "status") {
+			t.Errorf("status %d: unexpected error %v", status, err)
+		}
+	}
+}
+
+func TestWebhookNotifyUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	if err := NewWebhook(url).Notify(context.Background(), Alert{}); err == nil {
+		t.Fatal("Notify to a closed server returned no error")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	. "dsmpartsfinder-api/models"
+)
+
+// partContent is the seller editable content of a listing, used to detect edits on refetch
+type partContent struct {
+	Name        string
+	Description string
+	TypeName    string
+	ImageHash   string   // SHA-256 of the cover image, see the images package
+	Gallery     []string // SHA-256 of the photos after the cover, in order
+	URL         string
+	Price       string
+}
+
+// newPartContent returns the content of a listing with the given gallery, cover first
+func newPartContent(name, description, typeName string, images []PartImage, url, price string) partContent {
+	content := partContent{
+		Name:        name,
+		Description: description,
+		TypeName:    typeName,
+		URL:         url,
+		Price:       price,
+	}
+	for i, image := range images {
+		if i == 0 {
+			content.ImageHash = image.Hash
+		} else {
+			content.Gallery = append(content.Gallery, image.Hash)
+		}
+	}
+	return content
+}
+
+// storedPartContent returns the content of a part as stored in the database. The gallery is
+// only known when the images of the part were loaded.
+func storedPartContent(part *Part) partContent {
+	content := newPartContent(part.Name, part.Description, part.TypeName, part.Images, part.URL, part.Price)
+	content.ImageHash = part.ImageHash
+	return content
+}
+
+// hash returns a SHA-256 over all content fields. The gallery is only included when there is
+// one, so parts with at most one photo keep the hash they had before galleries.
+func (p partContent) hash() string {
+	fields := []string{p.Name, p.Description, p.TypeName, p.ImageHash, p.URL, p.Price}
+	if len(p.Gallery) > 0 {
+		fields = append(fields, strings.Join(p.Gallery, ","))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// diff returns the fields that differ from old. Images are logged by their hash.
+func (p partContent) diff(old partContent) []PartChange {
+	changes := make([]PartChange, 0)
+	addChange := func(field, oldValue, newValue string) {
+		if oldValue != newValue {
+			changes = append(changes, PartChange{Field: field, OldValue: oldValue, NewValue: newValue})
+		}
+	}
+
+	addChange("name", old.Name, p.Name)
+	addChange("description", old.Description, p.Description)
+	addChange("type_name", old.TypeName, p.TypeName)
+	addChange("url", old.URL, p.URL)
+	addChange("price", old.Price, p.Price)
+	addChange("image", imageDigest(old.ImageHash), imageDigest(p.ImageHash))
+	addChange("gallery", galleryDigest(old.Gallery), galleryDigest(p.Gallery))
+	return changes
+}
+
+// imageDigest identifies an image in the change log
+func imageDigest(imageHash string) string {
+	if imageHash == "" {
+		return ""
+	}
+	return "sha256:" + imageHash
+}
+
+// galleryDigest identifies the photos after the cover in the change log
+func galleryDigest(gallery []string) string {
+	digests := make([]string, len(gallery))
+	for i, imageHash := range gallery {
+		digests[i] = imageDigest(imageHash)
+	}
+	return strings.Join(digests, ",")
+}
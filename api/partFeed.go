@@ -0,0 +1,51 @@
+package main
+
+import "sync"
+
+// PartFeed wakes up the subscribers of /api/parts/stream when new parts were stored. It only
+// signals; subscribers read the new parts from the database, so a slow subscriber catches up
+// instead of missing parts.
+type PartFeed struct {
+	mu          sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+// NewPartFeed creates a new part feed
+func NewPartFeed() *PartFeed {
+	return &PartFeed{
+		subscribers: make(map[chan struct{}]struct{}),
+	}
+}
+
+// Notify signals every subscriber that new parts were stored. Signals a subscriber has not
+// picked up yet are merged.
+func (f *PartFeed) Notify() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for signal := range f.subscribers {
+		select {
+		case signal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel signalled after new parts were stored and a function to unsubscribe
+func (f *PartFeed) Subscribe() (<-chan struct{}, func()) {
+	signal := make(chan struct{}, 1)
+
+	f.mu.Lock()
+	f.subscribers[signal] = struct{}{}
+	f.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			f.mu.Lock()
+			delete(f.subscribers, signal)
+			f.mu.Unlock()
+		})
+	}
+	return signal, unsubscribe
+}
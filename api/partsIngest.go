@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"dsmpartsfinder-api/images"
+	. "dsmpartsfinder-api/models"
+	"dsmpartsfinder-api/siteclients"
+)
+
+// maxIngestBatchSize is how many parts a single ingest request may push
+const maxIngestBatchSize = 1000
+
+// validateIngestPart checks a pushed part and fills in its site and creation date, returning
+// the reason to reject it
+func validateIngestPart(part *siteclients.Part, siteID int) string {
+	if part.ID == "" {
+		return "id is required"
+	}
+	if part.Name == "" {
+		return "name is required"
+	}
+	if parsed, err := url.Parse(part.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "url must be an http or https URL"
+	}
+	if part.SiteID != 0 && part.SiteID != siteID {
+		return fmt.Sprintf("site_id %d does not match the ingest site %d", part.SiteID, siteID)
+	}
+	if part.ImageBase64 != "" {
+		if _, err := base64.StdEncoding.DecodeString(part.ImageBase64); err != nil {
+			return "image_base64 is not valid base64"
+		}
+	}
+	if len(part.Images) > siteclients.MaxImagesPerPart {
+		return fmt.Sprintf("images has %d entries, at most %d are allowed", len(part.Images), siteclients.MaxImagesPerPart)
+	}
+	for i, image := range part.Images {
+		if image.Base64 == "" && image.Hash != "" {
+			if !images.ValidHash(image.Hash) {
+				return fmt.Sprintf("images[%d].hash is not a SHA-256 hex digest", i)
+			}
+			continue
+		}
+		if _, err := base64.StdEncoding.DecodeString(image.Base64); err != nil || image.Base64 == "" {
+			return fmt.Sprintf("images[%d].base64 is not valid base64", i)
+		}
+	}
+
+	part.SiteID = siteID
+	if part.CreationDate.IsZero() {
+		part.CreationDate = time.Now()
+	}
+	return ""
+}
+
+// IngestParts stores a batch of parts pushed by an external scraper, with the same dedupe,
+// last_seen and change handling as FetchAndStoreParts. The batch is recorded as a fetch run with
+// the ingest trigger. A batch is not a complete listing of the site, so no parts are aged out.
+func (s *PartsService) IngestParts(siteID int, parts []siteclients.Part) ([]IngestResult, *FetchRun, error) {
+	if len(parts) > maxIngestBatchSize {
+		return nil, nil, fmt.Errorf("batch has %d parts, at most %d are allowed", len(parts), maxIngestBatchSize)
+	}
+	log.Printf("[IngestParts] Ingesting %d parts for site ID %d", len(parts), siteID)
+
+	results := make([]IngestResult, len(parts))
+	accepted := make([]siteclients.Part, 0, len(parts))
+	acceptedIndex := make(map[string]int, len(parts))
+	for i := range parts {
+		part := parts[i]
+		results[i] = IngestResult{Index: i, ID: part.ID}
+
+		reason := validateIngestPart(&part, siteID)
+		if reason == "" {
+			if _, seen := acceptedIndex[part.ID]; seen {
+				reason = "id appears more than once in the batch"
+			}
+		}
+		if reason != "" {
+			results[i].Status = IngestRejected
+			results[i].Reason = reason
+			continue
+		}
+
+		acceptedIndex[part.ID] = i
+		accepted = append(accepted, part)
+	}
+
+	run, err := s.sqlClient.CreateFetchRun(siteID, 0, FetchTriggerIngest, map[string]int{"items": len(parts)})
+	if err != nil {
+		// Not being able to record the run should not stop the ingest
+		log.Printf("[IngestParts] WARNING: Failed to record fetch run: %v", err)
+		run = &FetchRun{SiteID: siteID, Trigger: FetchTriggerIngest}
+	}
+	run.FetchedCount = len(parts)
+	run.IncompleteReason = "ingested batch"
+
+	err = s.storeIngested(siteID, accepted, acceptedIndex, results, run)
+	if run.ID != 0 {
+		run.Status = FetchRunSucceeded
+		if err != nil {
+			run.Status = FetchRunFailed
+			run.Error = err.Error()
+		}
+		if finishErr := s.sqlClient.FinishFetchRun(run); finishErr != nil {
+			log.Printf("[IngestParts] WARNING: Failed to finish fetch run %d: %v", run.ID, finishErr)
+		} else if run.Status == FetchRunFailed {
+			s.publishSiteFailing(run)
+		}
+	}
+	if err != nil {
+		return nil, run, err
+	}
+
+	log.Printf("[IngestParts] Ingested %d parts for site ID %d: %d inserted, %d updated, %d rejected",
+		len(parts), siteID, run.NewCount, run.UpdatedCount, run.ErrorCount)
+	return results, run, nil
+}
+
+// storeIngested stores the accepted parts of a batch and fills in their results and the counts
+// of the run
+func (s *PartsService) storeIngested(siteID int, accepted []siteclients.Part, acceptedIndex map[string]int, results []IngestResult, run *FetchRun) error {
+	existingParts, updatedParts, err := s.refreshExistingParts(siteID, accepted)
+	if err != nil {
+		return err
+	}
+	storedParts, failedParts := s.insertNewParts(accepted, existingParts)
+
+	for _, part := range storedParts {
+		result := &results[acceptedIndex[part.PartID]]
+		result.Status = IngestInserted
+		result.PartID = part.ID
+	}
+	for partID, insertErr := range failedParts {
+		result := &results[acceptedIndex[partID]]
+		result.Status = IngestRejected
+		result.Reason = fmt.Sprintf("failed to store part: %v", insertErr)
+	}
+
+	if len(existingParts) > 0 {
+		existingPartIDs := make([]string, 0, len(existingParts))
+		for partID := range existingParts {
+			existingPartIDs = append(existingPartIDs, partID)
+		}
+		known, err := s.sqlClient.GetStoredParts(existingPartIDs, siteID)
+		if err != nil {
+			log.Printf("[IngestParts] WARNING: Failed to load stored parts: %v", err)
+		}
+		for _, partID := range existingPartIDs {
+			result := &results[acceptedIndex[partID]]
+			result.Status = IngestDuplicate
+			if updatedParts[partID] {
+				result.Status = IngestUpdated
+			}
+			result.PartID = known[partID].ID
+		}
+	}
+
+	run.NewCount = len(storedParts)
+	run.UpdatedCount = len(updatedParts)
+	run.ErrorCount = len(results) - len(accepted) + len(failedParts)
+	return nil
+}
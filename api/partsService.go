@@ -4,22 +4,32 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
+	"dsmpartsfinder-api/images"
 	. "dsmpartsfinder-api/models"
+	"dsmpartsfinder-api/prices"
 	"dsmpartsfinder-api/siteclients"
 )
 
 // PartsService manages the fetching and storage of parts from various site clients
 type PartsService struct {
 	sqlClient   *SQLClient
+	progress    *ProgressHub
+	images      *images.Store
 	siteClients map[int]siteclients.SiteClient
+
+	siteFailingMu sync.Mutex // Serializes publishSiteFailing
 }
 
-// NewPartsService creates a new PartsService
-func NewPartsService(sqlClient *SQLClient) *PartsService {
+// NewPartsService creates a new PartsService that publishes the progress of fetches to progress
+// and keeps the images of parts in imageStore
+func NewPartsService(sqlClient *SQLClient, progress *ProgressHub, imageStore *images.Store) *PartsService {
 	return &PartsService{
 		sqlClient:   sqlClient,
+		progress:    progress,
+		images:      imageStore,
 		siteClients: make(map[int]siteclients.SiteClient),
 	}
 }
@@ -40,9 +50,85 @@ func (s *PartsService) GetSiteClient(siteID int) (siteclients.SiteClient, error)
 }
 
 // FetchAndStoreParts fetches parts from a site client and stores them in the database
-// It also updates last_seen for existing parts and optionally deletes stale parts
-func (s *PartsService) FetchAndStoreParts(ctx context.Context, siteID int, params siteclients.SearchParams) ([]Part, error) {
-	log.Printf("[FetchAndStoreParts] Starting fetch for site ID: %d with params: %+v", siteID, params)
+// It also updates last_seen for existing parts and moves parts that are gone through
+// the missing and removed statuses. Every call is recorded as a fetch run with the
+// given trigger, and its progress is published to the progress hub.
+func (s *PartsService) FetchAndStoreParts(ctx context.Context, siteID int, params siteclients.SearchParams, trigger string) ([]Part, error) {
+	log.Printf("[FetchAndStoreParts] Starting %s fetch for site ID: %d with params: %+v", trigger, siteID, params)
+
+	run, err := s.sqlClient.CreateFetchRun(siteID, params.ProfileID, trigger, params)
+	if err != nil {
+		// Not being able to record the run should not stop the fetch
+		log.Printf("[FetchAndStoreParts] WARNING: Failed to record fetch run: %v", err)
+		run = &FetchRun{SiteID: siteID, Trigger: trigger}
+	}
+
+	ctx = siteclients.WithProgress(ctx, s.progress.Publish)
+	ctx = siteclients.StartProgress(ctx, siteID, run.ID)
+	storedParts, err := s.fetchAndStore(ctx, siteID, params, run)
+	siteclients.FinishProgress(ctx, err)
+	for _, failure := range siteclients.ProxyFailures(ctx) {
+		log.Printf("[FetchAndStoreParts] Proxy %s failed %d times for site ID %d, last: %s", failure.Proxy, failure.Failures, siteID, failure.LastError)
+		run.ProxyFailures = append(run.ProxyFailures, ProxyFailure{Proxy: failure.Proxy, Failures: failure.Failures, LastError: failure.LastError})
+	}
+	if run.ID != 0 {
+		run.Status = FetchRunSucceeded
+		if err != nil {
+			run.Status = FetchRunFailed
+			run.Error = err.Error()
+		}
+		if finishErr := s.sqlClient.FinishFetchRun(run); finishErr != nil {
+			log.Printf("[FetchAndStoreParts] WARNING: Failed to finish fetch run %d: %v", run.ID, finishErr)
+		} else if run.Status == FetchRunFailed {
+			s.publishSiteFailing(run)
+		}
+	}
+	return storedParts, err
+}
+
+// publishSiteFailing publishes SiteFailing for a failed run when the site starts failing, that is
+// unless SiteFailing was published for the site since its last successful run. Every search
+// profile of a site runs its own fetch, so the previous run alone does not tell.
+func (s *PartsService) publishSiteFailing(run *FetchRun) {
+	// Runs of the same site finishing at once must not both see the site as healthy
+	s.siteFailingMu.Lock()
+	defer s.siteFailingMu.Unlock()
+
+	published, err := s.sqlClient.GetEvents(EventFilter{Type: EventSiteFailing, SiteID: run.SiteID}, 1, 0)
+	if err != nil {
+		log.Printf("[FetchAndStoreParts] WARNING: Failed to load the last failure of site ID %d: %v", run.SiteID, err)
+		return
+	}
+	if len(published) > 0 {
+		var last SiteFailingEvent
+		if err := published[0].Decode(&last); err != nil {
+			log.Printf("[FetchAndStoreParts] WARNING: Failed to decode the last failure of site ID %d: %v", run.SiteID, err)
+			return
+		}
+		// Compare run IDs rather than times, which are stored to the second
+		succeeded, err := s.sqlClient.GetFetchRuns(FetchRunFilter{SiteID: run.SiteID, Status: FetchRunSucceeded}, 1, 0)
+		if err != nil {
+			log.Printf("[FetchAndStoreParts] WARNING: Failed to load the last successful fetch run of site ID %d: %v", run.SiteID, err)
+			return
+		}
+		if len(succeeded) == 0 || succeeded[0].ID < last.RunID {
+			return
+		}
+	}
+
+	event := SiteFailingEvent{SiteID: run.SiteID, RunID: run.ID, Error: run.Error}
+	if site, err := s.sqlClient.GetSiteByID(run.SiteID); err == nil {
+		event.SiteName = site.Name
+		event.LastSuccessfulFetchAt = site.LastSuccessfulFetchAt
+	}
+	if err := s.sqlClient.PublishEvent(event); err == nil {
+		log.Printf("[FetchAndStoreParts] Site ID %d is failing: %s", run.SiteID, run.Error)
+	}
+}
+
+// fetchAndStore does the work of FetchAndStoreParts, filling in the counts of the run
+func (s *PartsService) fetchAndStore(ctx context.Context, siteID int, params siteclients.SearchParams, run *FetchRun) ([]Part, error) {
+	fetchStartedAt := time.Now()
 
 	// Get the appropriate site client
 	client, err := s.GetSiteClient(siteID)
@@ -54,19 +140,64 @@ func (s *PartsService) FetchAndStoreParts(ctx context.Context, siteID int, param
 	log.Printf("[FetchAndStoreParts] Fetching parts from %s (site ID: %d)", client.GetName(), siteID)
 
 	// Fetch parts from the site
-	fetchedParts, err := client.FetchParts(ctx, params)
+	result, err := client.FetchParts(ctx, params)
 	if err != nil {
 		log.Printf("[FetchAndStoreParts] ERROR: Failed to fetch parts from %s: %v", client.GetName(), err)
 		return nil, fmt.Errorf("failed to fetch parts from %s: %w", client.GetName(), err)
 	}
+	fetchedParts := result.Parts
+	run.FetchedCount = len(fetchedParts)
+	run.Complete = result.Complete
+	run.IncompleteReason = result.Reason
 
 	log.Printf("[FetchAndStoreParts] Fetched %d parts from %s", len(fetchedParts), client.GetName())
+	if result.Truncated() {
+		log.Printf("[FetchAndStoreParts] Result from %s is incomplete: %s", client.GetName(), result.Reason)
+	}
 
 	if len(fetchedParts) > 0 {
 		log.Printf("[FetchAndStoreParts] First part example: ID=%s, Name=%s, Type=%s",
 			fetchedParts[0].ID, fetchedParts[0].Name, fetchedParts[0].TypeName)
 	}
 
+	existingParts, updatedParts, err := s.refreshExistingParts(siteID, fetchedParts)
+	if err != nil {
+		return nil, err
+	}
+	run.UpdatedCount = len(updatedParts)
+
+	// Parts missing from an incomplete result may still be listed, so only age out after complete fetches
+	if result.Complete {
+		run.StaleCount = s.updateLifecycle(siteID, params.ProfileID, fetchStartedAt)
+	} else {
+		log.Printf("[FetchAndStoreParts] Skipping missing and removed checks for site ID %d, result is incomplete", siteID)
+	}
+
+	storedParts, failedParts := s.insertNewParts(fetchedParts, existingParts)
+	run.NewCount = len(storedParts)
+	run.ErrorCount = len(failedParts)
+	siteclients.ReportPartsStored(ctx, len(storedParts))
+	log.Printf("[FetchAndStoreParts] Successfully stored %d new parts, skipped %d duplicates, %d errors out of %d fetched",
+		len(storedParts), len(existingParts), len(failedParts), len(fetchedParts))
+
+	// Record which search profile found these parts
+	if params.ProfileID != 0 {
+		partIDs := make([]string, len(fetchedParts))
+		for i, part := range fetchedParts {
+			partIDs[i] = part.ID
+		}
+		if err := s.sqlClient.AddPartProfileMatches(partIDs, siteID, params.ProfileID); err != nil {
+			log.Printf("[FetchAndStoreParts] WARNING: Failed to record matches for search profile %d: %v", params.ProfileID, err)
+		}
+	}
+
+	return storedParts, nil
+}
+
+// refreshExistingParts marks the fetched parts that are already stored as seen, reviving the
+// missing and removed ones, and updates the ones the seller edited. It returns the part IDs of
+// the stored parts and of the updated ones.
+func (s *PartsService) refreshExistingParts(siteID int, fetchedParts []siteclients.Part) (map[string]bool, map[string]bool, error) {
 	// Check which parts already exist in the database
 	log.Printf("[FetchAndStoreParts] Checking for existing parts in database")
 	partIDs := make([]string, len(fetchedParts))
@@ -77,39 +208,38 @@ func (s *PartsService) FetchAndStoreParts(ctx context.Context, siteID int, param
 	existingParts, err := s.sqlClient.GetExistingPartIDs(partIDs, siteID)
 	if err != nil {
 		log.Printf("[FetchAndStoreParts] ERROR: Failed to check existing parts: %v", err)
-		return nil, fmt.Errorf("failed to check existing parts: %w", err)
+		return nil, nil, fmt.Errorf("failed to check existing parts: %w", err)
 	}
 
-	duplicateCount := len(existingParts)
-	log.Printf("[FetchAndStoreParts] Found %d existing parts, %d new parts to insert", duplicateCount, len(fetchedParts)-duplicateCount)
+	log.Printf("[FetchAndStoreParts] Found %d existing parts, %d new parts to insert", len(existingParts), len(fetchedParts)-len(existingParts))
+	if len(existingParts) == 0 {
+		return existingParts, map[string]bool{}, nil
+	}
 
 	// Update last_seen for existing parts
-	if len(existingParts) > 0 {
-		existingPartIDs := make([]string, 0, len(existingParts))
-		for partID := range existingParts {
-			existingPartIDs = append(existingPartIDs, partID)
-		}
-		log.Printf("[FetchAndStoreParts] Updating last_seen for %d existing parts", len(existingPartIDs))
-		if err := s.sqlClient.UpdateLastSeen(existingPartIDs, siteID); err != nil {
-			log.Printf("[FetchAndStoreParts] WARNING: Failed to update last_seen: %v", err)
-			// Don't fail the entire operation, just log the error
-		}
+	existingPartIDs := make([]string, 0, len(existingParts))
+	for partID := range existingParts {
+		existingPartIDs = append(existingPartIDs, partID)
+	}
+	if _, err := s.sqlClient.ReviveParts(existingPartIDs, siteID); err != nil {
+		log.Printf("[FetchAndStoreParts] WARNING: Failed to revive parts: %v", err)
 	}
 
-	// Delete stale parts (last seen more than 3 days ago)
-	olderThan := time.Now().AddDate(0, 0, -3)
-	deletedCount, err := s.sqlClient.DeleteStaleParts(siteID, olderThan)
-	if err != nil {
-		log.Printf("[FetchAndStoreParts] WARNING: Failed to delete stale parts: %v", err)
-	} else {
-		log.Printf("[FetchAndStoreParts] Deleted %d stale parts for site ID %d", deletedCount, siteID)
+	log.Printf("[FetchAndStoreParts] Updating last_seen for %d existing parts", len(existingPartIDs))
+	if err := s.sqlClient.UpdateLastSeen(existingPartIDs, siteID); err != nil {
+		log.Printf("[FetchAndStoreParts] WARNING: Failed to update last_seen: %v", err)
+		// Don't fail the entire operation, just log the error
 	}
 
-	// Store only new parts in the database
+	return existingParts, s.updateChangedParts(siteID, fetchedParts, existingPartIDs), nil
+}
+
+// insertNewParts stores the fetched parts that are not stored yet. It returns the new parts and
+// the error of every part that could not be stored by part ID.
+func (s *PartsService) insertNewParts(fetchedParts []siteclients.Part, existingParts map[string]bool) ([]Part, map[string]error) {
 	log.Printf("[FetchAndStoreParts] Starting to store new parts in database")
-	storedParts := make([]Part, 0, len(fetchedParts)-duplicateCount)
-	errorCount := 0
-	insertedCount := 0
+	storedParts := make([]Part, 0, len(fetchedParts)-len(existingParts))
+	failedParts := make(map[string]error)
 
 	for i, part := range fetchedParts {
 		// Skip if part already exists
@@ -121,36 +251,226 @@ func (s *PartsService) FetchAndStoreParts(ctx context.Context, siteID int, param
 		}
 
 		// Insert the new part
+		displayPrice, parsedPrice := normalizePrice(part)
 		storedPart, err := s.sqlClient.CreatePart(
 			part.ID,
 			part.Description,
 			part.TypeName,
 			part.Name,
-			part.ImageBase64,
+			s.storeImages(part),
 			part.URL,
 			part.SiteID,
-			part.Price,
+			displayPrice,
+			parsedPrice,
 			part.CreationDate,
 		)
 		if err != nil {
 			// Log the error but continue with other parts
-			if errorCount < 3 { // Log details for first 3 errors only
+			if len(failedParts) < 3 { // Log details for first 3 errors only
 				log.Printf("[FetchAndStoreParts] Warning: failed to store part %s (index %d): %v", part.ID, i, err)
 			}
-			errorCount++
+			failedParts[part.ID] = err
 			continue
 		}
+		s.linkRelist(storedPart)
 		storedParts = append(storedParts, *storedPart)
-		insertedCount++
-		if insertedCount <= 3 { // Log first 3 successful stores
+		if len(storedParts) <= 3 { // Log first 3 successful stores
 			log.Printf("[FetchAndStoreParts] Successfully stored part: ID=%s, DB_ID=%d, Name=%s", part.ID, storedPart.ID, storedPart.Name)
 		}
 	}
+	return storedParts, failedParts
+}
 
-	log.Printf("[FetchAndStoreParts] Successfully stored %d new parts, skipped %d duplicates, %d errors out of %d fetched",
-		len(storedParts), duplicateCount, errorCount, len(fetchedParts))
+// updateLifecycle marks the parts a search profile no longer finds as missing, and the parts
+// of the site not seen within its grace period as removed. Without a profile there is no
+// way to tell which parts the fetch should have found, so only the grace period applies.
+// It returns how many parts went missing or were removed.
+func (s *PartsService) updateLifecycle(siteID, profileID int, fetchStartedAt time.Time) int {
+	staleCount := 0
+	if profileID != 0 {
+		missingCount, err := s.sqlClient.MarkMissingParts(siteID, profileID, fetchStartedAt)
+		if err != nil {
+			log.Printf("[FetchAndStoreParts] WARNING: Failed to mark missing parts: %v", err)
+		} else if missingCount > 0 {
+			log.Printf("[FetchAndStoreParts] Marked %d parts of search profile %d as missing", missingCount, profileID)
+		}
+		staleCount += int(missingCount)
+	}
 
-	return storedParts, nil
+	gracePeriodHours := defaultGracePeriodHours
+	if site, err := s.sqlClient.GetSiteByID(siteID); err == nil && site.GracePeriodHours > 0 {
+		gracePeriodHours = site.GracePeriodHours
+	}
+
+	notSeenSince := time.Now().Add(-time.Duration(gracePeriodHours) * time.Hour)
+	removedCount, err := s.sqlClient.RemoveStaleParts(siteID, notSeenSince)
+	if err != nil {
+		log.Printf("[FetchAndStoreParts] WARNING: Failed to remove stale parts: %v", err)
+	} else {
+		log.Printf("[FetchAndStoreParts] Removed %d stale parts for site ID %d", removedCount, siteID)
+		staleCount += int(removedCount)
+	}
+	return staleCount
+}
+
+// relistWindow is how long after its removal a listing can be relisted under a new ID
+const relistWindow = 30 * 24 * time.Hour
+
+// linkRelist links a new part to a recently missing or removed part with the same name,
+// as sellers often take down a listing and post it again
+func (s *PartsService) linkRelist(part *Part) {
+	relistOf, err := s.sqlClient.FindRelistedPart(part.SiteID, part.Name, time.Now().Add(-relistWindow), part.ID)
+	if err != nil || relistOf == 0 {
+		return
+	}
+
+	if err := s.sqlClient.SetRelistOf(part.ID, relistOf); err != nil {
+		return
+	}
+	part.RelistOf = &relistOf
+	now := time.Now()
+	part.RelistedAt = &now
+	log.Printf("[FetchAndStoreParts] Part %s (DB_ID=%d) looks like a relist of part %d", part.PartID, part.ID, relistOf)
+}
+
+// updateChangedParts compares the content hash of refetched parts with the stored one and
+// updates the parts the seller edited, recording the changed fields and price changes.
+// It returns the part IDs of the updated parts.
+func (s *PartsService) updateChangedParts(siteID int, fetchedParts []siteclients.Part, existingPartIDs []string) map[string]bool {
+	updatedParts := make(map[string]bool)
+	storedParts, err := s.sqlClient.GetStoredParts(existingPartIDs, siteID)
+	if err != nil {
+		log.Printf("[FetchAndStoreParts] WARNING: Failed to load stored parts: %v", err)
+		return updatedParts
+	}
+
+	priceChangeCount := 0
+	for _, part := range fetchedParts {
+		stored, exists := storedParts[part.ID]
+		if !exists {
+			continue
+		}
+
+		// A failed image download is not an edit, keep the images we have. The same goes for a
+		// gallery of which some photos failed or whose page was not loaded.
+		gallery := s.galleryOf(part)
+		keepGallery := len(gallery) == 0 || (part.GalleryIncomplete && len(stored.Images) > 0)
+		if keepGallery {
+			gallery = stored.Images
+		}
+
+		displayPrice, parsedPrice := normalizePrice(part)
+		content := newPartContent(part.Name, part.Description, part.TypeName, gallery, part.URL, displayPrice)
+		if content.hash() == stored.ContentHash {
+			continue
+		}
+
+		if !keepGallery && !sameGallery(gallery, stored.Images) {
+			if storedGallery := s.storeImages(part); len(storedGallery) > 0 {
+				gallery = storedGallery
+			} else {
+				gallery = stored.Images
+			}
+			content = newPartContent(part.Name, part.Description, part.TypeName, gallery, part.URL, displayPrice)
+		}
+
+		changes := content.diff(storedPartContent(&stored))
+		pricePoint := priceChanged(&stored, displayPrice, parsedPrice)
+		_, err := s.sqlClient.UpdatePart(&stored, part.ID, part.Description, part.TypeName, part.Name,
+			gallery, part.URL, siteID, displayPrice, parsedPrice, changes, pricePoint)
+		if err != nil {
+			log.Printf("[FetchAndStoreParts] WARNING: Failed to update part %s: %v", part.ID, err)
+			continue
+		}
+		updatedParts[part.ID] = true
+		if pricePoint {
+			priceChangeCount++
+		}
+		if len(updatedParts) <= 3 {
+			log.Printf("[FetchAndStoreParts] Part %s changed: %d fields", part.ID, len(changes))
+		}
+	}
+
+	log.Printf("[FetchAndStoreParts] Updated %d changed parts (%d price changes) for site ID %d", len(updatedParts), priceChangeCount, siteID)
+	return updatedParts
+}
+
+// galleryOf returns the gallery of a fetched part by the hashes its images will be stored under,
+// without storing them. Images that are not valid base64 or reference a hash the store does not
+// hold are left out, as storeImages leaves them out.
+func (s *PartsService) galleryOf(part siteclients.Part) []PartImage {
+	gallery := make([]PartImage, 0, len(part.Gallery()))
+	for _, image := range part.Gallery() {
+		hash := image.Hash
+		if hash == "" {
+			var err error
+			if hash, err = images.HashBase64(image.Base64); err != nil || hash == "" {
+				continue
+			}
+		} else if !s.images.Has(hash) {
+			continue
+		}
+		gallery = append(gallery, NewPartImage(len(gallery), hash, image.SourceURL))
+	}
+	return gallery
+}
+
+// sameGallery reports whether two galleries hold the same images in the same order
+func sameGallery(a, b []PartImage) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Hash != b[i].Hash {
+			return false
+		}
+	}
+	return true
+}
+
+// storeImages puts the images of a fetched part into the image store and returns its gallery.
+// Images that cannot be stored, or that reference a hash the store does not hold, are left out.
+func (s *PartsService) storeImages(part siteclients.Part) []PartImage {
+	gallery := make([]PartImage, 0, len(part.Gallery()))
+	for _, image := range part.Gallery() {
+		if image.Hash != "" {
+			if !s.images.Has(image.Hash) {
+				log.Printf("[FetchAndStoreParts] WARNING: Image %s of part %s is not in the image store", image.Hash, part.ID)
+				continue
+			}
+			gallery = append(gallery, NewPartImage(len(gallery), image.Hash, image.SourceURL))
+			continue
+		}
+		hash, err := s.images.PutBase64(image.Base64)
+		if err != nil {
+			log.Printf("[FetchAndStoreParts] WARNING: Failed to store image of part %s: %v", part.ID, err)
+			continue
+		}
+		gallery = append(gallery, NewPartImage(len(gallery), hash, image.SourceURL))
+	}
+	return gallery
+}
+
+// priceChanged compares the parsed amounts, falling back to the text when either has no amount
+func priceChanged(stored *Part, displayPrice string, parsedPrice prices.Price) bool {
+	if stored.PriceAmount != nil && parsedPrice.Amount != nil {
+		return *stored.PriceAmount != *parsedPrice.Amount || stored.PriceCurrency != parsedPrice.Currency
+	}
+	if stored.PriceAmount != nil || parsedPrice.Amount != nil {
+		return true
+	}
+	return stored.Price != displayPrice
+}
+
+// normalizePrice returns the price text to display and its structured form for a fetched part
+func normalizePrice(part siteclients.Part) (string, prices.Price) {
+	parsedPrice := prices.Parse(part.Price, part.Currency)
+	if part.ShippingCost != "" {
+		if shippingCost, ok := prices.ParseAmount(part.ShippingCost); ok {
+			parsedPrice.ShippingCost = &shippingCost
+		}
+	}
+	return prices.Display(part.Price, part.Currency), parsedPrice
 }
 
 // FetchPartsOnly fetches parts from a site client without storing them
@@ -162,14 +482,14 @@ func (s *PartsService) FetchPartsOnly(ctx context.Context, siteID int, params si
 
 	log.Printf("Fetching parts from %s (site ID: %d) without storing", client.GetName(), siteID)
 
-	parts, err := client.FetchParts(ctx, params)
+	result, err := client.FetchParts(ctx, params)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch parts from %s: %w", client.GetName(), err)
 	}
 
-	log.Printf("Fetched %d parts from %s", len(parts), client.GetName())
+	log.Printf("Fetched %d parts from %s (complete: %v)", len(result.Parts), client.GetName(), result.Complete)
 
-	return parts, nil
+	return result.Parts, nil
 }
 
 // GetPartsBySiteID retrieves all parts for a specific site from the database
@@ -194,10 +514,9 @@ func (s *PartsService) GetAllParts(limit, offset int) ([]Part, error) {
 }
 
 // GetFilteredParts retrieves filtered parts from the database
-func (s *PartsService) GetFilteredParts(limit, offset int, typeFilter string, siteIDs []int, newerThan time.Time, search string, sortBy string, sortDesc bool) ([]Part, error) {
-	log.Printf("[GetFilteredParts] Called with limit=%d, offset=%d, typeFilter=%s, siteIDs=%v, newerThan=%v, search=%s, sortBy=%s, sortDesc=%v",
-		limit, offset, typeFilter, siteIDs, newerThan, search, sortBy, sortDesc)
-	parts, err := s.sqlClient.GetFilteredParts(limit, offset, typeFilter, siteIDs, newerThan, search, sortBy, sortDesc)
+func (s *PartsService) GetFilteredParts(limit, offset int, filter PartFilter) ([]Part, error) {
+	log.Printf("[GetFilteredParts] Called with limit=%d, offset=%d, filter=%+v", limit, offset, filter)
+	parts, err := s.sqlClient.GetFilteredParts(limit, offset, filter)
 	if err != nil {
 		log.Printf("[GetFilteredParts] ERROR: %v", err)
 		return nil, err
@@ -206,6 +525,26 @@ func (s *PartsService) GetFilteredParts(limit, offset int, typeFilter string, si
 	return parts, nil
 }
 
+// GetPartsAfterID retrieves the filtered parts with a DB ID after afterID and up to upToID
+func (s *PartsService) GetPartsAfterID(afterID, upToID, limit int, filter PartFilter) ([]Part, error) {
+	parts, err := s.sqlClient.GetPartsAfterID(afterID, upToID, limit, filter)
+	if err != nil {
+		log.Printf("[GetPartsAfterID] ERROR: %v", err)
+		return nil, err
+	}
+	return parts, nil
+}
+
+// GetLatestPartID returns the DB ID of the last stored part
+func (s *PartsService) GetLatestPartID() (int, error) {
+	id, err := s.sqlClient.GetLatestPartID()
+	if err != nil {
+		log.Printf("[GetLatestPartID] ERROR: %v", err)
+		return 0, err
+	}
+	return id, nil
+}
+
 func (s *PartsService) GetTotalPartsCount() (int, error) {
 	count, err := s.sqlClient.GetTotalPartsCount()
 	if err != nil {
@@ -216,20 +555,54 @@ func (s *PartsService) GetTotalPartsCount() (int, error) {
 	return count, nil
 }
 
-func (s *PartsService) GetFilteredPartsCount(typeFilter string, siteIDs []int, newerThan time.Time, search string) (int, error) {
-	count, err := s.sqlClient.GetFilteredPartsCount(typeFilter, siteIDs, newerThan, search)
+func (s *PartsService) GetFilteredPartsCount(filter PartFilter) (int, error) {
+	count, err := s.sqlClient.GetFilteredPartsCount(filter)
 	if err != nil {
 		log.Printf("[GetFilteredPartsCount] ERROR: %v", err)
 		return 0, err
 	}
-	log.Printf("[GetFilteredPartsCount] Total count: %d (typeFilter=%s, siteIDs=%v, newerThan=%v, search=%s)",
-		count, typeFilter, siteIDs, newerThan, search)
+	log.Printf("[GetFilteredPartsCount] Total count: %d (filter=%+v)", count, filter)
 	return count, nil
 }
 
-// GetPartByID retrieves a specific part by its ID
+// GetPartByID retrieves a specific part by its ID, including the search profiles that matched it
+// and its gallery
 func (s *PartsService) GetPartByID(id int) (*Part, error) {
-	return s.sqlClient.GetPartByID(id)
+	part, err := s.sqlClient.GetPartByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	profileIDs, err := s.sqlClient.GetPartProfileIDs(id)
+	if err != nil {
+		log.Printf("[GetPartByID] WARNING: Failed to get search profiles for part %d: %v", id, err)
+	} else {
+		part.ProfileIDs = profileIDs
+	}
+
+	partImages, err := s.sqlClient.GetPartImages(id)
+	if err != nil {
+		log.Printf("[GetPartByID] WARNING: Failed to get images for part %d: %v", id, err)
+	} else {
+		part.Images = partImages
+	}
+	return part, nil
+}
+
+// GetPriceHistory retrieves the observed prices of a part, oldest first
+func (s *PartsService) GetPriceHistory(partID int) ([]PricePoint, error) {
+	if _, err := s.sqlClient.GetPartByID(partID); err != nil {
+		return nil, err
+	}
+	return s.sqlClient.GetPriceHistory(partID)
+}
+
+// GetPartChanges retrieves the change log of a part, newest first
+func (s *PartsService) GetPartChanges(partID int) ([]PartChange, error) {
+	if _, err := s.sqlClient.GetPartByID(partID); err != nil {
+		return nil, err
+	}
+	return s.sqlClient.GetPartChanges(partID)
 }
 
 // DeletePartsBySiteID deletes all parts for a specific site
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dsmpartsfinder-api/images"
+	. "dsmpartsfinder-api/models"
+	"dsmpartsfinder-api/prices"
+	"dsmpartsfinder-api/siteclients"
+)
+
+// storeTestImage stores a one pixel PNG of the given gray and returns its hash
+func storeTestImage(t *testing.T, store *images.Store, gray uint8) string {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 1, 1))
+	img.SetGray(0, 0, color.Gray{Y: gray})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	hash, err := store.Put(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	return hash
+}
+
+func TestUpdateChangedPartsKeepsGalleryOnPartialFetch(t *testing.T) {
+	sqlClient := newTestSQLClient(t)
+	store, err := images.NewStore(filepath.Join(t.TempDir(), "images"))
+	if err != nil {
+		t.Fatalf("images.NewStore: %v", err)
+	}
+	service := NewPartsService(sqlClient, nil, store)
+
+	const siteID = 1
+	cover, second := storeTestImage(t, store, 0), storeTestImage(t, store, 255)
+	gallery := []PartImage{
+		NewPartImage(0, cover, "https://img.example/1.jpg"),
+		NewPartImage(1, second, "https://img.example/2.jpg"),
+	}
+	created, err := sqlClient.CreatePart("p1", "Used turbo", "Turbo", "TD05H", gallery, "https://example.com/p1", siteID, "100 €", prices.Parse("100 €", "EUR"), time.Now())
+	if err != nil {
+		t.Fatalf("CreatePart: %v", err)
+	}
+
+	// The second photo failed, only the cover came through
+	fetched := siteclients.Part{
+		ID: "p1", Description: "Used turbo", TypeName: "Turbo", Name: "TD05H",
+		Images:            []siteclients.Image{{SourceURL: "https://img.example/1.jpg", Hash: cover}},
+		URL:               "https://example.com/p1",
+		SiteID:            siteID,
+		Price:             "100 €",
+		Currency:          "EUR",
+		GalleryIncomplete: true,
+	}
+	if updated := service.updateChangedParts(siteID, []siteclients.Part{fetched}, []string{"p1"}); len(updated) != 0 {
+		t.Errorf("updated %v, want no update for a partial gallery", updated)
+	}
+
+	// An edit with a partial gallery is stored, the gallery is kept
+	fetched.Description = "Used turbo, rebuilt"
+	if updated := service.updateChangedParts(siteID, []siteclients.Part{fetched}, []string{"p1"}); !updated["p1"] {
+		t.Errorf("updated %v, want p1", updated)
+	}
+	stored, err := sqlClient.GetPartImages(created.ID)
+	if err != nil {
+		t.Fatalf("GetPartImages: %v", err)
+	}
+	if !sameGallery(stored, gallery) {
+		t.Errorf("gallery = %+v, want the stored gallery %+v", stored, gallery)
+	}
+	changes, err := sqlClient.GetPartChanges(created.ID)
+	if err != nil {
+		t.Fatalf("GetPartChanges: %v", err)
+	}
+	for _, change := range changes {
+		if change.Field != "description" {
+			t.Errorf("logged change of %s, want only the description", change.Field)
+		}
+	}
+}
+
+func TestSiteFailingIsPublishedOncePerOutage(t *testing.T) {
+	sqlClient := newTestSQLClient(t)
+	service := NewPartsService(sqlClient, nil, nil)
+
+	const siteID = 1
+	finishRun := func(profileID int, status string) {
+		t.Helper()
+		run, err := sqlClient.CreateFetchRun(siteID, profileID, "scheduled", nil)
+		if err != nil {
+			t.Fatalf("CreateFetchRun: %v", err)
+		}
+		run.Status = status
+		if status == FetchRunFailed {
+			run.Error = "site is down"
+		}
+		if err := sqlClient.FinishFetchRun(run); err != nil {
+			t.Fatalf("FinishFetchRun: %v", err)
+		}
+		if status == FetchRunFailed {
+			service.publishSiteFailing(run)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		profileID int
+		status    string
+		want      int
+	}{
+		{"first failure", 1, FetchRunFailed, 1},
+		{"another profile fails", 2, FetchRunFailed, 1},
+		{"a third profile fails", 3, FetchRunFailed, 1},
+		{"the site recovers", 1, FetchRunSucceeded, 1},
+		{"failing again", 2, FetchRunFailed, 2},
+		{"still failing", 3, FetchRunFailed, 2},
+	}
+	for _, tt := range tests {
+		finishRun(tt.profileID, tt.status)
+		count, err := sqlClient.GetEventsCount(EventFilter{Type: EventSiteFailing, SiteID: siteID})
+		if err != nil {
+			t.Fatalf("GetEventsCount: %v", err)
+		}
+		if count != tt.want {
+			t.Errorf("%s: %d site failing events, want %d", tt.name, count, tt.want)
+		}
+	}
+}
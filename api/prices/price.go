@@ -0,0 +1,221 @@
+package prices
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Price is a listing price normalized from the free text shown on a site
+type Price struct {
+	Amount       *int64 // Amount in minor units (cents), nil when the text has no number
+	Currency     string // ISO 4217 currency code
+	Negotiable   bool   // "VB", "OBO", "onderhandelbaar" and friends
+	Free         bool   // Giveaways such as "Zu verschenken"
+	ShippingCost *int64 // Shipping cost in minor units, nil when unknown
+}
+
+// currencyMarkers maps currency symbols and codes to ISO codes, longest markers first
+var currencyMarkers = []struct {
+	marker string
+	code   string
+}{
+	{"eur", "EUR"},
+	{"usd", "USD"},
+	{"gbp", "GBP"},
+	{"chf", "CHF"},
+	{"us$", "USD"},
+	{"€", "EUR"},
+	{"£", "GBP"},
+	{"$", "USD"},
+}
+
+// currencySymbols is used to display bare amounts
+var currencySymbols = map[string]string{
+	"EUR": "€",
+	"GBP": "£",
+	"USD": "$",
+	"CHF": "CHF",
+}
+
+var (
+	numberPattern       = regexp.MustCompile(`\d[\d.,' ]*`)
+	freeShippingPattern = regexp.MustCompile(`\b(?:gratis|kostenlose[rn]?|kostenfreie[rn]?|free)\s+(?:versand|shipping|verzending|postage|delivery|porto|p&p)|\b(?:versand|shipping|verzending|postage|porto)\s*:?\s*(?:gratis|kostenlos|kostenfrei|free)\b`)
+	shippingPattern     = regexp.MustCompile(`(?i)(?:\+|zzgl\.?|plus)?\s*([\d.,]+)\s*(?:€|eur)?\s*(?:versand|shipping|verzending|porto)|(?:versand|shipping|verzending|porto)\s*:?\s*(?:€|eur)?\s*([\d.,]+)`)
+	negotiableMarkers   = []string{"vb", "verhandlungsbasis", "obo", "o.b.o", "or best offer", "onderhandelbaar", "n.o.t.k", "notk", "bieden", "negotiable", "nego"}
+	freeMarkers         = []string{"zu verschenken", "verschenken", "gratis", "kostenlos", "umsonst", "free", "gratis af te halen"}
+)
+
+// Parse normalizes a free text price. currencyHint is the ISO currency a client knows
+// the price is in and is used when the text itself carries no currency marker.
+func Parse(raw, currencyHint string) Price {
+	price := Price{Currency: strings.ToUpper(currencyHint)}
+	text := strings.ToLower(strings.TrimSpace(raw))
+	if text == "" {
+		return price
+	}
+
+	for _, marker := range currencyMarkers {
+		if strings.Contains(text, marker.marker) {
+			price.Currency = marker.code
+			break
+		}
+	}
+	if price.Currency == "" {
+		price.Currency = "EUR"
+	}
+
+	// Split off shipping information before looking for the item price. Free shipping goes first,
+	// so "€ 50 gratis verzending" is not taken for a giveaway.
+	if match := freeShippingPattern.FindStringIndex(text); match != nil {
+		zero := int64(0)
+		price.ShippingCost = &zero
+		text = text[:match[0]] + " " + text[match[1]:]
+	} else if match := shippingPattern.FindStringSubmatchIndex(text); match != nil {
+		amountText := ""
+		if match[2] >= 0 {
+			amountText = text[match[2]:match[3]]
+		} else if match[4] >= 0 {
+			amountText = text[match[4]:match[5]]
+		}
+		if amount, ok := parseAmount(amountText); ok {
+			price.ShippingCost = &amount
+		}
+		text = text[:match[0]] + " " + text[match[1]:]
+	}
+
+	for _, marker := range negotiableMarkers {
+		if containsWord(text, marker) {
+			price.Negotiable = true
+			break
+		}
+	}
+
+	if amountText := numberPattern.FindString(text); amountText != "" {
+		if amount, ok := parseAmount(amountText); ok {
+			price.Amount = &amount
+			return price
+		}
+	}
+
+	// Only a price without an amount is a giveaway, "50 € free pickup" still costs 50
+	for _, marker := range freeMarkers {
+		if containsWord(text, marker) {
+			price.Free = true
+			price.Negotiable = false
+			zero := int64(0)
+			price.Amount = &zero
+			break
+		}
+	}
+
+	return price
+}
+
+// Display returns the price text to show, prefixing bare amounts with the currency symbol
+func Display(raw, currencyHint string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || currencyHint == "" {
+		return raw
+	}
+
+	lower := strings.ToLower(raw)
+	for _, marker := range currencyMarkers {
+		if strings.Contains(lower, marker.marker) {
+			return raw
+		}
+	}
+
+	symbol, ok := currencySymbols[strings.ToUpper(currencyHint)]
+	if !ok {
+		return raw + " " + strings.ToUpper(currencyHint)
+	}
+	return symbol + " " + raw
+}
+
+// ParseAmount converts a decimal amount in major units ("12,50", "1.250") into minor units
+func ParseAmount(text string) (int64, bool) {
+	return parseAmount(text)
+}
+
+// parseAmount handles both German ("1.250,50") and English ("1,250.50") number formats
+func parseAmount(text string) (int64, bool) {
+	text = strings.NewReplacer(" ", "", "'", "").Replace(strings.TrimSpace(text))
+	text = strings.TrimRight(text, ".,")
+	if text == "" {
+		return 0, false
+	}
+
+	lastDot := strings.LastIndex(text, ".")
+	lastComma := strings.LastIndex(text, ",")
+
+	decimalSep := -1
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		// Both present: the last one is the decimal separator
+		if lastDot > lastComma {
+			decimalSep = lastDot
+		} else {
+			decimalSep = lastComma
+		}
+	case lastDot >= 0 || lastComma >= 0:
+		sep := lastDot
+		sepChar := "."
+		if lastComma >= 0 {
+			sep = lastComma
+			sepChar = ","
+		}
+		// Repeated separators, or one followed by exactly three digits, group thousands
+		if strings.Count(text, sepChar) == 1 && len(text)-sep-1 != 3 {
+			decimalSep = sep
+		}
+	}
+
+	whole, fraction := text, ""
+	if decimalSep >= 0 {
+		whole, fraction = text[:decimalSep], text[decimalSep+1:]
+	}
+	whole = strings.NewReplacer(".", "", ",", "").Replace(whole)
+	if whole == "" {
+		whole = "0"
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	var cents int64
+	if fraction != "" {
+		if len(fraction) == 1 {
+			fraction += "0"
+		}
+		cents, err = strconv.ParseInt(fraction[:2], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+	}
+
+	return units*100 + cents, true
+}
+
+// containsWord reports whether marker appears in text as a whole word
+func containsWord(text, marker string) bool {
+	index := 0
+	for {
+		found := strings.Index(text[index:], marker)
+		if found < 0 {
+			return false
+		}
+		start := index + found
+		end := start + len(marker)
+		if (start == 0 || !isWordChar(text[start-1])) && (end == len(text) || !isWordChar(text[end])) {
+			return true
+		}
+		index = start + 1
+	}
+}
+
+func isWordChar(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9'
+}
@@ -0,0 +1,127 @@
+package prices
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cents := func(amount int64) *int64 { return &amount }
+
+	tests := []struct {
+		raw          string
+		hint         string
+		amount       *int64
+		currency     string
+		negotiable   bool
+		free         bool
+		shippingCost *int64
+	}{
+		{raw: "", hint: "EUR", currency: "EUR"},
+		{raw: "1.250 €", amount: cents(125000), currency: "EUR"},
+		{raw: "€ 12,50", amount: cents(1250), currency: "EUR"},
+		{raw: "£40", amount: cents(4000), currency: "GBP"},
+		{raw: "$1,250.99", amount: cents(125099), currency: "USD"},
+		{raw: "250 CHF", amount: cents(25000), currency: "CHF"},
+		{raw: "300", hint: "gbp", amount: cents(30000), currency: "GBP"},
+		{raw: "300", amount: cents(30000), currency: "EUR"},
+		{raw: "150 € VB", amount: cents(15000), currency: "EUR", negotiable: true},
+		{raw: "VB", currency: "EUR", negotiable: true},
+		{raw: "$200 OBO", amount: cents(20000), currency: "USD", negotiable: true},
+		{raw: "Zu verschenken", amount: cents(0), currency: "EUR", free: true},
+		{raw: "Gratis af te halen", amount: cents(0), currency: "EUR", free: true},
+		{raw: "Free", hint: "GBP", amount: cents(0), currency: "GBP", free: true},
+		{raw: "80 € + 6,99 € Versand", amount: cents(8000), currency: "EUR", shippingCost: cents(699)},
+		{raw: "£25 plus 4.50 shipping", amount: cents(2500), currency: "GBP", shippingCost: cents(450)},
+		{raw: "€ 50 gratis verzending", amount: cents(5000), currency: "EUR", shippingCost: cents(0)},
+		{raw: "£40 free postage", amount: cents(4000), currency: "GBP", shippingCost: cents(0)},
+		{raw: "60 € VB, Versand kostenlos", amount: cents(6000), currency: "EUR", negotiable: true, shippingCost: cents(0)},
+		{raw: "Gratis, free shipping", amount: cents(0), currency: "EUR", free: true, shippingCost: cents(0)},
+		{raw: "$75 free pickup", amount: cents(7500), currency: "USD"},
+		{raw: "Preis auf Anfrage", currency: "EUR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got := Parse(tt.raw, tt.hint)
+			if !equalAmount(got.Amount, tt.amount) {
+				t.Errorf("Amount = %s, want %s", formatAmount(got.Amount), formatAmount(tt.amount))
+			}
+			if got.Currency != tt.currency {
+				t.Errorf("Currency = %q, want %q", got.Currency, tt.currency)
+			}
+			if got.Negotiable != tt.negotiable {
+				t.Errorf("Negotiable = %v, want %v", got.Negotiable, tt.negotiable)
+			}
+			if got.Free != tt.free {
+				t.Errorf("Free = %v, want %v", got.Free, tt.free)
+			}
+			if !equalAmount(got.ShippingCost, tt.shippingCost) {
+				t.Errorf("ShippingCost = %s, want %s", formatAmount(got.ShippingCost), formatAmount(tt.shippingCost))
+			}
+		})
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		text string
+		want int64
+		ok   bool
+	}{
+		{"12", 1200, true},
+		{"12,50", 1250, true},
+		{"12.50", 1250, true},
+		{"12,5", 1250, true},
+		{"1.250", 125000, true},
+		{"1,250", 125000, true},
+		{"1.250,50", 125050, true},
+		{"1,250.50", 125050, true},
+		{"1.250.000", 125000000, true},
+		{"1'250", 125000, true},
+		{"1 250,00", 125000, true},
+		{"50,-", 5000, true},
+		{"50.", 5000, true},
+		{",99", 99, true},
+		{"", 0, false},
+		{"abc", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseAmount(tt.text)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d, %v", tt.text, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	tests := []struct {
+		raw, hint, want string
+	}{
+		{"150", "EUR", "€ 150"},
+		{"150 €", "EUR", "150 €"},
+		{"150", "", "150"},
+		{"150", "SEK", "150 SEK"},
+		{"  ", "EUR", ""},
+	}
+	for _, tt := range tests {
+		if got := Display(tt.raw, tt.hint); got != tt.want {
+			t.Errorf("Display(%q, %q) = %q, want %q", tt.raw, tt.hint, got, tt.want)
+		}
+	}
+}
+
+func equalAmount(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func formatAmount(amount *int64) string {
+	if amount == nil {
+		return "nil"
+	}
+	return strconv.FormatInt(*amount, 10)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"dsmpartsfinder-api/siteclients"
+)
+
+// progressBuffer is how many events a subscriber can fall behind before events are dropped
+const progressBuffer = 64
+
+// ProgressHub fans the progress events of all fetches out to the subscribers of
+// /api/events/fetch. A subscriber that does not keep up misses events instead of slowing
+// down the fetches; that is logged once when it falls behind and once when it leaves.
+type ProgressHub struct {
+	mu          sync.Mutex
+	subscribers map[chan siteclients.ProgressEvent]*progressSubscriber
+}
+
+// progressSubscriber counts the events a subscriber missed
+type progressSubscriber struct {
+	dropped int
+}
+
+// NewProgressHub creates a new progress hub
+func NewProgressHub() *ProgressHub {
+	return &ProgressHub{
+		subscribers: make(map[chan siteclients.ProgressEvent]*progressSubscriber),
+	}
+}
+
+// Publish hands an event to every subscriber without blocking
+func (h *ProgressHub) Publish(event siteclients.ProgressEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for events, subscriber := range h.subscribers {
+		select {
+		case events <- event:
+		default:
+			if subscriber.dropped == 0 {
+				log.Printf("[ProgressHub] A subscriber fell behind at the %s event of site %d, dropping the events it misses", event.Type, event.SiteID)
+			}
+			subscriber.dropped++
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every published event and a function to unsubscribe
+func (h *ProgressHub) Subscribe() (<-chan siteclients.ProgressEvent, func()) {
+	events := make(chan siteclients.ProgressEvent, progressBuffer)
+
+	h.mu.Lock()
+	h.subscribers[events] = &progressSubscriber{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			subscriber := h.subscribers[events]
+			delete(h.subscribers, events)
+			h.mu.Unlock()
+
+			if subscriber.dropped > 0 {
+				log.Printf("[ProgressHub] Subscriber left after missing %d events", subscriber.dropped)
+			}
+		})
+	}
+	return events, unsubscribe
+}
@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireAdmin only lets requests through that send the admin token as a bearer token.
+// Without a configured token the endpoints are unavailable.
+func requireAdmin(adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminToken == "" {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":   "Admin access is not configured",
+				"details": "Set ADMIN_TOKEN to enable this endpoint",
+			})
+			return
+		}
+
+		token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid admin credentials",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,247 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"time"
+
+	. "dsmpartsfinder-api/models"
+	"dsmpartsfinder-api/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DigestSender builds and mails the daily and weekly digests
+type DigestSender interface {
+	Preview(frequency string, since time.Time) (notify.Mail, error)
+	Send(subscription *DigestSubscription) error
+}
+
+// isDigestFrequency reports whether a frequency is one of DigestFrequencies
+func isDigestFrequency(frequency string) bool {
+	for _, known := range DigestFrequencies {
+		if frequency == known {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDigestSubscriptionRequest checks the address and frequency of a digest subscription request
+func validateDigestSubscriptionRequest(req DigestSubscriptionRequest) string {
+	if _, err := mail.ParseAddress(req.Email); err != nil {
+		return "email must be an email address"
+	}
+	if !isDigestFrequency(req.Frequency) {
+		return "frequency must be \"daily\" or \"weekly\""
+	}
+	return ""
+}
+
+// registerDigestRoutes registers the digest endpoints. Subscriptions hold email addresses and can
+// send mail on demand, so they are behind the admin token; the preview is public.
+func registerDigestRoutes(api *gin.RouterGroup, sqlClient SQLClient, digests DigestSender, adminToken string) {
+	admin := api.Group("", requireAdmin(adminToken))
+
+	// GET /api/digests/preview - Render a digest without sending it
+	api.GET("/digests/preview", func(c *gin.Context) {
+		frequency := c.DefaultQuery("frequency", DigestDaily)
+		if !isDigestFrequency(frequency) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "frequency must be \"daily\" or \"weekly\"",
+			})
+			return
+		}
+
+		var since time.Time
+		if value := c.Query("since"); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   "Invalid since, expected an RFC 3339 time",
+					"details": err.Error(),
+				})
+				return
+			}
+			since = parsed
+		}
+
+		preview, err := digests.Preview(frequency, since)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to render digest",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		if c.Query("format") == "text" {
+			c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(preview.Text))
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(preview.HTML))
+	})
+
+	// GET /api/digest-subscriptions - Get all digest subscriptions
+	admin.GET("/digest-subscriptions", func(c *gin.Context) {
+		subscriptions, err := sqlClient.GetDigestSubscriptions(c.Query("frequency"), c.Query("enabled") == "true")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to query digest subscriptions",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    subscriptions,
+			"message": "Digest subscriptions retrieved successfully",
+			"total":   len(subscriptions),
+		})
+	})
+
+	// POST /api/digest-subscriptions - Create a digest subscription
+	admin.POST("/digest-subscriptions", func(c *gin.Context) {
+		var req DigestSubscriptionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+		if msg := validateDigestSubscriptionRequest(req); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": msg,
+			})
+			return
+		}
+
+		subscription, err := sqlClient.CreateDigestSubscription(req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to create digest subscription",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"data":    subscription,
+			"message": "Digest subscription created successfully",
+		})
+	})
+
+	// PUT /api/digest-subscriptions/:id - Update a digest subscription
+	admin.PUT("/digest-subscriptions/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid digest subscription ID",
+			})
+			return
+		}
+
+		var req DigestSubscriptionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+		if msg := validateDigestSubscriptionRequest(req); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": msg,
+			})
+			return
+		}
+
+		subscription, err := sqlClient.UpdateDigestSubscription(id, req)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Digest subscription not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to update digest subscription",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    subscription,
+			"message": "Digest subscription updated successfully",
+		})
+	})
+
+	// DELETE /api/digest-subscriptions/:id - Delete a digest subscription
+	admin.DELETE("/digest-subscriptions/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid digest subscription ID",
+			})
+			return
+		}
+
+		err = sqlClient.DeleteDigestSubscription(id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Digest subscription not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to delete digest subscription",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Digest subscription deleted successfully",
+		})
+	})
+
+	// POST /api/digest-subscriptions/:id/send - Send the digest since the last one now
+	admin.POST("/digest-subscriptions/:id/send", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid digest subscription ID",
+			})
+			return
+		}
+
+		subscription, err := sqlClient.GetDigestSubscriptionByID(id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Digest subscription not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to query digest subscription",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		if err := digests.Send(subscription); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error":   "Failed to send digest",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Digest sent successfully",
+		})
+	})
+}
@@ -0,0 +1,259 @@
+package routes
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	. "dsmpartsfinder-api/models"
+	"dsmpartsfinder-api/siteclients"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// sseHeartbeatInterval is how often an idle event stream sends a comment, so proxies do not
+	// close it
+	sseHeartbeatInterval = 15 * time.Second
+	// partStreamBatchSize is how many parts /api/parts/stream reads from the database at once
+	partStreamBatchSize = 100
+)
+
+// ProgressEvents publishes the progress of running fetches
+type ProgressEvents interface {
+	Subscribe() (<-chan siteclients.ProgressEvent, func())
+}
+
+// PartFeed signals that new parts were stored
+type PartFeed interface {
+	Subscribe() (<-chan struct{}, func())
+}
+
+// startEventStream sends the headers of a server-sent event stream
+func startEventStream(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+}
+
+// writeHeartbeat writes an SSE comment, reporting whether the client is still there
+func writeHeartbeat(w io.Writer) bool {
+	_, err := io.WriteString(w, ": heartbeat\n\n")
+	return err == nil
+}
+
+// lastEventID reads the ID a reconnecting client received last, from the Last-Event-ID header
+// or the last_event_id query parameter. It returns -1 when neither is set.
+func lastEventID(c *gin.Context) (int, error) {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("last_event_id")
+	}
+	if value == "" {
+		return -1, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// parseEventFilter reads the event filters from the query string
+func parseEventFilter(c *gin.Context) (EventFilter, error) {
+	var filter EventFilter
+
+	if filter.Type = c.Query("type"); filter.Type != "" {
+		known := false
+		for _, eventType := range EventTypes {
+			known = known || filter.Type == eventType
+		}
+		if !known {
+			return filter, fmt.Errorf("invalid type %q", filter.Type)
+		}
+	}
+
+	for param, target := range map[string]*int{"site_id": &filter.SiteID, "part_id": &filter.PartID} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s %q", param, value)
+		}
+		*target = id
+	}
+
+	return filter, nil
+}
+
+func registerEventRoutes(api *gin.RouterGroup, sqlClient SQLClient, progress ProgressEvents, partsService PartsService, partFeed PartFeed) {
+	// GET /api/events - Get the domain events in the outbox, newest first
+	api.GET("/events", func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+		filter, err := parseEventFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid filter",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		events, err := sqlClient.GetEvents(filter, limit, offset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to query events",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		total, err := sqlClient.GetEventsCount(filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to count events",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    events,
+			"message": "Events retrieved successfully",
+			"total":   total,
+			"limit":   limit,
+			"offset":  offset,
+		})
+	})
+
+	// GET /api/events/fetch - Stream the progress of fetches as server-sent events
+	api.GET("/events/fetch", func(c *gin.Context) {
+		siteID := 0
+		if siteIDStr := c.Query("site_id"); siteIDStr != "" {
+			id, err := strconv.Atoi(siteIDStr)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "Invalid site_id",
+				})
+				return
+			}
+			siteID = id
+		}
+
+		events, unsubscribe := progress.Subscribe()
+		defer unsubscribe()
+
+		heartbeat := time.NewTicker(sseHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		startEventStream(c)
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case <-heartbeat.C:
+				return writeHeartbeat(w)
+			case event := <-events:
+				if siteID == 0 || event.SiteID == siteID {
+					c.SSEvent(event.Type, event)
+				}
+				return true
+			}
+		})
+	})
+
+	// GET /api/parts/stream - Stream newly stored parts matching the /api/parts filters as
+	// server-sent events. The event ID is the DB ID of the part, so a reconnecting client resumes
+	// after the last part it received.
+	api.GET("/parts/stream", func(c *gin.Context) {
+		filter, err := parsePartFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid filter",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		afterID, err := lastEventID(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid Last-Event-ID",
+			})
+			return
+		}
+
+		// Subscribe before looking up where to start, so no part stored in between is missed
+		stored, unsubscribe := partFeed.Subscribe()
+		defer unsubscribe()
+
+		if afterID < 0 {
+			// A new client only gets the parts stored from now on
+			afterID, err = partsService.GetLatestPartID()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":   "Failed to query parts",
+					"details": err.Error(),
+				})
+				return
+			}
+		}
+
+		heartbeat := time.NewTicker(sseHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		log.Printf("[GET /api/parts/stream] Streaming parts after ID %d with filter=%+v", afterID, filter)
+		startEventStream(c)
+
+		// sendNewParts sends every matching part stored after afterID. Parts that do not match are
+		// skipped for good by moving afterID to the last part stored when the lookup began.
+		sendNewParts := func() bool {
+			latestID, err := partsService.GetLatestPartID()
+			if err != nil {
+				return false
+			}
+			for afterID < latestID {
+				parts, err := partsService.GetPartsAfterID(afterID, latestID, partStreamBatchSize, filter)
+				if err != nil {
+					return false
+				}
+				for _, part := range parts {
+					c.Render(-1, sse.Event{
+						Id:    strconv.Itoa(part.ID),
+						Event: "part",
+						Data:  part,
+					})
+					afterID = part.ID
+				}
+				c.Writer.Flush()
+				if len(parts) < partStreamBatchSize {
+					afterID = latestID
+				}
+			}
+			return true
+		}
+
+		// Catch up on the parts a reconnecting client missed
+		if !sendNewParts() {
+			return
+		}
+
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case <-heartbeat.C:
+				return writeHeartbeat(w)
+			case <-stored:
+				return sendNewParts()
+			}
+		})
+	})
+}
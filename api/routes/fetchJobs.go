@@ -0,0 +1,161 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	. "dsmpartsfinder-api/models"
+	"dsmpartsfinder-api/siteclients"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fetchJobSiteIDs returns the sites a fetch job request targets, every registered site when
+// it names none
+func fetchJobSiteIDs(req FetchJobRequest, registered []int) ([]int, error) {
+	if len(req.SiteIDs) == 0 {
+		return registered, nil
+	}
+
+	isRegistered := make(map[int]bool, len(registered))
+	for _, siteID := range registered {
+		isRegistered[siteID] = true
+	}
+	for _, siteID := range req.SiteIDs {
+		if !isRegistered[siteID] {
+			return nil, fmt.Errorf("no site client registered for site %d", siteID)
+		}
+	}
+	return req.SiteIDs, nil
+}
+
+// fetchJobID reads the job ID path parameter, responding with 400 when it is invalid
+func fetchJobID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid fetch job ID",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondFetchJobError maps the errors of the job queue to a response
+func respondFetchJobError(c *gin.Context, message string, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Fetch job not found",
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   message,
+		"details": err.Error(),
+	})
+}
+
+// registerFetchJobRoutes registers the asynchronous fetch endpoints. Unlike /api/parts/fetch
+// they are available in release mode, behind the admin token.
+func registerFetchJobRoutes(api *gin.RouterGroup, partsService PartsService, jobQueue JobQueue, adminToken string) {
+	admin := api.Group("", requireAdmin(adminToken))
+
+	// POST /api/fetch-jobs - Queue a fetch of one or more sites and return its ID right away
+	admin.POST("/fetch-jobs", func(c *gin.Context) {
+		var req FetchJobRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		siteIDs, err := fetchJobSiteIDs(req, partsService.GetRegisteredSiteIDs())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid site_ids",
+				"details": err.Error(),
+			})
+			return
+		}
+		if len(siteIDs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "No site clients registered",
+			})
+			return
+		}
+
+		params := siteclients.SearchParams{
+			VehicleType: req.VehicleType,
+			Make:        req.Make,
+			BaseModel:   req.BaseModel,
+			Model:       req.Model,
+			YearFrom:    req.YearFrom,
+			YearTo:      req.YearTo,
+			Keywords:    req.Keywords,
+			MinPrice:    req.MinPrice,
+			MaxPrice:    req.MaxPrice,
+			Limit:       req.Limit,
+		}
+
+		batch, err := jobQueue.EnqueueBatch(siteIDs, params, FetchTriggerManual)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to queue fetch",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		log.Printf("[POST /api/fetch-jobs] Queued fetch job %d for sites %v", batch.ID, siteIDs)
+		c.JSON(http.StatusAccepted, gin.H{
+			"data":    batch,
+			"message": "Fetch queued",
+		})
+	})
+
+	// GET /api/fetch-jobs/:id - Get the progress of a fetch job per site
+	admin.GET("/fetch-jobs/:id", func(c *gin.Context) {
+		id, ok := fetchJobID(c)
+		if !ok {
+			return
+		}
+
+		batch, err := jobQueue.GetBatch(id)
+		if err != nil {
+			respondFetchJobError(c, "Failed to query fetch job", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    batch,
+			"message": "Fetch job retrieved successfully",
+		})
+	})
+
+	// DELETE /api/fetch-jobs/:id - Cancel the sites of a fetch job that did not finish yet
+	admin.DELETE("/fetch-jobs/:id", func(c *gin.Context) {
+		id, ok := fetchJobID(c)
+		if !ok {
+			return
+		}
+
+		batch, err := jobQueue.CancelBatch(id)
+		if err != nil {
+			respondFetchJobError(c, "Failed to cancel fetch job", err)
+			return
+		}
+
+		log.Printf("[DELETE /api/fetch-jobs/%d] Fetch job cancelled", id)
+		c.JSON(http.StatusOK, gin.H{
+			"data":    batch,
+			"message": "Fetch job cancelled",
+		})
+	})
+}
@@ -0,0 +1,121 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	. "dsmpartsfinder-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseFetchRunFilter reads the fetch run filters from the query string
+func parseFetchRunFilter(c *gin.Context) (FetchRunFilter, error) {
+	var filter FetchRunFilter
+
+	if siteID := c.Query("site_id"); siteID != "" {
+		id, err := strconv.Atoi(siteID)
+		if err != nil {
+			return filter, fmt.Errorf("invalid site_id %q", siteID)
+		}
+		filter.SiteID = id
+	}
+	if profileID := c.Query("profile_id"); profileID != "" {
+		id, err := strconv.Atoi(profileID)
+		if err != nil {
+			return filter, fmt.Errorf("invalid profile_id %q", profileID)
+		}
+		filter.ProfileID = id
+	}
+
+	filter.Status = c.Query("status")
+	switch filter.Status {
+	case "", FetchRunRunning, FetchRunSucceeded, FetchRunFailed:
+	default:
+		return filter, fmt.Errorf("invalid status %q", filter.Status)
+	}
+
+	filter.Trigger = c.Query("trigger")
+	switch filter.Trigger {
+	case "", FetchTriggerStartup, FetchTriggerCron, FetchTriggerManual:
+	default:
+		return filter, fmt.Errorf("invalid trigger %q", filter.Trigger)
+	}
+
+	return filter, nil
+}
+
+func registerFetchRunRoutes(api *gin.RouterGroup, sqlClient SQLClient) {
+	// GET /api/fetch-runs - Get the fetch run history, newest first
+	api.GET("/fetch-runs", func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+		filter, err := parseFetchRunFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid filter",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		runs, err := sqlClient.GetFetchRuns(filter, limit, offset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to query fetch runs",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		total, err := sqlClient.GetFetchRunsCount(filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to count fetch runs",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    runs,
+			"message": "Fetch runs retrieved successfully",
+			"total":   total,
+			"limit":   limit,
+			"offset":  offset,
+		})
+	})
+
+	// GET /api/fetch-runs/:id - Get a single fetch run by ID
+	api.GET("/fetch-runs/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid fetch run ID",
+			})
+			return
+		}
+
+		run, err := sqlClient.GetFetchRunByID(id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Fetch run not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to query fetch run",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    run,
+			"message": "Fetch run retrieved successfully",
+		})
+	})
+}
@@ -0,0 +1,49 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImageStore serves the stored images of parts, see the images package
+type ImageStore interface {
+	Path(hash string, thumbnail bool) (string, error)
+	ContentType(hash string, thumbnail bool) (string, error)
+}
+
+// registerImageRoutes registers the endpoint serving part images by their hash
+func registerImageRoutes(api *gin.RouterGroup, imageStore ImageStore) {
+	// GET /api/images/:hash - Get an image, or its thumbnail with ?size=thumb
+	api.GET("/images/:hash", func(c *gin.Context) {
+		hash := c.Param("hash")
+		thumbnail := c.Query("size") == "thumb"
+
+		path, err := imageStore.Path(hash, thumbnail)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Image not found",
+			})
+			return
+		}
+		// Only serve what is an image, under its own type, so the browser never runs it as a page
+		contentType, err := imageStore.ContentType(hash, thumbnail)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Image not found",
+			})
+			return
+		}
+
+		// An image never changes under its hash
+		etag := `"` + hash + `"`
+		if thumbnail {
+			etag = `"` + hash + `-thumb"`
+		}
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		c.Header("ETag", etag)
+		c.Header("Content-Type", contentType)
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.File(path)
+	})
+}
@@ -0,0 +1,188 @@
+package routes
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	. "dsmpartsfinder-api/models"
+	"dsmpartsfinder-api/siteclients"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxIngestBodyBytes bounds an ingest request, parts may carry base64 images
+	maxIngestBodyBytes = 64 << 20
+	// maxIngestBatchSize is how many parts a single ingest request may push
+	maxIngestBatchSize = 1000
+)
+
+// decodeIngestBatch reads an ingest body, either a JSON array of parts or {"parts": [...]}
+func decodeIngestBatch(body []byte) ([]siteclients.Part, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var parts []siteclients.Part
+		err := json.Unmarshal(body, &parts)
+		return parts, err
+	}
+
+	var batch struct {
+		Parts []siteclients.Part `json:"parts"`
+	}
+	err := json.Unmarshal(body, &batch)
+	return batch.Parts, err
+}
+
+// registerIngestRoutes registers the ingest endpoint external scrapers push parts to, and the
+// admin endpoints managing the per-site ingest tokens
+func registerIngestRoutes(api *gin.RouterGroup, sqlClient SQLClient, partsService PartsService, adminToken string) {
+	admin := api.Group("", requireAdmin(adminToken))
+
+	// POST /api/sites/:id/ingest-token - Create a new ingest token for a site, replacing the old one
+	admin.POST("/sites/:id/ingest-token", func(c *gin.Context) {
+		siteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid site ID",
+			})
+			return
+		}
+
+		token, err := sqlClient.CreateSiteIngestToken(siteID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Site not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to create ingest token",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"data":    IngestTokenResponse{SiteID: siteID, Token: token},
+			"message": "Ingest token created, it is not shown again",
+		})
+	})
+
+	// DELETE /api/sites/:id/ingest-token - Revoke the ingest token of a site
+	admin.DELETE("/sites/:id/ingest-token", func(c *gin.Context) {
+		siteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid site ID",
+			})
+			return
+		}
+
+		if err := sqlClient.RevokeSiteIngestToken(siteID); err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Site not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to revoke ingest token",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Ingest token revoked",
+		})
+	})
+
+	// POST /api/ingest/:siteId - Store a batch of parts scraped outside the server
+	api.POST("/ingest/:siteId", func(c *gin.Context) {
+		siteID, err := strconv.Atoi(c.Param("siteId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid site ID",
+			})
+			return
+		}
+
+		token, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		valid, err := sqlClient.CheckSiteIngestToken(siteID, token)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to check ingest token",
+				"details": err.Error(),
+			})
+			return
+		}
+		if !valid {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid ingest token",
+			})
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIngestBodyBytes))
+		if err != nil {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":   "Request body is too large",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		parts, err := decodeIngestBatch(body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+		if len(parts) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Batch has no parts",
+			})
+			return
+		}
+		if len(parts) > maxIngestBatchSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("Batch has %d parts, at most %d are allowed", len(parts), maxIngestBatchSize),
+			})
+			return
+		}
+
+		results, run, err := partsService.IngestParts(siteID, parts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to ingest parts",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		counts := map[string]int{
+			IngestInserted:  0,
+			IngestUpdated:   0,
+			IngestDuplicate: 0,
+			IngestRejected:  0,
+		}
+		for _, result := range results {
+			counts[result.Status]++
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    results,
+			"message": "Parts ingested successfully",
+			"total":   len(results),
+			"counts":  counts,
+			"run_id":  run.ID,
+		})
+	})
+}
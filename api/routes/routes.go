@@ -3,9 +3,12 @@ package routes
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	. "dsmpartsfinder-api/models"
@@ -17,30 +20,83 @@ import (
 type SQLClient interface {
 	GetAllSites() ([]Site, error)
 	GetSiteByID(id int) (*Site, error)
-	CreateSite(name, url string) (*Site, error)
-	UpdateSite(id int, name, url string) (*Site, error)
+	CreateSite(name, url, clientType string, config json.RawMessage, gracePeriodHours int) (*Site, error)
+	UpdateSite(id int, name, url, clientType string, config json.RawMessage, gracePeriodHours int) (*Site, error)
 	DeleteSite(id int) error
 
 	GetAllParts(limit, offset int) ([]Part, error)
 	GetPartByID(id int) (*Part, error)
 	GetPartsBySiteID(siteID, limit, offset int) ([]Part, error)
 	DeletePartsBySiteID(siteID int) error
-	GetFilteredParts(limit, offset int, typeFilter string, siteIDs []int, newerThan time.Time, search string, sortBy string, sortDesc bool) ([]Part, error)
+	GetFilteredParts(limit, offset int, filter PartFilter) ([]Part, error)
+
+	GetSearchProfiles(enabledOnly bool) ([]SearchProfile, error)
+	GetSearchProfileByID(id int) (*SearchProfile, error)
+	CreateSearchProfile(req SearchProfileRequest) (*SearchProfile, error)
+	UpdateSearchProfile(id int, req SearchProfileRequest) (*SearchProfile, error)
+	DeleteSearchProfile(id int) error
+
+	GetSavedFilters(enabledOnly bool) ([]SavedFilter, error)
+	GetSavedFilterByID(id int) (*SavedFilter, error)
+	CreateSavedFilter(req SavedFilterRequest) (*SavedFilter, error)
+	UpdateSavedFilter(id int, req SavedFilterRequest) (*SavedFilter, error)
+	DeleteSavedFilter(id int) error
+	GetAlerts(savedFilterID, limit, offset int) ([]SavedFilterAlert, error)
+	GetAlertsCount(savedFilterID int) (int, error)
+
+	GetDigestSubscriptions(frequency string, enabledOnly bool) ([]DigestSubscription, error)
+	GetDigestSubscriptionByID(id int) (*DigestSubscription, error)
+	CreateDigestSubscription(req DigestSubscriptionRequest) (*DigestSubscription, error)
+	UpdateDigestSubscription(id int, req DigestSubscriptionRequest) (*DigestSubscription, error)
+	DeleteDigestSubscription(id int) error
+
+	GetWebhooks(enabledOnly bool) ([]WebhookSubscription, error)
+	GetWebhookByID(id int) (*WebhookSubscription, error)
+	CreateWebhook(req WebhookSubscriptionRequest) (*WebhookSubscription, error)
+	UpdateWebhook(id int, req WebhookSubscriptionRequest) (*WebhookSubscription, error)
+	DeleteWebhook(id int) error
+	GetWebhookDeliveries(webhookID int, status string, limit, offset int) ([]WebhookDelivery, error)
+	GetWebhookDeliveriesCount(webhookID int, status string) (int, error)
+	RedeliverWebhookDelivery(webhookID, id int) (*WebhookDelivery, error)
+
+	CreateSiteIngestToken(siteID int) (string, error)
+	RevokeSiteIngestToken(siteID int) error
+	CheckSiteIngestToken(siteID int, token string) (bool, error)
+
+	GetFetchRunByID(id int) (*FetchRun, error)
+	GetFetchRuns(filter FetchRunFilter, limit, offset int) ([]FetchRun, error)
+	GetFetchRunsCount(filter FetchRunFilter) (int, error)
+
+	GetEvents(filter EventFilter, limit, offset int) ([]Event, error)
+	GetEventsCount(filter EventFilter) (int, error)
 }
 
 type PartsService interface {
-	FetchAndStoreParts(ctx context.Context, siteID int, params siteclients.SearchParams) ([]Part, error)
 	GetRegisteredSiteIDs() []int
 	GetAllParts(limit, offset int) ([]Part, error)
-	GetFilteredParts(limit, offset int, typeFilter string, siteIDs []int, newerThan time.Time, search string, sortBy string, sortDesc bool) ([]Part, error)
+	GetFilteredParts(limit, offset int, filter PartFilter) ([]Part, error)
+	GetPartsAfterID(afterID, upToID, limit int, filter PartFilter) ([]Part, error)
+	GetLatestPartID() (int, error)
 	GetPartByID(id int) (*Part, error)
 	GetPartsBySiteID(siteID, limit, offset int) ([]Part, error)
 	DeletePartsBySiteID(siteID int) error
 	GetTotalPartsCount() (int, error)
-	GetFilteredPartsCount(typeFilter string, siteIDs []int, newerThan time.Time, search string) (int, error)
+	GetFilteredPartsCount(filter PartFilter) (int, error)
+	GetPriceHistory(partID int) ([]PricePoint, error)
+	GetPartChanges(partID int) ([]PartChange, error)
+	IngestParts(siteID int, parts []siteclients.Part) ([]IngestResult, *FetchRun, error)
 }
 
-func RegisterAPIRoutes(r *gin.Engine, sqlClient SQLClient, partsService PartsService) {
+// JobQueue runs fetches one site at a time, see the fetch_jobs table
+type JobQueue interface {
+	Enqueue(siteID int, params siteclients.SearchParams, trigger string) (*FetchJob, error)
+	Wait(ctx context.Context, jobID int) (*FetchJob, []Part, error)
+	EnqueueBatch(siteIDs []int, params siteclients.SearchParams, trigger string) (*FetchBatch, error)
+	GetBatch(batchID int) (*FetchBatch, error)
+	CancelBatch(batchID int) (*FetchBatch, error)
+}
+
+func RegisterAPIRoutes(r *gin.Engine, sqlClient SQLClient, partsService PartsService, scheduler Scheduler, jobQueue JobQueue, progress ProgressEvents, partFeed PartFeed, alerts AlertSender, digests DigestSender, webhooks WebhookDispatcher, imageStore ImageStore, adminToken string) {
 	api := r.Group("/api")
 	{
 		// Health check endpoint
@@ -101,6 +157,27 @@ func RegisterAPIRoutes(r *gin.Engine, sqlClient SQLClient, partsService PartsSer
 			})
 		})
 
+		registerSearchProfileRoutes(api, sqlClient, adminToken)
+		registerSavedFilterRoutes(api, sqlClient, alerts, adminToken)
+		registerDigestRoutes(api, sqlClient, digests, adminToken)
+		registerWebhookRoutes(api, sqlClient, webhooks, adminToken)
+		registerIngestRoutes(api, sqlClient, partsService, adminToken)
+		registerImageRoutes(api, imageStore)
+		registerFetchRunRoutes(api, sqlClient)
+		registerSchedulerRoutes(api, scheduler, adminToken)
+		registerFetchJobRoutes(api, partsService, jobQueue, adminToken)
+		registerEventRoutes(api, sqlClient, progress, partsService, partFeed)
+
+		// GET /api/vehicles - Get the vehicle taxonomy used to build site queries
+		api.GET("/vehicles", func(c *gin.Context) {
+			taxonomy := siteclients.GetTaxonomy()
+			c.JSON(http.StatusOK, gin.H{
+				"data":    taxonomy.Makes,
+				"message": "Vehicles retrieved successfully",
+				"total":   len(taxonomy.Makes),
+			})
+		})
+
 		if gin.Mode() != gin.ReleaseMode {
 			// POST /api/parts/fetch - Fetch parts from all sites
 			api.POST("/parts/fetch", func(c *gin.Context) {
@@ -119,19 +196,49 @@ func RegisterAPIRoutes(r *gin.Engine, sqlClient SQLClient, partsService PartsSer
 				log.Printf("[POST /api/parts/fetch] Request: SiteID=%d, Limit=%d", req.SiteID, req.Limit)
 
 				// Convert to search params
-				params := siteclients.SearchParams{}
+				params := siteclients.SearchParams{
+					VehicleType: req.VehicleType,
+					Make:        req.Make,
+					BaseModel:   req.BaseModel,
+					Model:       req.Model,
+					YearFrom:    req.YearFrom,
+					YearTo:      req.YearTo,
+					Offset:      req.Offset,
+					Limit:       req.Limit,
+				}
 
-				// Fetch and store parts
-				parts, err := partsService.FetchAndStoreParts(c.Request.Context(), req.SiteID, params)
+				// Queue the fetch and wait for it, it may have to wait for a running fetch of the site
+				queued, err := jobQueue.Enqueue(req.SiteID, params, FetchTriggerManual)
 				if err != nil {
 					log.Printf("[POST /api/parts/fetch] ERROR: %v", err)
 					c.JSON(http.StatusInternalServerError, gin.H{
-						"error":   "Failed to fetch and store parts",
+						"error":   "Failed to queue fetch",
 						"details": err.Error(),
 					})
 					return
 				}
 
+				ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+				defer cancel()
+
+				job, parts, err := jobQueue.Wait(ctx, queued.ID)
+				if err != nil {
+					log.Printf("[POST /api/parts/fetch] Job %d not finished: %v", queued.ID, err)
+					c.JSON(http.StatusAccepted, gin.H{
+						"job":     queued,
+						"message": "Fetch is still queued or running",
+					})
+					return
+				}
+				if job.Status == FetchJobFailed {
+					log.Printf("[POST /api/parts/fetch] ERROR: %s", job.LastError)
+					c.JSON(http.StatusInternalServerError, gin.H{
+						"error":   "Failed to fetch and store parts",
+						"details": job.LastError,
+					})
+					return
+				}
+
 				log.Printf("[POST /api/parts/fetch] Successfully fetched and stored %d parts", len(parts))
 
 				c.JSON(http.StatusOK, gin.H{
@@ -208,42 +315,36 @@ func RegisterAPIRoutes(r *gin.Engine, sqlClient SQLClient, partsService PartsSer
 				ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
 				defer cancel()
 
-				// Channel to collect results from goroutines
-				type FetchResult struct {
-					siteID int
-					parts  []Part
-					err    error
-				}
-				results := make(chan FetchResult, len(siteIDs))
-
-				// Launch a goroutine for each site
-				log.Println("[POST /api/parts/fetch-all] Starting concurrent fetch from all sites...")
-				for _, siteID := range siteIDs {
-					go func(id int) {
-						log.Printf("[POST /api/parts/fetch-all] Starting fetch for site ID: %d", id)
-						parts, err := partsService.FetchAndStoreParts(ctx, id, params)
-						results <- FetchResult{
-							siteID: id,
-							parts:  parts,
-							err:    err,
-						}
-					}(siteID)
-				}
-
-				// Collect results
+				// Queue a job for each site, the queue runs the sites concurrently
+				log.Println("[POST /api/parts/fetch-all] Queueing fetches for all sites...")
 				allParts := make([]Part, 0)
 				errors := make(map[int]string)
+				jobs := make(map[int]*FetchJob)
+				for _, siteID := range siteIDs {
+					job, err := jobQueue.Enqueue(siteID, params, FetchTriggerManual)
+					if err != nil {
+						log.Printf("[POST /api/parts/fetch-all] ERROR queueing fetch for site %d: %v", siteID, err)
+						errors[siteID] = err.Error()
+						continue
+					}
+					jobs[siteID] = job
+				}
 
 				// Wait for all fetches to complete
-				for range siteIDs {
-					result := <-results
-					if result.err != nil {
-						log.Printf("[POST /api/parts/fetch-all] ERROR fetching parts from site %d: %v", result.siteID, result.err)
-						errors[result.siteID] = result.err.Error()
+				for siteID, queued := range jobs {
+					job, parts, err := jobQueue.Wait(ctx, queued.ID)
+					if err != nil {
+						log.Printf("[POST /api/parts/fetch-all] Job %d for site %d not finished: %v", queued.ID, siteID, err)
+						errors[siteID] = fmt.Sprintf("job %d did not finish: %v", queued.ID, err)
+						continue
+					}
+					if job.Status == FetchJobFailed {
+						log.Printf("[POST /api/parts/fetch-all] ERROR fetching parts from site %d: %s", siteID, job.LastError)
+						errors[siteID] = job.LastError
 						continue
 					}
-					log.Printf("[POST /api/parts/fetch-all] Got %d parts from site %d", len(result.parts), result.siteID)
-					allParts = append(allParts, result.parts...)
+					log.Printf("[POST /api/parts/fetch-all] Got %d parts from site %d", len(parts), siteID)
+					allParts = append(allParts, parts...)
 				}
 
 				log.Printf("[POST /api/parts/fetch-all] Total parts collected: %d", len(allParts))
@@ -269,30 +370,20 @@ func RegisterAPIRoutes(r *gin.Engine, sqlClient SQLClient, partsService PartsSer
 		api.GET("/parts", func(c *gin.Context) {
 			limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
 			offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
-			typeFilter := c.Query("type")
-			siteIDsStr := c.QueryArray("site_ids[]")
-			siteIDs := make([]int, 0)
-			for _, idStr := range siteIDsStr {
-				if id, err := strconv.Atoi(idStr); err == nil {
-					siteIDs = append(siteIDs, id)
-				}
+			filter, err := parsePartFilter(c)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   "Invalid filter",
+					"details": err.Error(),
+				})
+				return
 			}
-			sortBy := c.DefaultQuery("sort", "")
-			sortDesc := c.DefaultQuery("sort_desc", "false") == "true"
 
 			// If any filter is specified, use filtered endpoint
-			search := c.Query("search")
-			if typeFilter != "" || len(siteIDs) > 0 || c.Query("newer_than_hours") != "" || search != "" || sortBy != "" {
-				var newerThan time.Time
-				if c.Query("newer_than_hours") != "" {
-					hours, _ := strconv.Atoi(c.DefaultQuery("newer_than_hours", "72"))
-					newerThan = time.Now().Add(-time.Duration(hours) * time.Hour)
-				}
+			if filter.HasFilters() {
+				log.Printf("[GET /api/parts] Called with filters: limit=%d, offset=%d, filter=%+v", limit, offset, filter)
 
-				log.Printf("[GET /api/parts] Called with filters: limit=%d, offset=%d, type=%s, site_id=%d, newer_than=%v",
-					limit, offset, typeFilter, siteIDs, newerThan)
-
-				parts, err := partsService.GetFilteredParts(limit, offset, typeFilter, siteIDs, newerThan, search, sortBy, sortDesc)
+				parts, err := partsService.GetFilteredParts(limit, offset, filter)
 				if err != nil {
 					log.Printf("[GET /api/parts] ERROR: %v", err)
 					c.JSON(http.StatusInternalServerError, gin.H{
@@ -302,7 +393,7 @@ func RegisterAPIRoutes(r *gin.Engine, sqlClient SQLClient, partsService PartsSer
 					return
 				}
 
-				total, err := partsService.GetFilteredPartsCount(typeFilter, siteIDs, newerThan, search)
+				total, err := partsService.GetFilteredPartsCount(filter)
 				if err != nil {
 					log.Printf("[GET /api/parts] ERROR getting filtered count: %v", err)
 					c.JSON(http.StatusInternalServerError, gin.H{
@@ -387,6 +478,68 @@ func RegisterAPIRoutes(r *gin.Engine, sqlClient SQLClient, partsService PartsSer
 			})
 		})
 
+		// GET /api/parts/:id/price-history - Get the observed prices of a part
+		api.GET("/parts/:id/price-history", func(c *gin.Context) {
+			id, err := strconv.Atoi(c.Param("id"))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "Invalid part ID",
+				})
+				return
+			}
+
+			history, err := partsService.GetPriceHistory(id)
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "Part not found",
+				})
+				return
+			} else if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":   "Failed to query price history",
+					"details": err.Error(),
+				})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"data":    history,
+				"message": "Price history retrieved successfully",
+				"total":   len(history),
+			})
+		})
+
+		// GET /api/parts/:id/changes - Get the fields the seller edited, newest first
+		api.GET("/parts/:id/changes", func(c *gin.Context) {
+			id, err := strconv.Atoi(c.Param("id"))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "Invalid part ID",
+				})
+				return
+			}
+
+			changes, err := partsService.GetPartChanges(id)
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "Part not found",
+				})
+				return
+			} else if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":   "Failed to query part changes",
+					"details": err.Error(),
+				})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"data":    changes,
+				"message": "Part changes retrieved successfully",
+				"total":   len(changes),
+			})
+		})
+
 		// GET /api/sites/:id/parts - Get all parts for a specific site
 		api.GET("/sites/:id/parts", func(c *gin.Context) {
 			siteID, err := strconv.Atoi(c.Param("id"))
@@ -445,3 +598,92 @@ func RegisterAPIRoutes(r *gin.Engine, sqlClient SQLClient, partsService PartsSer
 		})
 	}
 }
+
+// parsePartFilter reads the part filters and sort order from the query string
+func parsePartFilter(c *gin.Context) (PartFilter, error) {
+	filter := PartFilter{
+		TypeName: c.Query("type"),
+		Search:   c.Query("search"),
+		SortBy:   c.DefaultQuery("sort", ""),
+		SortDesc: c.DefaultQuery("sort_desc", "false") == "true",
+		SiteIDs:  make([]int, 0),
+	}
+
+	for _, idStr := range c.QueryArray("site_ids[]") {
+		if id, err := strconv.Atoi(idStr); err == nil {
+			filter.SiteIDs = append(filter.SiteIDs, id)
+		}
+	}
+
+	if c.Query("newer_than_hours") != "" {
+		filter.NewerThanHours, _ = strconv.Atoi(c.DefaultQuery("newer_than_hours", "72"))
+	}
+
+	for param, target := range map[string]**float64{"min_price": &filter.MinPrice, "max_price": &filter.MaxPrice} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		price, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+		if err != nil || price < 0 {
+			return filter, fmt.Errorf("%s must be a non-negative number", param)
+		}
+		*target = &price
+	}
+
+	if filter.Currency = c.Query("currency"); filter.Currency != "" && !isCurrencyCode(filter.Currency) {
+		return filter, fmt.Errorf("currency must be a three letter ISO code such as EUR")
+	}
+
+	if filter.Status = c.Query("status"); filter.Status != "" && filter.Status != "all" {
+		statuses := filter.Statuses()
+		if len(statuses) == 0 {
+			return filter, fmt.Errorf("status must not be empty")
+		}
+		for _, status := range statuses {
+			if !isPartStatus(status) {
+				return filter, fmt.Errorf("status must be \"all\" or a comma separated list of %s", strings.Join(PartStatuses, ", "))
+			}
+		}
+	}
+
+	if value := c.Query("price_dropped_since"); value != "" {
+		since, err := parseSinceTime(value)
+		if err != nil {
+			return filter, fmt.Errorf("price_dropped_since must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+		filter.PriceDroppedSince = &since
+	}
+
+	return filter, nil
+}
+
+func isPartStatus(status string) bool {
+	for _, known := range PartStatuses {
+		if status == known {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSinceTime parses an RFC 3339 time or a date, which is taken as midnight UTC
+func parseSinceTime(value string) (time.Time, error) {
+	if since, err := time.Parse(time.RFC3339, value); err == nil {
+		return since, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// isCurrencyCode reports whether s looks like an ISO 4217 code, three letters
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, c := range strings.ToUpper(s) {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,322 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+
+	. "dsmpartsfinder-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AlertSender sends the notifications of saved filters
+type AlertSender interface {
+	SendTestAlert(savedFilter *SavedFilter) error
+}
+
+// isHTTPURL reports whether a value is an absolute http or https URL
+func isHTTPURL(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// validateSavedFilterRequest checks the notifier, quiet hours and part filter of a saved filter request
+func validateSavedFilterRequest(req SavedFilterRequest) string {
+	switch req.Notifier {
+	case "webhook":
+		if !isHTTPURL(req.Target) {
+			return "target must be an http or https URL for webhook notifiers"
+		}
+	case "email":
+		if _, err := mail.ParseAddress(req.Target); err != nil {
+			return "target must be an email address for email notifiers"
+		}
+	default:
+		return "notifier must be \"webhook\" or \"email\""
+	}
+
+	if (req.QuietHoursStart == "") != (req.QuietHoursEnd == "") {
+		return "quiet_hours_start and quiet_hours_end must be set together"
+	}
+	for _, value := range []string{req.QuietHoursStart, req.QuietHoursEnd} {
+		if value == "" {
+			continue
+		}
+		if _, err := ParseClock(value); err != nil {
+			return "Quiet hours must be times of day in HH:MM format"
+		}
+	}
+
+	return validatePartFilter(req.Filter)
+}
+
+// validatePartFilter checks a part filter stored as JSON, with the checks parsePartFilter makes
+// on the query string
+func validatePartFilter(filter PartFilter) string {
+	if filter.NewerThanHours < 0 {
+		return "filter.newer_than_hours must not be negative"
+	}
+	if (filter.MinPrice != nil && *filter.MinPrice < 0) || (filter.MaxPrice != nil && *filter.MaxPrice < 0) {
+		return "Prices must not be negative"
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		return "filter.min_price must not be above filter.max_price"
+	}
+	if filter.Currency != "" && !isCurrencyCode(filter.Currency) {
+		return "filter.currency must be a three letter ISO code such as EUR"
+	}
+	if filter.Status != "" && filter.Status != "all" {
+		statuses := filter.Statuses()
+		if len(statuses) == 0 {
+			return "filter.status must not be empty"
+		}
+		for _, status := range statuses {
+			if !isPartStatus(status) {
+				return fmt.Sprintf("filter.status must be \"all\" or a comma separated list of %s", strings.Join(PartStatuses, ", "))
+			}
+		}
+	}
+	return ""
+}
+
+// registerSavedFilterRoutes registers the saved filter endpoints. Filters hold email addresses and
+// webhook URLs the server sends to, so they are behind the admin token like the webhooks.
+func registerSavedFilterRoutes(api *gin.RouterGroup, sqlClient SQLClient, alerts AlertSender, adminToken string) {
+	admin := api.Group("", requireAdmin(adminToken))
+
+	// GET /api/saved-filters - Get all saved filters
+	admin.GET("/saved-filters", func(c *gin.Context) {
+		savedFilters, err := sqlClient.GetSavedFilters(c.Query("enabled") == "true")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to query saved filters",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    savedFilters,
+			"message": "Saved filters retrieved successfully",
+			"total":   len(savedFilters),
+		})
+	})
+
+	// GET /api/saved-filters/:id - Get a single saved filter by ID
+	admin.GET("/saved-filters/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid saved filter ID",
+			})
+			return
+		}
+
+		savedFilter, err := sqlClient.GetSavedFilterByID(id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Saved filter not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to query saved filter",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    savedFilter,
+			"message": "Saved filter retrieved successfully",
+		})
+	})
+
+	// POST /api/saved-filters - Create a saved filter
+	admin.POST("/saved-filters", func(c *gin.Context) {
+		var req SavedFilterRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+		if msg := validateSavedFilterRequest(req); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": msg,
+			})
+			return
+		}
+
+		savedFilter, err := sqlClient.CreateSavedFilter(req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to create saved filter",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"data":    savedFilter,
+			"message": "Saved filter created successfully",
+		})
+	})
+
+	// PUT /api/saved-filters/:id - Update a saved filter
+	admin.PUT("/saved-filters/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid saved filter ID",
+			})
+			return
+		}
+
+		var req SavedFilterRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+		if msg := validateSavedFilterRequest(req); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": msg,
+			})
+			return
+		}
+
+		savedFilter, err := sqlClient.UpdateSavedFilter(id, req)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Saved filter not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to update saved filter",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    savedFilter,
+			"message": "Saved filter updated successfully",
+		})
+	})
+
+	// DELETE /api/saved-filters/:id - Delete a saved filter and its alerts
+	admin.DELETE("/saved-filters/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid saved filter ID",
+			})
+			return
+		}
+
+		err = sqlClient.DeleteSavedFilter(id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Saved filter not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to delete saved filter",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Saved filter deleted successfully",
+		})
+	})
+
+	// GET /api/saved-filters/:id/alerts - Get the alerts of a saved filter, newest first
+	admin.GET("/saved-filters/:id/alerts", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid saved filter ID",
+			})
+			return
+		}
+
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+		alertList, err := sqlClient.GetAlerts(id, limit, offset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to query alerts",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		total, err := sqlClient.GetAlertsCount(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to count alerts",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    alertList,
+			"message": "Alerts retrieved successfully",
+			"total":   total,
+			"limit":   limit,
+			"offset":  offset,
+		})
+	})
+
+	// POST /api/saved-filters/:id/test - Send a test notification with the newest matching parts
+	admin.POST("/saved-filters/:id/test", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid saved filter ID",
+			})
+			return
+		}
+
+		savedFilter, err := sqlClient.GetSavedFilterByID(id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Saved filter not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to query saved filter",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		if err := alerts.SendTestAlert(savedFilter); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error":   "Failed to send test notification",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Test notification sent successfully",
+		})
+	})
+}
@@ -0,0 +1,189 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	. "dsmpartsfinder-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Scheduler interface {
+	Entries() []ScheduleEntry
+	Entry(siteID int) (*ScheduleEntry, error)
+	Pause(siteID int) (*ScheduleEntry, error)
+	Resume(siteID int) (*ScheduleEntry, error)
+	UpdateSchedule(siteID int, schedule string, jitterSeconds int) (*ScheduleEntry, error)
+	TriggerNow(siteID int) ([]FetchJob, error)
+}
+
+// respondScheduleError maps the errors of the scheduler to a response
+func respondScheduleError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "No scheduled fetch for this site",
+		})
+	case errors.Is(err, ErrInvalidSchedule):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid schedule",
+			"details": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   message,
+			"details": err.Error(),
+		})
+	}
+}
+
+// scheduleSiteID reads the site ID path parameter, responding with 400 when it is invalid
+func scheduleSiteID(c *gin.Context) (int, bool) {
+	siteID, err := strconv.Atoi(c.Param("siteId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid site ID",
+		})
+		return 0, false
+	}
+	return siteID, true
+}
+
+func registerSchedulerRoutes(api *gin.RouterGroup, scheduler Scheduler, adminToken string) {
+	// GET /api/scheduler - Get the scheduled fetch of every site with its next run
+	api.GET("/scheduler", func(c *gin.Context) {
+		entries := scheduler.Entries()
+		c.JSON(http.StatusOK, gin.H{
+			"data":    entries,
+			"message": "Schedules retrieved successfully",
+			"total":   len(entries),
+		})
+	})
+
+	// GET /api/scheduler/:siteId - Get the scheduled fetch of a site
+	api.GET("/scheduler/:siteId", func(c *gin.Context) {
+		siteID, ok := scheduleSiteID(c)
+		if !ok {
+			return
+		}
+
+		entry, err := scheduler.Entry(siteID)
+		if err != nil {
+			respondScheduleError(c, "Failed to get schedule", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    entry,
+			"message": "Schedule retrieved successfully",
+		})
+	})
+
+	// Changing schedules and triggering fetches needs the admin token, like the fetch jobs
+	admin := api.Group("", requireAdmin(adminToken))
+
+	// PUT /api/scheduler/:siteId - Change the cron expression and jitter of a site
+	admin.PUT("/scheduler/:siteId", func(c *gin.Context) {
+		siteID, ok := scheduleSiteID(c)
+		if !ok {
+			return
+		}
+
+		var req UpdateScheduleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		current, err := scheduler.Entry(siteID)
+		if err != nil {
+			respondScheduleError(c, "Failed to update schedule", err)
+			return
+		}
+		jitterSeconds := current.JitterSeconds
+		if req.JitterSeconds != nil {
+			jitterSeconds = *req.JitterSeconds
+		}
+		if jitterSeconds < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "jitter_seconds must not be negative",
+			})
+			return
+		}
+
+		entry, err := scheduler.UpdateSchedule(siteID, req.Schedule, jitterSeconds)
+		if err != nil {
+			respondScheduleError(c, "Failed to update schedule", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    entry,
+			"message": "Schedule updated successfully",
+		})
+	})
+
+	// POST /api/scheduler/:siteId/pause - Stop the scheduled fetches of a site
+	admin.POST("/scheduler/:siteId/pause", func(c *gin.Context) {
+		siteID, ok := scheduleSiteID(c)
+		if !ok {
+			return
+		}
+
+		entry, err := scheduler.Pause(siteID)
+		if err != nil {
+			respondScheduleError(c, "Failed to pause schedule", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    entry,
+			"message": "Schedule paused successfully",
+		})
+	})
+
+	// POST /api/scheduler/:siteId/resume - Resume the scheduled fetches of a site
+	admin.POST("/scheduler/:siteId/resume", func(c *gin.Context) {
+		siteID, ok := scheduleSiteID(c)
+		if !ok {
+			return
+		}
+
+		entry, err := scheduler.Resume(siteID)
+		if err != nil {
+			respondScheduleError(c, "Failed to resume schedule", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    entry,
+			"message": "Schedule resumed successfully",
+		})
+	})
+
+	// POST /api/scheduler/:siteId/run - Queue a fetch of a site now
+	admin.POST("/scheduler/:siteId/run", func(c *gin.Context) {
+		siteID, ok := scheduleSiteID(c)
+		if !ok {
+			return
+		}
+
+		jobs, err := scheduler.TriggerNow(siteID)
+		if err != nil {
+			respondScheduleError(c, "Failed to trigger fetch", err)
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"data":    jobs,
+			"message": "Fetch queued, follow it in /api/fetch-runs",
+			"total":   len(jobs),
+		})
+	})
+}
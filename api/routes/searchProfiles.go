@@ -0,0 +1,185 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	. "dsmpartsfinder-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validateSearchProfileRequest checks the ranges of a search profile request
+func validateSearchProfileRequest(req SearchProfileRequest) string {
+	if req.YearFrom != 0 && req.YearTo != 0 && req.YearFrom > req.YearTo {
+		return "year_from must not be after year_to"
+	}
+	if req.MinPrice < 0 || req.MaxPrice < 0 {
+		return "Prices must not be negative"
+	}
+	if req.MinPrice != 0 && req.MaxPrice != 0 && req.MinPrice > req.MaxPrice {
+		return "min_price must not be above max_price"
+	}
+	return ""
+}
+
+// registerSearchProfileRoutes registers the search profile endpoints. Profiles drive the scheduled
+// fetches, so changing them is behind the admin token; reading them is not.
+func registerSearchProfileRoutes(api *gin.RouterGroup, sqlClient SQLClient, adminToken string) {
+	admin := api.Group("", requireAdmin(adminToken))
+
+	// GET /api/search-profiles - Get all search profiles
+	api.GET("/search-profiles", func(c *gin.Context) {
+		profiles, err := sqlClient.GetSearchProfiles(c.Query("enabled") == "true")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to query search profiles",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    profiles,
+			"message": "Search profiles retrieved successfully",
+			"total":   len(profiles),
+		})
+	})
+
+	// GET /api/search-profiles/:id - Get a single search profile by ID
+	api.GET("/search-profiles/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid search profile ID",
+			})
+			return
+		}
+
+		profile, err := sqlClient.GetSearchProfileByID(id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Search profile not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to query search profile",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    profile,
+			"message": "Search profile retrieved successfully",
+		})
+	})
+
+	// POST /api/search-profiles - Create a search profile
+	admin.POST("/search-profiles", func(c *gin.Context) {
+		var req SearchProfileRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+		if msg := validateSearchProfileRequest(req); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": msg,
+			})
+			return
+		}
+
+		profile, err := sqlClient.CreateSearchProfile(req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to create search profile",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"data":    profile,
+			"message": "Search profile created successfully",
+		})
+	})
+
+	// PUT /api/search-profiles/:id - Update a search profile
+	admin.PUT("/search-profiles/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid search profile ID",
+			})
+			return
+		}
+
+		var req SearchProfileRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+		if msg := validateSearchProfileRequest(req); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": msg,
+			})
+			return
+		}
+
+		profile, err := sqlClient.UpdateSearchProfile(id, req)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Search profile not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to update search profile",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    profile,
+			"message": "Search profile updated successfully",
+		})
+	})
+
+	// DELETE /api/search-profiles/:id - Delete a search profile
+	admin.DELETE("/search-profiles/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid search profile ID",
+			})
+			return
+		}
+
+		err = sqlClient.DeleteSearchProfile(id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Search profile not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to delete search profile",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Search profile deleted successfully",
+		})
+	})
+}
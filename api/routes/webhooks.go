@@ -0,0 +1,280 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	. "dsmpartsfinder-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookDispatcher sends the queued webhook deliveries
+type WebhookDispatcher interface {
+	Wake()
+}
+
+// isWebhookEvent reports whether an event type is one of WebhookEvents
+func isWebhookEvent(eventType string) bool {
+	for _, known := range WebhookEvents {
+		if eventType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// validateWebhookRequest checks the URL, events and part filter of a webhook request
+func validateWebhookRequest(req WebhookSubscriptionRequest) string {
+	if !isHTTPURL(req.URL) {
+		return "url must be an http or https URL"
+	}
+	if len(req.Events) == 0 {
+		return "events must not be empty"
+	}
+	for _, eventType := range req.Events {
+		if !isWebhookEvent(eventType) {
+			return fmt.Sprintf("events must be a list of %s", strings.Join(WebhookEvents, ", "))
+		}
+	}
+	return validatePartFilter(req.Filter)
+}
+
+// webhookID reads the webhook ID path parameter, responding with 400 when it is invalid
+func webhookID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid webhook ID",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// registerWebhookRoutes registers the webhook subscription endpoints. They hold the signing
+// secrets and make the server call arbitrary URLs, so they are behind the admin token.
+func registerWebhookRoutes(api *gin.RouterGroup, sqlClient SQLClient, dispatcher WebhookDispatcher, adminToken string) {
+	admin := api.Group("", requireAdmin(adminToken))
+
+	// GET /api/webhooks - Get all webhooks
+	admin.GET("/webhooks", func(c *gin.Context) {
+		webhooks, err := sqlClient.GetWebhooks(c.Query("enabled") == "true")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to query webhooks",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    webhooks,
+			"message": "Webhooks retrieved successfully",
+			"total":   len(webhooks),
+		})
+	})
+
+	// GET /api/webhooks/:id - Get a single webhook by ID
+	admin.GET("/webhooks/:id", func(c *gin.Context) {
+		id, ok := webhookID(c)
+		if !ok {
+			return
+		}
+
+		webhook, err := sqlClient.GetWebhookByID(id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Webhook not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to query webhook",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    webhook,
+			"message": "Webhook retrieved successfully",
+		})
+	})
+
+	// POST /api/webhooks - Create a webhook
+	admin.POST("/webhooks", func(c *gin.Context) {
+		var req WebhookSubscriptionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+		if msg := validateWebhookRequest(req); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": msg,
+			})
+			return
+		}
+
+		webhook, err := sqlClient.CreateWebhook(req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to create webhook",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"data":    webhook,
+			"message": "Webhook created successfully",
+		})
+	})
+
+	// PUT /api/webhooks/:id - Update a webhook
+	admin.PUT("/webhooks/:id", func(c *gin.Context) {
+		id, ok := webhookID(c)
+		if !ok {
+			return
+		}
+
+		var req WebhookSubscriptionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+		if msg := validateWebhookRequest(req); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": msg,
+			})
+			return
+		}
+
+		webhook, err := sqlClient.UpdateWebhook(id, req)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Webhook not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to update webhook",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    webhook,
+			"message": "Webhook updated successfully",
+		})
+	})
+
+	// DELETE /api/webhooks/:id - Delete a webhook and its delivery log
+	admin.DELETE("/webhooks/:id", func(c *gin.Context) {
+		id, ok := webhookID(c)
+		if !ok {
+			return
+		}
+
+		err := sqlClient.DeleteWebhook(id)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Webhook not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to delete webhook",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Webhook deleted successfully",
+		})
+	})
+
+	// GET /api/webhooks/:id/deliveries - Get the delivery log of a webhook, newest first
+	admin.GET("/webhooks/:id/deliveries", func(c *gin.Context) {
+		id, ok := webhookID(c)
+		if !ok {
+			return
+		}
+
+		status := c.Query("status")
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+		deliveries, err := sqlClient.GetWebhookDeliveries(id, status, limit, offset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to query webhook deliveries",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		total, err := sqlClient.GetWebhookDeliveriesCount(id, status)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to count webhook deliveries",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data":    deliveries,
+			"message": "Webhook deliveries retrieved successfully",
+			"total":   total,
+			"limit":   limit,
+			"offset":  offset,
+		})
+	})
+
+	// POST /api/webhooks/:id/deliveries/:deliveryId/redeliver - Send a delivery again
+	admin.POST("/webhooks/:id/deliveries/:deliveryId/redeliver", func(c *gin.Context) {
+		id, ok := webhookID(c)
+		if !ok {
+			return
+		}
+		deliveryID, err := strconv.Atoi(c.Param("deliveryId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid delivery ID",
+			})
+			return
+		}
+
+		delivery, err := sqlClient.RedeliverWebhookDelivery(id, deliveryID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Webhook delivery not found",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to queue webhook delivery",
+				"details": err.Error(),
+			})
+			return
+		}
+		dispatcher.Wake()
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"data":    delivery,
+			"message": "Webhook delivery queued",
+		})
+	})
+}
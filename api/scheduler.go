@@ -1,46 +1,103 @@
 package main
 
 import (
-	"context"
+	"database/sql"
+	"fmt"
 	"log"
+	"math/rand"
+	"sort"
+	"sync"
 	"time"
 
+	. "dsmpartsfinder-api/models"
 	"dsmpartsfinder-api/siteclients"
 
 	"github.com/robfig/cron/v3"
 )
 
+// scheduleParser parses the cron expressions of sites, which include seconds
+var scheduleParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
 // Scheduler handles automatic scheduled tasks
 type Scheduler struct {
 	cron         *cron.Cron
 	partsService *PartsService
+	sqlClient    *SQLClient
+	jobQueue     *JobQueue
+	digests      *DigestService
+
+	mu   sync.Mutex
+	jobs map[int]*siteJob // Scheduled fetches by site ID
+}
+
+// siteJob is the scheduled fetch of one site
+type siteJob struct {
+	siteID        int
+	siteName      string
+	schedule      string
+	jitterSeconds int
+	paused        bool
+	entryID       cron.EntryID // Zero while the job is not in the cron
+	lastRun       *time.Time
 }
 
 // NewScheduler creates a new scheduler instance
-func NewScheduler(partsService *PartsService) *Scheduler {
-	// Create cron with seconds precision
-	c := cron.New(cron.WithSeconds())
+func NewScheduler(partsService *PartsService, sqlClient *SQLClient, jobQueue *JobQueue, digests *DigestService) *Scheduler {
+	c := cron.New(cron.WithParser(scheduleParser))
 
 	return &Scheduler{
 		cron:         c,
 		partsService: partsService,
+		sqlClient:    sqlClient,
+		jobQueue:     jobQueue,
+		digests:      digests,
+		jobs:         make(map[int]*siteJob),
 	}
 }
 
-// Start begins the scheduled tasks
+// Start schedules every site with a registered client on its own cron expression
 func (s *Scheduler) Start() error {
 	log.Println("[Scheduler] Setting up scheduled tasks...")
 
-	log.Println("[Scheduler] Starting startup fetch")
-	s.fetchAllParts()
-
-	_, err := s.cron.AddFunc("0 0 * * * *", func() {
-		log.Println("[Scheduler] Running scheduled hourly fetch...")
-		s.fetchAllParts()
-	})
+	sites, err := s.sqlClient.GetAllSites()
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to load site schedules: %w", err)
+	}
+	sitesByID := make(map[int]Site, len(sites))
+	for _, site := range sites {
+		sitesByID[site.ID] = site
+	}
+
+	s.mu.Lock()
+	for _, siteID := range s.partsService.GetRegisteredSiteIDs() {
+		site, exists := sitesByID[siteID]
+		if !exists {
+			continue
+		}
+		job := &siteJob{
+			siteID:        site.ID,
+			siteName:      site.Name,
+			schedule:      site.Schedule,
+			jitterSeconds: site.ScheduleJitterSeconds,
+			paused:        site.SchedulePaused,
+		}
+		s.jobs[siteID] = job
+		if job.paused {
+			log.Printf("[Scheduler] Site %d (%s) is paused", job.siteID, job.siteName)
+			continue
+		}
+		if err := s.addToCron(job); err != nil {
+			log.Printf("[Scheduler] ERROR: Not scheduling site %d (%s): %v", job.siteID, job.siteName, err)
+			continue
+		}
+		log.Printf("[Scheduler] Scheduled site %d (%s) on %q with up to %ds jitter", job.siteID, job.siteName, job.schedule, job.jitterSeconds)
 	}
+	s.mu.Unlock()
+
+	s.scheduleDigests()
+
+	log.Println("[Scheduler] Queueing startup fetch")
+	s.enqueueAllSites(FetchTriggerStartup)
 
 	// Start the cron scheduler
 	s.cron.Start()
@@ -56,94 +113,276 @@ func (s *Scheduler) Stop() {
 	log.Println("[Scheduler] Scheduler stopped")
 }
 
-// fetchAllParts fetches parts from all registered sites
-func (s *Scheduler) fetchAllParts() {
-	startTime := time.Now()
-	log.Println("[Scheduler] ========================================")
-	log.Println("[Scheduler] Starting automatic parts fetch...")
-	log.Println("[Scheduler] ========================================")
+// scheduleDigests adds the daily and weekly digests to the cron
+func (s *Scheduler) scheduleDigests() {
+	for frequency, schedule := range map[string]string{DigestDaily: dailyDigestSchedule, DigestWeekly: weeklyDigestSchedule} {
+		frequency := frequency
+		if _, err := s.cron.AddFunc(schedule, func() { s.digests.SendDue(frequency) }); err != nil {
+			log.Printf("[Scheduler] ERROR: Not scheduling the %s digest: %v", frequency, err)
+			continue
+		}
+		log.Printf("[Scheduler] Scheduled the %s digest on %q", frequency, schedule)
+	}
+}
 
-	// Get all registered site IDs
-	siteIDs := s.partsService.GetRegisteredSiteIDs()
-	if len(siteIDs) == 0 {
-		log.Println("[Scheduler] WARNING: No site clients registered")
+// addToCron adds a job to the cron, the caller must hold s.mu
+func (s *Scheduler) addToCron(job *siteJob) error {
+	siteID := job.siteID
+	entryID, err := s.cron.AddFunc(job.schedule, func() {
+		s.runScheduled(siteID)
+	})
+	if err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalidSchedule, job.schedule, err)
+	}
+	job.entryID = entryID
+	return nil
+}
+
+// removeFromCron removes a job from the cron, the caller must hold s.mu
+func (s *Scheduler) removeFromCron(job *siteJob) {
+	if job.entryID != 0 {
+		s.cron.Remove(job.entryID)
+		job.entryID = 0
+	}
+}
+
+// runScheduled waits for the jitter of a site and queues its fetch
+func (s *Scheduler) runScheduled(siteID int) {
+	s.mu.Lock()
+	job, exists := s.jobs[siteID]
+	jitterSeconds := 0
+	if exists {
+		jitterSeconds = job.jitterSeconds
+	}
+	s.mu.Unlock()
+	if !exists {
 		return
 	}
 
-	log.Printf("[Scheduler] Fetching from %d site(s): %v", len(siteIDs), siteIDs)
+	if jitterSeconds > 0 {
+		delay := time.Duration(rand.Int63n(int64(jitterSeconds) * int64(time.Second)))
+		log.Printf("[Scheduler] Delaying scheduled fetch of site %d by %v", siteID, delay.Round(time.Second))
+		time.Sleep(delay)
+	}
 
-	// Default search parameters - fetch everything
-	params := siteclients.SearchParams{
-		VehicleType: "P",
-		Make:        "Mitsubishi",
-		BaseModel:   "Eclipse",
-		Model:       "",
-		YearFrom:    1989,
-		YearTo:      2000,
-		Offset:      0,
-		Limit:       10000, // High limit to get everything
+	// The job may have been paused while waiting
+	s.mu.Lock()
+	paused := job.paused
+	s.mu.Unlock()
+	if paused {
+		return
 	}
 
-	// Track statistics with channels
-	type FetchResult struct {
-		siteID     int
-		partsCount int
-		duration   time.Duration
-		err        error
+	log.Printf("[Scheduler] Queueing scheduled fetch of site %d...", siteID)
+	if _, err := s.enqueueSite(siteID, FetchTriggerCron); err != nil {
+		log.Printf("[Scheduler] ERROR: Failed to queue scheduled fetch of site %d: %v", siteID, err)
 	}
-	results := make(chan FetchResult, len(siteIDs))
+}
 
-	// Create a context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
+// enqueueSite queues a fetch job for every enabled search profile targeting a site
+func (s *Scheduler) enqueueSite(siteID int, trigger string) ([]FetchJob, error) {
+	s.mu.Lock()
+	job, exists := s.jobs[siteID]
+	if exists {
+		now := time.Now()
+		job.lastRun = &now
+	}
+	s.mu.Unlock()
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
 
-	// Launch goroutine for each site
-	for _, siteID := range siteIDs {
-		go func(id int) {
-			siteStartTime := time.Now()
-			parts, err := s.partsService.FetchAndStoreParts(ctx, id, params)
-			results <- FetchResult{
-				siteID:     id,
-				partsCount: len(parts),
-				duration:   time.Since(siteStartTime),
-				err:        err,
-			}
-		}(siteID)
+	profiles, err := s.sqlClient.GetSearchProfiles(true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load search profiles: %w", err)
 	}
 
-	// Collect results
-	var totalParts, totalNew, totalErrors int
-	for range siteIDs {
-		result := <-results
-		if result.err != nil {
-			log.Printf("[Scheduler] ERROR: Failed to fetch from site %d: %v", result.siteID, result.err)
-			totalErrors++
+	jobs := make([]FetchJob, 0)
+	for _, profile := range profiles {
+		if !profile.TargetsSite(siteID) {
 			continue
 		}
+		fetchJob, err := s.jobQueue.Enqueue(siteID, searchParamsForProfile(profile), trigger)
+		if err != nil {
+			return jobs, err
+		}
+		jobs = append(jobs, *fetchJob)
+	}
+
+	if len(jobs) == 0 {
+		log.Printf("[Scheduler] WARNING: No enabled search profiles target site %d", siteID)
+	}
+	return jobs, nil
+}
+
+// enqueueAllSites queues the fetches of every site that is not paused
+func (s *Scheduler) enqueueAllSites(trigger string) {
+	siteIDs := make([]int, 0)
+	s.mu.Lock()
+	for siteID, job := range s.jobs {
+		if !job.paused {
+			siteIDs = append(siteIDs, siteID)
+		}
+	}
+	s.mu.Unlock()
+	if len(siteIDs) == 0 {
+		log.Println("[Scheduler] WARNING: No sites to fetch")
+		return
+	}
+	sort.Ints(siteIDs)
+
+	jobCount := 0
+	for _, siteID := range siteIDs {
+		jobs, err := s.enqueueSite(siteID, trigger)
+		if err != nil {
+			log.Printf("[Scheduler] ERROR: Failed to queue fetch of site %d: %v", siteID, err)
+		}
+		jobCount += len(jobs)
+	}
+	log.Printf("[Scheduler] Queued %d %s fetch job(s) for %d site(s): %v", jobCount, trigger, len(siteIDs), siteIDs)
+}
+
+// searchParamsForProfile converts a search profile into the params handed to site clients
+func searchParamsForProfile(profile SearchProfile) siteclients.SearchParams {
+	return siteclients.SearchParams{
+		VehicleType: profile.VehicleType,
+		Make:        profile.Make,
+		BaseModel:   profile.BaseModel,
+		Model:       profile.Model,
+		YearFrom:    profile.YearFrom,
+		YearTo:      profile.YearTo,
+		Keywords:    profile.Keywords,
+		MinPrice:    profile.MinPrice,
+		MaxPrice:    profile.MaxPrice,
+		Offset:      0,
+		Limit:       10000, // High limit to get everything
+		ProfileID:   profile.ID,
+	}
+}
+
+// entry describes a job, the caller must hold s.mu
+func (s *Scheduler) entry(job *siteJob) ScheduleEntry {
+	entry := ScheduleEntry{
+		SiteID:        job.siteID,
+		SiteName:      job.siteName,
+		Schedule:      job.schedule,
+		JitterSeconds: job.jitterSeconds,
+		Paused:        job.paused,
+		Running:       s.jobQueue.SiteRunning(job.siteID),
+		LastRun:       job.lastRun,
+	}
+	if job.entryID != 0 {
+		next := s.cron.Entry(job.entryID).Next
+		if next.IsZero() {
+			// The cron only computes next runs once it is started
+			if schedule, err := scheduleParser.Parse(job.schedule); err == nil {
+				next = schedule.Next(time.Now())
+			}
+		}
+		entry.NextRun = &next
+	}
+	return entry
+}
+
+// Entries returns the scheduled fetch of every site, ordered by site ID
+func (s *Scheduler) Entries() []ScheduleEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		totalParts += result.partsCount
-		totalNew += result.partsCount
-		log.Printf("[Scheduler] Site %d: Fetched %d new parts in %v", result.siteID, result.partsCount, result.duration)
+	entries := make([]ScheduleEntry, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		entries = append(entries, s.entry(job))
 	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].SiteID < entries[j].SiteID
+	})
+	return entries
+}
+
+// Entry returns the scheduled fetch of a site
+func (s *Scheduler) Entry(siteID int) (*ScheduleEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// Log summary
-	duration := time.Since(startTime)
-	log.Println("[Scheduler] ========================================")
-	log.Printf("[Scheduler] Fetch completed in %v", duration)
-	log.Printf("[Scheduler] Total new parts: %d", totalNew)
-	log.Printf("[Scheduler] Sites processed: %d/%d", len(siteIDs)-totalErrors, len(siteIDs))
-	if totalErrors > 0 {
-		log.Printf("[Scheduler] Errors encountered: %d", totalErrors)
+	job, exists := s.jobs[siteID]
+	if !exists {
+		return nil, sql.ErrNoRows
 	}
-	log.Println("[Scheduler] ========================================")
+	entry := s.entry(job)
+	return &entry, nil
+}
+
+// Pause stops the scheduled fetches of a site until it is resumed
+func (s *Scheduler) Pause(siteID int) (*ScheduleEntry, error) {
+	return s.update(siteID, func(state *scheduleState) {
+		state.paused = true
+	})
+}
+
+// Resume schedules the fetches of a paused site again
+func (s *Scheduler) Resume(siteID int) (*ScheduleEntry, error) {
+	return s.update(siteID, func(state *scheduleState) {
+		state.paused = false
+	})
+}
+
+// UpdateSchedule changes the cron expression and jitter of a site
+func (s *Scheduler) UpdateSchedule(siteID int, schedule string, jitterSeconds int) (*ScheduleEntry, error) {
+	return s.update(siteID, func(state *scheduleState) {
+		state.schedule = schedule
+		state.jitterSeconds = jitterSeconds
+	})
+}
+
+// scheduleState is the stored part of a siteJob
+type scheduleState struct {
+	schedule      string
+	jitterSeconds int
+	paused        bool
 }
 
-// GetNextRuns returns the next scheduled run times
-func (s *Scheduler) GetNextRuns() []time.Time {
-	entries := s.cron.Entries()
-	nextRuns := make([]time.Time, 0, len(entries))
-	for _, entry := range entries {
-		nextRuns = append(nextRuns, entry.Next)
+// update applies a change to the schedule of a site. The new schedule is validated and stored
+// before the running job changes, so a failed write leaves both as they were.
+func (s *Scheduler) update(siteID int, change func(state *scheduleState)) (*ScheduleEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, exists := s.jobs[siteID]
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	state := scheduleState{schedule: job.schedule, jitterSeconds: job.jitterSeconds, paused: job.paused}
+	change(&state)
+	if state.jitterSeconds < 0 {
+		return nil, fmt.Errorf("%w: jitter must not be negative, got %d", ErrInvalidSchedule, state.jitterSeconds)
+	}
+	if _, err := scheduleParser.Parse(state.schedule); err != nil {
+		return nil, fmt.Errorf("%w %q: %v", ErrInvalidSchedule, state.schedule, err)
+	}
+	if err := s.sqlClient.UpdateSiteSchedule(siteID, state.schedule, state.jitterSeconds, state.paused); err != nil {
+		return nil, err
+	}
+
+	job.schedule = state.schedule
+	job.jitterSeconds = state.jitterSeconds
+	job.paused = state.paused
+	s.removeFromCron(job)
+	if !job.paused {
+		// The schedule was parsed above, so adding it only fails if the cron itself breaks
+		if err := s.addToCron(job); err != nil {
+			return nil, err
+		}
 	}
-	return nextRuns
+
+	log.Printf("[Scheduler] Site %d (%s) now runs on %q with up to %ds jitter, paused: %v",
+		job.siteID, job.siteName, job.schedule, job.jitterSeconds, job.paused)
+	entry := s.entry(job)
+	return &entry, nil
+}
+
+// TriggerNow queues a fetch of a site right away, without jitter
+func (s *Scheduler) TriggerNow(siteID int) ([]FetchJob, error) {
+	log.Printf("[Scheduler] Queueing triggered fetch of site %d...", siteID)
+	return s.enqueueSite(siteID, FetchTriggerManual)
 }
@@ -3,34 +3,82 @@ package scrapers
 import (
 	"context"
 	"dsmpartsfinder-api/siteclients"
-	"encoding/base64"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
+func init() {
+	siteclients.Register("kleinanzeigen", func(opts siteclients.ClientOptions) (siteclients.SiteClient, error) {
+		var config KleinanzeigenConfig
+		if err := siteclients.DecodeConfig(opts.Config, &config); err != nil {
+			return nil, err
+		}
+		client := NewKleinanzeigenClient(opts.SiteID, config)
+		if opts.Images != nil {
+			client.images = opts.Images
+		}
+		if opts.Transport != nil {
+			client.httpClient = opts.Transport.Client()
+		}
+		return client, nil
+	})
+}
+
+// KleinanzeigenConfig holds the per-site search settings for a Kleinanzeigen client
+type KleinanzeigenConfig struct {
+	Keywords   string `json:"keywords"`
+	CategoryID string `json:"category_id"`
+	Location   string `json:"location"`
+	// SkipGallery keeps only the photo shown in the search results instead of loading the ad
+	// page of every listing with more photos
+	SkipGallery bool `json:"skip_gallery"`
+}
+
+// defaultKleinanzeigenKeywords are searched when neither the site config nor the request name
+// what to search for
+const defaultKleinanzeigenKeywords = "Mitsubishi Eclipse D30"
+
 // KleinanzeigenClient implements scraping for kleinanzeigen.de
 type KleinanzeigenClient struct {
-	baseURL    string
-	httpClient *http.Client
-	siteID     int
+	baseURL     string
+	httpClient  *http.Client
+	images      *siteclients.ImageFetcher
+	siteID      int
+	keywords    string // From the site config, searched when the request names no vehicle
+	categoryID  string
+	location    string
+	skipGallery bool
 }
 
 // NewKleinanzeigenClient creates a new Kleinanzeigen scraper client
-func NewKleinanzeigenClient(siteID int) *KleinanzeigenClient {
-	return &KleinanzeigenClient{
-		baseURL: "https://www.kleinanzeigen.de",
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		siteID: siteID,
+func NewKleinanzeigenClient(siteID int, config KleinanzeigenConfig) *KleinanzeigenClient {
+	client := &KleinanzeigenClient{
+		baseURL:     "https://www.kleinanzeigen.de",
+		httpClient:  siteclients.DefaultTransport().Client(),
+		images:      siteclients.DefaultImageFetcher(),
+		siteID:      siteID,
+		keywords:    config.Keywords,
+		categoryID:  "223", // Auto parts category
+		location:    "Deutschland",
+		skipGallery: config.SkipGallery,
+	}
+
+	if config.CategoryID != "" {
+		client.categoryID = config.CategoryID
+	}
+	if config.Location != "" {
+		client.location = config.Location
 	}
+
+	return client
 }
 
 // GetName returns the name of the site client
@@ -45,10 +93,11 @@ func (c *KleinanzeigenClient) GetSiteID() int {
 
 // FetchParts fetches parts from Kleinanzeigen based on search parameters
 // Automatically fetches all pages until no more results are found
-func (c *KleinanzeigenClient) FetchParts(ctx context.Context, params siteclients.SearchParams) ([]siteclients.Part, error) {
+func (c *KleinanzeigenClient) FetchParts(ctx context.Context, params siteclients.SearchParams) (*siteclients.FetchResult, error) {
 	log.Printf("[KleinanzeigenClient] Starting fetch with params: %+v", params)
 
 	allParts := make([]siteclients.Part, 0)
+	failedListings := 0 // Listings on the pages that could not be extracted
 	page := 1
 	maxPages := 100    // Safety limit to prevent infinite loops
 	itemsPerPage := 25 // Kleinanzeigen shows 25 items per page
@@ -64,75 +113,90 @@ func (c *KleinanzeigenClient) FetchParts(ctx context.Context, params siteclients
 
 		log.Printf("[KleinanzeigenClient] Page %d URL: %s", page, searchURL)
 
-		// Fetch the page
-		pageParts, err := c.fetchSinglePage(ctx, searchURL)
+		// Fetch the page, keeping what the earlier pages returned when a later one fails
+		pageParts, articleCount, err := c.fetchSinglePage(ctx, searchURL)
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch page %d: %w", page, err)
+			if len(allParts) == 0 {
+				return nil, fmt.Errorf("failed to fetch page %d: %w", page, err)
+			}
+			log.Printf("[KleinanzeigenClient] Warning: failed to fetch page %d, returning %d parts: %v", page, len(allParts), err)
+			return siteclients.TruncatedResult(allParts, fmt.Sprintf("failed to fetch page %d: %v", page, err)), nil
 		}
 
-		log.Printf("[KleinanzeigenClient] Page %d: got %d parts", page, len(pageParts))
+		log.Printf("[KleinanzeigenClient] Page %d: got %d parts from %d listings", page, len(pageParts), articleCount)
 
-		// If no parts found, we've reached the end
-		if len(pageParts) == 0 {
+		// If no listings found, we've reached the end
+		if articleCount == 0 {
 			log.Printf("[KleinanzeigenClient] No more parts found on page %d, stopping", page)
 			break
 		}
 
 		allParts = append(allParts, pageParts...)
+		failedListings += articleCount - len(pageParts)
+		siteclients.ReportProgress(ctx, page, len(allParts))
 
-		// If we got fewer parts than a full page, this is the last page
-		if len(pageParts) < itemsPerPage {
-			log.Printf("[KleinanzeigenClient] Got less than full page (%d < %d), this is the last page", len(pageParts), itemsPerPage)
+		// If the page has fewer listings than a full page, this is the last page. Listings that
+		// failed to extract still count, so they do not end the search early.
+		if articleCount < itemsPerPage {
+			log.Printf("[KleinanzeigenClient] Got less than full page (%d < %d), this is the last page", articleCount, itemsPerPage)
 			break
 		}
 
 		// Check if limit is set and we've reached it
 		if params.Limit > 0 && len(allParts) >= params.Limit {
 			log.Printf("[KleinanzeigenClient] Reached limit of %d parts, stopping", params.Limit)
-			allParts = allParts[:params.Limit]
-			break
+			return siteclients.TruncatedResult(allParts[:params.Limit], fmt.Sprintf("limit of %d parts reached", params.Limit)), nil
+		}
+
+		if page == maxPages {
+			log.Printf("[KleinanzeigenClient] Reached page limit of %d, stopping", maxPages)
+			return siteclients.TruncatedResult(allParts, fmt.Sprintf("page limit of %d reached", maxPages)), nil
 		}
 
 		page++
 	}
 
 	log.Printf("[KleinanzeigenClient] Finished fetching. Total parts: %d from %d page(s)", len(allParts), page)
-	return allParts, nil
+	if failedListings > 0 {
+		// The listings that failed are still online, they must not be taken for removed
+		return siteclients.TruncatedResult(allParts, fmt.Sprintf("%d listings could not be extracted", failedListings)), nil
+	}
+	return siteclients.CompleteResult(allParts), nil
 }
 
-// fetchSinglePage fetches and parses a single page
-func (c *KleinanzeigenClient) fetchSinglePage(ctx context.Context, searchURL string) ([]siteclients.Part, error) {
+// fetchSinglePage fetches and parses a single page. It returns the parts and the number of
+// listings on the page, which is higher than the parts when listings failed to extract.
+func (c *KleinanzeigenClient) fetchSinglePage(ctx context.Context, searchURL string) ([]siteclients.Part, int, error) {
 	// Fetch the page
 	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	// Set headers to mimic a browser
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36")
+	// Set headers to mimic a browser, the transport adds the User-Agent
 	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
 
 	// Execute request
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, 0, fmt.Errorf("failed to execute request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
 	// Read the response body
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, 0, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	// Parse HTML
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(bodyBytes)))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+		return nil, 0, fmt.Errorf("failed to parse HTML: %w", err)
 	}
 
 	// Initialize parts slice
@@ -143,38 +207,55 @@ func (c *KleinanzeigenClient) fetchSinglePage(ctx context.Context, searchURL str
 	articleCount := doc.Find(selector).Length()
 
 	if articleCount == 0 {
-		return parts, nil
+		return parts, 0, nil
 	}
 
 	doc.Find(selector).Each(func(i int, s *goquery.Selection) {
-		part, err := c.extractPart(ctx, s)
+		part, err := c.extractPart(s)
 		if err != nil {
 			log.Printf("[KleinanzeigenClient] Warning: failed to extract part %d: %v", i, err)
 			return
 		}
 		parts = append(parts, part)
 	})
+	c.images.FetchGalleries(ctx, c.httpClient, parts, galleryHeader, c.parseGallery)
+	c.images.FetchImages(ctx, c.httpClient, parts, nil)
 
 	log.Printf("[KleinanzeigenClient] Extracted %d parts from page", len(parts))
-	return parts, nil
+	return parts, articleCount, nil
 }
 
 // buildSearchURLWithPage constructs the search URL with parameters and page number
 func (c *KleinanzeigenClient) buildSearchURLWithPage(params siteclients.SearchParams, page int) (string, error) {
-	// Build the search keywords
-	keywords := "Mitsubishi Eclipse D30"
+	// The keywords of the requested vehicle win, then those of the site config, then the default
+	keywords := c.keywords
+	if keywords == "" {
+		keywords = defaultKleinanzeigenKeywords
+	}
+	if vehicle := siteclients.ResolveVehicle(params); vehicle != nil && vehicle.Keywords != "" {
+		keywords = vehicle.Keywords
+	}
+	keywords = siteclients.WithKeywords(keywords, params)
+
+	minPrice, maxPrice := "", ""
+	if params.MinPrice > 0 {
+		minPrice = fmt.Sprintf("%d", params.MinPrice)
+	}
+	if params.MaxPrice > 0 {
+		maxPrice = fmt.Sprintf("%d", params.MaxPrice)
+	}
 
 	// Build query parameters
 	queryParams := url.Values{}
-	queryParams.Set("categoryId", "223") // Auto parts category
+	queryParams.Set("categoryId", c.categoryID)
 	queryParams.Set("keywords", keywords)
-	queryParams.Set("locationStr", "Deutschland")
+	queryParams.Set("locationStr", c.location)
 	queryParams.Set("radius", "0")
 	queryParams.Set("sortingField", "")
 	queryParams.Set("adType", "")
 	queryParams.Set("posterType", "")
-	queryParams.Set("maxPrice", "")
-	queryParams.Set("minPrice", "")
+	queryParams.Set("maxPrice", maxPrice)
+	queryParams.Set("minPrice", minPrice)
 	queryParams.Set("buyNowEnabled", "false")
 	queryParams.Set("shippingCarrier", "")
 	queryParams.Set("shipping", "")
@@ -189,7 +270,7 @@ func (c *KleinanzeigenClient) buildSearchURLWithPage(params siteclients.SearchPa
 }
 
 // extractPart extracts part information from an article element
-func (c *KleinanzeigenClient) extractPart(ctx context.Context, s *goquery.Selection) (siteclients.Part, error) {
+func (c *KleinanzeigenClient) extractPart(s *goquery.Selection) (siteclients.Part, error) {
 	part := siteclients.Part{
 		SiteID: c.siteID,
 	}
@@ -279,53 +360,71 @@ func (c *KleinanzeigenClient) extractPart(ctx context.Context, s *goquery.Select
 
 	// part.TypeName = "Eclipse (D30)"
 
-	// Extract image URL
+	// Extract image URL, the image itself is fetched with the rest of the page
 	imgSrc, exists := s.Find(".imagebox img").Attr("src")
 	if exists && imgSrc != "" {
-		// Fetch and convert image to base64
-		imageBase64, err := c.fetchImageAsBase64(ctx, imgSrc)
-		if err != nil {
-			log.Printf("[KleinanzeigenClient] Warning: failed to fetch image for part %s: %v", adID, err)
-		} else {
-			part.ImageBase64 = imageBase64
-		}
+		part.AddImageURL(absoluteImageURL(imgSrc))
+	}
+
+	// The search results show one photo, the others are on the ad page which the image fetcher
+	// loads for new and changed listings
+	photoCount, _ := strconv.Atoi(strings.TrimSpace(s.Find(".galleryimage--counter").Text()))
+	if !c.skipGallery && photoCount > 1 {
+		part.GalleryURL = part.URL
 	}
 
 	return part, nil
 }
 
-// fetchImageAsBase64 fetches an image and returns it as base64
-func (c *KleinanzeigenClient) fetchImageAsBase64(ctx context.Context, imageURL string) (string, error) {
-	// Handle protocol-relative URLs
-	if strings.HasPrefix(imageURL, "//") {
-		imageURL = "https:" + imageURL
-	}
+// galleryHeader is sent with the requests for ad pages
+var galleryHeader = http.Header{
+	"Accept": {"text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8"},
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
+// parseGallery adds the photos on the ad page of a part after its cover. The first photo of the
+// gallery is the cover in a larger size, it is skipped.
+func (c *KleinanzeigenClient) parseGallery(part *siteclients.Part, page io.Reader) error {
+	doc, err := goquery.NewDocumentFromReader(page)
 	if err != nil {
-		return "", fmt.Errorf("failed to create image request: %w", err)
+		return fmt.Errorf("failed to parse HTML: %w", err)
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:143.0) Gecko/20100101 Firefox/143.0")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to fetch image: %w", err)
+	coverURL := ""
+	if len(part.Images) > 0 {
+		coverURL = part.Images[0].SourceURL
 	}
-	defer resp.Body.Close()
+	doc.Find(".galleryimage-element img").Each(func(i int, img *goquery.Selection) {
+		// Photos after the first are lazy loaded from data-imgsrc
+		imageURL, _ := img.Attr("data-imgsrc")
+		if imageURL == "" {
+			imageURL, _ = img.Attr("src")
+		}
+		if imageURL == "" || sameImage(absoluteImageURL(imageURL), coverURL) {
+			return
+		}
+		part.AddImageURL(absoluteImageURL(imageURL))
+	})
+	return nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code for image: %d", resp.StatusCode)
+// sameImage reports whether two photo URLs point at the same image. Kleinanzeigen serves every
+// photo in several sizes, picked by the query string.
+func sameImage(a, b string) bool {
+	if a == "" || b == "" {
+		return false
 	}
-
-	// Read image data
-	imageData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read image data: %w", err)
+	parsedA, errA := url.Parse(a)
+	parsedB, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return a == b
 	}
+	return parsedA.Host == parsedB.Host && parsedA.Path == parsedB.Path
+}
 
-	// Convert to base64
-	base64String := base64.StdEncoding.EncodeToString(imageData)
-
-	return base64String, nil
+// absoluteImageURL adds the scheme to protocol-relative image URLs
+func absoluteImageURL(imageURL string) string {
+	if strings.HasPrefix(imageURL, "//") {
+		return "https:" + imageURL
+	}
+	return imageURL
 }
@@ -0,0 +1,69 @@
+package scrapers
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"dsmpartsfinder-api/siteclients"
+)
+
+// seededKleinanzeigenConfig is the config the migrations give the default Kleinanzeigen site
+const seededKleinanzeigenConfig = `{"keywords": "Mitsubishi Eclipse D30", "category_id": "223", "location": "Deutschland"}`
+
+func newSeededKleinanzeigenClient(t *testing.T) *KleinanzeigenClient {
+	t.Helper()
+	client, err := siteclients.NewClient("kleinanzeigen", siteclients.ClientOptions{SiteID: 2, Config: json.RawMessage(seededKleinanzeigenConfig)})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client.(*KleinanzeigenClient)
+}
+
+func TestKleinanzeigenSearchKeywords(t *testing.T) {
+	client := newSeededKleinanzeigenClient(t)
+
+	tests := []struct {
+		name   string
+		params siteclients.SearchParams
+		want   string
+	}{
+		{"no vehicle uses the config", siteclients.SearchParams{}, "Mitsubishi Eclipse D30"},
+		{"galant", siteclients.SearchParams{Make: "Mitsubishi", BaseModel: "Galant", Model: "VR-4"}, "Galant VR4"},
+		{"talon", siteclients.SearchParams{Make: "Eagle", BaseModel: "Talon", Model: "2G"}, "Eagle Talon"},
+		{"laser base model", siteclients.SearchParams{Make: "Plymouth", BaseModel: "Laser"}, "Plymouth Laser"},
+		{"extra keywords", siteclients.SearchParams{Make: "Mitsubishi", BaseModel: "Galant", Model: "VR-4", Keywords: "Turbo"}, "Galant VR4 Turbo"},
+		{"unknown vehicle", siteclients.SearchParams{Make: "Nissan", BaseModel: "Skyline"}, "Nissan Skyline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searchURL, err := client.buildSearchURLWithPage(tt.params, 1)
+			if err != nil {
+				t.Fatalf("buildSearchURLWithPage: %v", err)
+			}
+			parsed, err := url.Parse(searchURL)
+			if err != nil {
+				t.Fatalf("invalid search URL %q: %v", searchURL, err)
+			}
+			query := parsed.Query()
+			if got := query.Get("keywords"); got != tt.want {
+				t.Errorf("keywords = %q, want %q", got, tt.want)
+			}
+			if query.Get("categoryId") != "223" || query.Has("pageNum") {
+				t.Errorf("unexpected query %v", query)
+			}
+		})
+	}
+}
+
+func TestKleinanzeigenSearchURLPage(t *testing.T) {
+	searchURL, err := newSeededKleinanzeigenClient(t).buildSearchURLWithPage(siteclients.SearchParams{MinPrice: 50, MaxPrice: 300}, 3)
+	if err != nil {
+		t.Fatalf("buildSearchURLWithPage: %v", err)
+	}
+	parsed, _ := url.Parse(searchURL)
+	query := parsed.Query()
+	if query.Get("pageNum") != "3" || query.Get("minPrice") != "50" || query.Get("maxPrice") != "300" {
+		t.Errorf("unexpected query %v", query)
+	}
+}
@@ -0,0 +1,487 @@
+package scrapers
+
+import (
+	"context"
+	"dsmpartsfinder-api/siteclients"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func init() {
+	siteclients.Register("html", func(opts siteclients.ClientOptions) (siteclients.SiteClient, error) {
+		var config SelectorClientConfig
+		if err := siteclients.DecodeConfig(opts.Config, &config); err != nil {
+			return nil, err
+		}
+
+		spec := config.Spec
+		if spec == nil {
+			if config.SpecFile == "" {
+				return nil, fmt.Errorf("html client needs either spec or spec_file in its config")
+			}
+			loaded, err := LoadSelectorSpec(config.SpecFile)
+			if err != nil {
+				return nil, err
+			}
+			spec = loaded
+		}
+
+		client, err := NewSelectorClient(opts.SiteID, spec)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Images != nil {
+			client.images = opts.Images
+		}
+		if opts.Transport != nil {
+			client.httpClient = opts.Transport.Client()
+		}
+		return client, nil
+	})
+}
+
+// SelectorClientConfig is the site config blob for the "html" client type.
+// The spec can be stored inline on the sites row or loaded from a file.
+type SelectorClientConfig struct {
+	SpecFile string        `json:"spec_file"`
+	Spec     *SelectorSpec `json:"spec"`
+}
+
+// SelectorSpec describes how to turn a classifieds search page into parts
+type SelectorSpec struct {
+	// Name is the human readable name of the site
+	Name string `json:"name"`
+	// BaseURL is used to resolve relative links and image sources
+	BaseURL string `json:"base_url"`
+	// SearchURL is the search page URL. {keywords} is replaced with the URL-escaped keywords.
+	SearchURL string `json:"search_url"`
+	// Keywords is the default search text for {keywords}
+	Keywords string `json:"keywords"`
+	// Headers are extra request headers, e.g. a User-Agent or Accept-Language
+	Headers map[string]string `json:"headers"`
+	// Listing selects one element per ad on the search page
+	Listing string `json:"listing"`
+	// Fields maps part fields (id, url, name, description, price, currency, shipping_cost, type_name, image, images,
+	// creation_date) to how they are extracted relative to a listing element. images collects every match, after image.
+	Fields map[string]FieldSpec `json:"fields"`
+	// DateFormats are Go time layouts tried in order for creation_date
+	DateFormats []string `json:"date_formats"`
+	// RelativeDates maps prefixes such as "Heute, " to a day offset, the remainder is parsed as HH:MM
+	RelativeDates map[string]int `json:"relative_dates"`
+	// Pagination controls how further result pages are requested
+	Pagination PaginationSpec `json:"pagination"`
+}
+
+// FieldSpec describes how a single value is extracted from a listing element
+type FieldSpec struct {
+	// Selector is relative to the listing element; empty means the listing element itself
+	Selector string `json:"selector"`
+	// Attr reads an attribute instead of the element text
+	Attr string `json:"attr"`
+	// Pattern is an optional regular expression; the first capture group (or whole match) is kept
+	Pattern string `json:"pattern"`
+	// Required drops the listing when the value is empty, the result is then truncated
+	Required bool `json:"required"`
+
+	pattern *regexp.Regexp
+}
+
+// PaginationSpec describes the next-page rules of a search page
+type PaginationSpec struct {
+	// Param is the query parameter carrying the page number, e.g. "pageNum"
+	Param string `json:"param"`
+	// NextSelector selects a "next page" link to follow instead of counting pages
+	NextSelector string `json:"next_selector"`
+	// StartPage is the number of the first page (default 1)
+	StartPage int `json:"start_page"`
+	// MaxPages is a safety limit on the number of pages fetched (default 50)
+	MaxPages int `json:"max_pages"`
+	// PageSize stops paging once a page returns fewer listings than this
+	PageSize int `json:"page_size"`
+}
+
+// LoadSelectorSpec reads a selector spec from a JSON file
+func LoadSelectorSpec(path string) (*SelectorSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read selector spec %s: %w", path, err)
+	}
+
+	var spec SelectorSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse selector spec %s: %w", path, err)
+	}
+	return &spec, nil
+}
+
+// validate checks the spec and compiles the field patterns
+func (spec *SelectorSpec) validate() error {
+	if spec.SearchURL == "" {
+		return fmt.Errorf("selector spec is missing search_url")
+	}
+	if spec.Listing == "" {
+		return fmt.Errorf("selector spec is missing listing selector")
+	}
+	if _, ok := spec.Fields["id"]; !ok {
+		return fmt.Errorf("selector spec is missing the id field")
+	}
+	if _, ok := spec.Fields["name"]; !ok {
+		return fmt.Errorf("selector spec is missing the name field")
+	}
+
+	for name, field := range spec.Fields {
+		if field.Pattern == "" {
+			continue
+		}
+		pattern, err := regexp.Compile(field.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern for field %s: %w", name, err)
+		}
+		field.pattern = pattern
+		spec.Fields[name] = field
+	}
+
+	if spec.Pagination.StartPage == 0 {
+		spec.Pagination.StartPage = 1
+	}
+	if spec.Pagination.MaxPages == 0 {
+		spec.Pagination.MaxPages = 50
+	}
+	return nil
+}
+
+// SelectorClient implements the SiteClient interface for any classifieds site described by a SelectorSpec
+type SelectorClient struct {
+	spec       *SelectorSpec
+	httpClient *http.Client
+	images     *siteclients.ImageFetcher
+	siteID     int
+}
+
+// NewSelectorClient creates a new selector driven scraper client
+func NewSelectorClient(siteID int, spec *SelectorSpec) (*SelectorClient, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+
+	return &SelectorClient{
+		spec:       spec,
+		httpClient: siteclients.DefaultTransport().Client(),
+		images:     siteclients.DefaultImageFetcher(),
+		siteID:     siteID,
+	}, nil
+}
+
+// GetName returns the name of the site client
+func (c *SelectorClient) GetName() string {
+	if c.spec.Name != "" {
+		return c.spec.Name
+	}
+	return "HTML"
+}
+
+// GetSiteID returns the database ID of the site
+func (c *SelectorClient) GetSiteID() int {
+	return c.siteID
+}
+
+// FetchParts fetches parts by walking the search result pages described by the spec
+func (c *SelectorClient) FetchParts(ctx context.Context, params siteclients.SearchParams) (*siteclients.FetchResult, error) {
+	log.Printf("[SelectorClient:%s] Starting fetch with params: %+v", c.GetName(), params)
+
+	allParts := make([]siteclients.Part, 0)
+	pagination := c.spec.Pagination
+	page := pagination.StartPage
+
+	// Search for the requested vehicle, falling back to the keywords in the spec
+	keywords := c.spec.Keywords
+	if vehicle := siteclients.ResolveVehicle(params); vehicle != nil {
+		keywords = vehicle.SearchText()
+	}
+	keywords = siteclients.WithKeywords(keywords, params)
+	pageURL := c.buildSearchURL(keywords, page)
+	pagesFetched := 0
+	failedListings := 0 // Listings on the pages that could not be extracted
+
+	for pageURL != "" {
+		if pagesFetched == pagination.MaxPages {
+			return siteclients.TruncatedResult(allParts, fmt.Sprintf("page limit of %d reached", pagination.MaxPages)), nil
+		}
+
+		log.Printf("[SelectorClient:%s] Fetching page %d: %s", c.GetName(), page, pageURL)
+
+		doc, err := c.fetchDocument(ctx, pageURL)
+		if err != nil {
+			if len(allParts) == 0 {
+				return nil, fmt.Errorf("failed to fetch page %d: %w", page, err)
+			}
+			log.Printf("[SelectorClient:%s] Warning: failed to fetch page %d, returning %d parts: %v", c.GetName(), page, len(allParts), err)
+			return siteclients.TruncatedResult(allParts, fmt.Sprintf("failed to fetch page %d: %v", page, err)), nil
+		}
+		pagesFetched++
+
+		pageParts, listingCount := c.extractParts(ctx, doc, pageURL)
+		log.Printf("[SelectorClient:%s] Page %d: got %d parts from %d listings", c.GetName(), page, len(pageParts), listingCount)
+
+		if listingCount == 0 {
+			break
+		}
+		allParts = append(allParts, pageParts...)
+		failedListings += listingCount - len(pageParts)
+		siteclients.ReportProgress(ctx, pagesFetched, len(allParts))
+
+		if params.Limit > 0 && len(allParts) >= params.Limit {
+			return siteclients.TruncatedResult(allParts[:params.Limit], fmt.Sprintf("limit of %d parts reached", params.Limit)), nil
+		}
+		// Listings that failed to extract still count, so they do not end the search early
+		if pagination.PageSize > 0 && listingCount < pagination.PageSize {
+			break
+		}
+
+		page++
+		pageURL = c.nextPageURL(doc, pageURL, keywords, page)
+	}
+
+	log.Printf("[SelectorClient:%s] Finished fetching. Total parts: %d from %d page(s)", c.GetName(), len(allParts), pagesFetched)
+	if failedListings > 0 {
+		// The listings that failed are still online, they must not be taken for removed
+		return siteclients.TruncatedResult(allParts, fmt.Sprintf("%d listings could not be extracted", failedListings)), nil
+	}
+	return siteclients.CompleteResult(allParts), nil
+}
+
+// buildSearchURL fills in the search URL template and page parameter
+func (c *SelectorClient) buildSearchURL(keywords string, page int) string {
+	searchURL := strings.ReplaceAll(c.spec.SearchURL, "{keywords}", url.QueryEscape(keywords))
+
+	param := c.spec.Pagination.Param
+	if param == "" || page == c.spec.Pagination.StartPage {
+		return searchURL
+	}
+
+	parsed, err := url.Parse(searchURL)
+	if err != nil {
+		return searchURL
+	}
+	query := parsed.Query()
+	query.Set(param, fmt.Sprintf("%d", page))
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// nextPageURL returns the URL of the next page or an empty string when there is none
+func (c *SelectorClient) nextPageURL(doc *goquery.Document, currentURL, keywords string, page int) string {
+	pagination := c.spec.Pagination
+	if pagination.NextSelector != "" {
+		href, exists := doc.Find(pagination.NextSelector).First().Attr("href")
+		if !exists || href == "" {
+			return ""
+		}
+		return c.resolveURL(currentURL, href)
+	}
+	if pagination.Param != "" {
+		return c.buildSearchURL(keywords, page)
+	}
+	return ""
+}
+
+// fetchDocument downloads and parses a single HTML page
+func (c *SelectorClient) fetchDocument(ctx context.Context, pageURL string) (*goquery.Document, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
+	for key, value := range c.spec.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+	return doc, nil
+}
+
+// extractParts extracts all listings on a page, skipping the ones that fail. It returns the parts
+// and the number of listings on the page, which is higher than the parts when listings failed.
+func (c *SelectorClient) extractParts(ctx context.Context, doc *goquery.Document, pageURL string) ([]siteclients.Part, int) {
+	parts := make([]siteclients.Part, 0)
+	listings := doc.Find(c.spec.Listing)
+	listings.Each(func(i int, s *goquery.Selection) {
+		part, err := c.extractPart(s, pageURL)
+		if err != nil {
+			log.Printf("[SelectorClient:%s] Warning: failed to extract part %d: %v", c.GetName(), i, err)
+			return
+		}
+		parts = append(parts, part)
+	})
+	c.images.FetchImages(ctx, c.httpClient, parts, nil)
+	return parts, listings.Length()
+}
+
+// extractPart maps a listing element to a part using the field specs
+func (c *SelectorClient) extractPart(s *goquery.Selection, pageURL string) (siteclients.Part, error) {
+	values := make(map[string]string, len(c.spec.Fields))
+	for name, field := range c.spec.Fields {
+		value := extractField(s, field)
+		if value == "" && field.Required {
+			return siteclients.Part{}, fmt.Errorf("missing %s", name)
+		}
+		values[name] = value
+	}
+
+	if values["id"] == "" {
+		return siteclients.Part{}, fmt.Errorf("missing id")
+	}
+	if values["name"] == "" {
+		return siteclients.Part{}, fmt.Errorf("missing name")
+	}
+
+	part := siteclients.Part{
+		ID:           values["id"],
+		Name:         values["name"],
+		Description:  values["description"],
+		TypeName:     values["type_name"],
+		Price:        values["price"],
+		Currency:     values["currency"],
+		ShippingCost: values["shipping_cost"],
+		SiteID:       c.siteID,
+	}
+
+	if values["url"] != "" {
+		part.URL = c.resolveURL(pageURL, values["url"])
+	}
+
+	if dateText := values["creation_date"]; dateText != "" {
+		creationDate, ok := c.parseDate(dateText)
+		if ok {
+			part.CreationDate = creationDate
+		} else {
+			log.Printf("[SelectorClient:%s] WARNING: Could not parse date text '%s'", c.GetName(), dateText)
+		}
+	}
+
+	imageURLs := make([]string, 0)
+	if imageURL := values["image"]; imageURL != "" {
+		imageURLs = append(imageURLs, imageURL)
+	}
+	if field, ok := c.spec.Fields["images"]; ok {
+		imageURLs = append(imageURLs, extractAllFields(s, field)...)
+	}
+	for _, imageURL := range imageURLs {
+		part.AddImageURL(c.resolveURL(pageURL, imageURL))
+	}
+
+	return part, nil
+}
+
+// extractField reads a single value from a listing element
+func extractField(s *goquery.Selection, field FieldSpec) string {
+	target := s
+	if field.Selector != "" {
+		target = s.Find(field.Selector).First()
+	}
+
+	var value string
+	if field.Attr != "" {
+		value, _ = target.Attr(field.Attr)
+	} else {
+		value = target.Text()
+	}
+	value = strings.Join(strings.Fields(value), " ")
+
+	if field.pattern != nil {
+		match := field.pattern.FindStringSubmatch(value)
+		switch {
+		case match == nil:
+			value = ""
+		case len(match) > 1:
+			value = strings.TrimSpace(match[1])
+		default:
+			value = strings.TrimSpace(match[0])
+		}
+	}
+
+	return value
+}
+
+// extractAllFields extracts the value of every element the field selector matches, skipping
+// empty values
+func extractAllFields(s *goquery.Selection, field FieldSpec) []string {
+	targets := s
+	if field.Selector != "" {
+		targets = s.Find(field.Selector)
+	}
+
+	values := make([]string, 0)
+	targets.Each(func(i int, target *goquery.Selection) {
+		if value := extractField(target, FieldSpec{Attr: field.Attr, pattern: field.pattern}); value != "" {
+			values = append(values, value)
+		}
+	})
+	return values
+}
+
+// parseDate parses a listing date using the relative date prefixes and the configured layouts
+func (c *SelectorClient) parseDate(dateText string) (time.Time, bool) {
+	now := time.Now()
+
+	for prefix, dayOffset := range c.spec.RelativeDates {
+		if !strings.HasPrefix(dateText, prefix) {
+			continue
+		}
+		day := now.AddDate(0, 0, dayOffset)
+		clock, err := time.Parse("15:04", strings.TrimSpace(strings.TrimPrefix(dateText, prefix)))
+		if err != nil {
+			return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, now.Location()), true
+		}
+		return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location()), true
+	}
+
+	for _, layout := range c.spec.DateFormats {
+		if t, err := time.Parse(layout, dateText); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// resolveURL resolves a possibly relative link against the page URL or configured base URL
+func (c *SelectorClient) resolveURL(pageURL, ref string) string {
+	base := c.spec.BaseURL
+	if base == "" {
+		base = pageURL
+	}
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return baseURL.ResolveReference(refURL).String()
+}
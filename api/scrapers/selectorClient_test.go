@@ -0,0 +1,309 @@
+package scrapers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"dsmpartsfinder-api/siteclients"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestSelectorSpecValidate(t *testing.T) {
+	fields := map[string]FieldSpec{"id": {Attr: "data-id"}, "name": {Selector: "h3"}}
+
+	tests := []struct {
+		name    string
+		spec    SelectorSpec
+		wantErr string
+	}{
+		{"valid", SelectorSpec{SearchURL: "https://example.com/?q={keywords}", Listing: "li", Fields: fields}, ""},
+		{"missing search_url", SelectorSpec{Listing: "li", Fields: fields}, "search_url"},
+		{"missing listing", SelectorSpec{SearchURL: "https://example.com", Fields: fields}, "listing"},
+		{"missing id", SelectorSpec{SearchURL: "https://example.com", Listing: "li", Fields: map[string]FieldSpec{"name": {}}}, "id field"},
+		{"missing name", SelectorSpec{SearchURL: "https://example.com", Listing: "li", Fields: map[string]FieldSpec{"id": {}}}, "name field"},
+		{"invalid pattern", SelectorSpec{SearchURL: "https://example.com", Listing: "li", Fields: map[string]FieldSpec{"id": {}, "name": {}, "price": {Pattern: "("}}}, "pattern for field price"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.spec.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate: %v", err)
+				}
+				if tt.spec.Pagination.StartPage != 1 || tt.spec.Pagination.MaxPages != 50 {
+					t.Errorf("pagination defaults = %+v, want start page 1 and 50 pages", tt.spec.Pagination)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validate = %v, want an error about %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSelectorExtractPart(t *testing.T) {
+	fixture, err := os.Open("testdata/selectorListings.html")
+	if err != nil {
+		t.Fatalf("open fixture: %v", err)
+	}
+	defer fixture.Close()
+	doc, err := goquery.NewDocumentFromReader(fixture)
+	if err != nil {
+		t.Fatalf("parse fixture: %v", err)
+	}
+
+	client, err := NewSelectorClient(1, &SelectorSpec{
+		BaseURL:   "https://www.example.com",
+		SearchURL: "https://www.example.com/search?q={keywords}",
+		Listing:   "li.ad",
+		Fields: map[string]FieldSpec{
+			"id":            {Attr: "data-id"},
+			"name":          {Selector: ".title"},
+			"url":           {Selector: "a.title", Attr: "href", Required: true},
+			"description":   {Selector: ".desc"},
+			"price":         {Selector: ".price", Pattern: `(\d+(?:,\d+)?)`},
+			"creation_date": {Selector: ".date"},
+			"image":         {Selector: "img.cover", Attr: "src"},
+			"images":        {Selector: ".thumbs img", Attr: "src"},
+		},
+		DateFormats:   []string{"02.01.2006"},
+		RelativeDates: map[string]int{"Heute, ": 0},
+	})
+	if err != nil {
+		t.Fatalf("NewSelectorClient: %v", err)
+	}
+
+	now := time.Now()
+	tests := []struct {
+		name    string
+		wantErr bool
+		want    siteclients.Part
+		images  []string
+	}{
+		{
+			name: "all fields",
+			want: siteclients.Part{
+				ID: "a1", Name: "Turbo TD05H", Description: "Used, 50k km", Price: "250,00",
+				URL: "https://www.example.com/ad/a1", CreationDate: time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC),
+			},
+			images: []string{"https://www.example.com/img/a1-1.jpg", "https://www.example.com/img/a1-2.jpg", "https://cdn.example.com/a1-3.jpg"},
+		},
+		{
+			name: "relative date and unmatched pattern",
+			want: siteclients.Part{
+				ID: "a2", Name: "Intercooler", URL: "https://other.example.com/ad/a2",
+				CreationDate: time.Date(now.Year(), now.Month(), now.Day(), 9, 30, 0, 0, now.Location()),
+			},
+		},
+		{name: "missing name", wantErr: true},
+		{name: "missing id", wantErr: true},
+		{name: "missing required url", wantErr: true},
+		{
+			name: "unparsable date",
+			want: siteclients.Part{ID: "a6", Name: "Hood", URL: "https://www.example.com/ad/a6"},
+		},
+	}
+
+	listings := doc.Find(client.spec.Listing)
+	if listings.Length() != len(tests) {
+		t.Fatalf("fixture has %d listings, want %d", listings.Length(), len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			part, err := client.extractPart(listings.Eq(i), "https://www.example.com/search")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("extractPart = %+v, want an error", part)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractPart: %v", err)
+			}
+
+			if part.ID != tt.want.ID || part.Name != tt.want.Name || part.Description != tt.want.Description ||
+				part.Price != tt.want.Price || part.URL != tt.want.URL || part.SiteID != 1 {
+				t.Errorf("part = %+v, want %+v", part, tt.want)
+			}
+			if !part.CreationDate.Equal(tt.want.CreationDate) {
+				t.Errorf("creation date = %v, want %v", part.CreationDate, tt.want.CreationDate)
+			}
+			if len(part.Images) != len(tt.images) {
+				t.Fatalf("images = %+v, want %v", part.Images, tt.images)
+			}
+			for j, image := range part.Images {
+				if image.SourceURL != tt.images[j] {
+					t.Errorf("image %d = %s, want %s", j, image.SourceURL, tt.images[j])
+				}
+			}
+		})
+	}
+}
+
+// listingsHTML renders a search result page with a listing per ID; an empty ID renders a listing
+// without one. A non-empty next adds a next page link.
+func listingsHTML(next string, ids ...string) string {
+	var page strings.Builder
+	page.WriteString("<html><body><ul>")
+	for _, id := range ids {
+		if id == "" {
+			page.WriteString(`<li class="ad"><a class="title" href="/ad/none">No ID</a></li>`)
+			continue
+		}
+		fmt.Fprintf(&page, `<li class="ad" data-id="%s"><a class="title" href="/ad/%s">Part %s</a></li>`, id, id, id)
+	}
+	page.WriteString("</ul>")
+	if next != "" {
+		fmt.Fprintf(&page, `<a class="next" href="%s">Next</a>`, next)
+	}
+	page.WriteString("</body></html>")
+	return page.String()
+}
+
+func TestSelectorFetchPartsPagination(t *testing.T) {
+	tests := []struct {
+		name         string
+		pagination   PaginationSpec
+		limit        int
+		pages        map[string]string // Page by page parameter, missing pages answer 404
+		wantErr      bool
+		wantParts    int
+		wantComplete bool
+		wantRequests int
+	}{
+		{
+			name:       "page without listings ends",
+			pagination: PaginationSpec{Param: "page"},
+			pages: map[string]string{
+				"1": listingsHTML("", "a", "b"),
+				"2": listingsHTML("", "c", "d"),
+				"3": listingsHTML(""),
+			},
+			wantParts: 4, wantComplete: true, wantRequests: 3,
+		},
+		{
+			name:       "short page ends",
+			pagination: PaginationSpec{Param: "page", PageSize: 2},
+			pages: map[string]string{
+				"1": listingsHTML("", "a", "b"),
+				"2": listingsHTML("", "c"),
+			},
+			wantParts: 3, wantComplete: true, wantRequests: 2,
+		},
+		{
+			name:       "failed listing counts towards the page size and truncates",
+			pagination: PaginationSpec{Param: "page", PageSize: 2},
+			pages: map[string]string{
+				"1": listingsHTML("", "a", ""),
+				"2": listingsHTML("", "c", "d"),
+				"3": listingsHTML("", "e"),
+			},
+			wantParts: 4, wantComplete: false, wantRequests: 3,
+		},
+		{
+			name:       "page limit truncates",
+			pagination: PaginationSpec{Param: "page", MaxPages: 2},
+			pages: map[string]string{
+				"1": listingsHTML("", "a"),
+				"2": listingsHTML("", "b"),
+				"3": listingsHTML("", "c"),
+			},
+			wantParts: 2, wantComplete: false, wantRequests: 2,
+		},
+		{
+			name:       "part limit truncates",
+			pagination: PaginationSpec{Param: "page"},
+			limit:      3,
+			pages: map[string]string{
+				"1": listingsHTML("", "a", "b"),
+				"2": listingsHTML("", "c", "d"),
+			},
+			wantParts: 3, wantComplete: false, wantRequests: 2,
+		},
+		{
+			name:       "next link is followed until there is none",
+			pagination: PaginationSpec{NextSelector: "a.next"},
+			pages: map[string]string{
+				"1": listingsHTML("/search?page=2", "a"),
+				"2": listingsHTML("", "b"),
+			},
+			wantParts: 2, wantComplete: true, wantRequests: 2,
+		},
+		{
+			name:       "failed later page truncates",
+			pagination: PaginationSpec{Param: "page"},
+			pages: map[string]string{
+				"1": listingsHTML("", "a", "b"),
+			},
+			wantParts: 2, wantComplete: false, wantRequests: 2,
+		},
+		{
+			name:       "failed first page is an error",
+			pagination: PaginationSpec{Param: "page"},
+			pages:      map[string]string{},
+			wantErr:    true, wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				page := r.URL.Query().Get("page")
+				if page == "" {
+					page = "1"
+				}
+				body, ok := tt.pages[page]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				fmt.Fprint(w, body)
+			}))
+			defer server.Close()
+
+			client, err := NewSelectorClient(1, &SelectorSpec{
+				SearchURL: server.URL + "/search?q={keywords}",
+				Listing:   "li.ad",
+				Fields: map[string]FieldSpec{
+					"id":   {Attr: "data-id"},
+					"name": {Selector: ".title"},
+					"url":  {Selector: "a.title", Attr: "href"},
+				},
+				Pagination: tt.pagination,
+			})
+			if err != nil {
+				t.Fatalf("NewSelectorClient: %v", err)
+			}
+			client.httpClient = server.Client()
+
+			result, err := client.FetchParts(context.Background(), siteclients.SearchParams{Limit: tt.limit})
+			if requests != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", requests, tt.wantRequests)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("FetchParts = %+v, want an error", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FetchParts: %v", err)
+			}
+			if len(result.Parts) != tt.wantParts {
+				t.Errorf("got %d parts, want %d", len(result.Parts), tt.wantParts)
+			}
+			if result.Complete != tt.wantComplete {
+				t.Errorf("complete = %v (%s), want %v", result.Complete, result.Reason, tt.wantComplete)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package siteclients
 
 import (
 	"context"
+	"strings"
 	"time"
 )
 
@@ -11,11 +12,77 @@ type Part struct {
 	Description  string    `json:"description"`
 	TypeName     string    `json:"type_name"`
 	Name         string    `json:"name"`
-	ImageBase64  string    `json:"image_base64"`
+	ImageBase64  string    `json:"image_base64"` // The cover image, the first of Images when a client sets them
+	Images       []Image   `json:"images,omitempty"`
 	URL          string    `json:"url"`
 	SiteID       int       `json:"site_id"`
 	Price        string    `json:"price"`
+	Currency     string    `json:"currency,omitempty"`      // ISO currency of Price when the site reports it separately
+	ShippingCost string    `json:"shipping_cost,omitempty"` // Shipping cost text when the site reports it separately
 	CreationDate time.Time `json:"creation_date"`
+
+	// GalleryURL is a page with more photos of the listing. Clients set it instead of loading the
+	// page themselves, ImageFetcher.FetchGalleries loads it.
+	GalleryURL string `json:"-"`
+	// GalleryIncomplete is set when photos of the listing could not be fetched or its gallery
+	// page was not loaded again. A stored gallery is kept then rather than taken for an edit.
+	GalleryIncomplete bool `json:"-"`
+}
+
+// MaxImagesPerPart is how many photos of a listing are kept
+const MaxImagesPerPart = 20
+
+// Image is a photo of a listing. Site clients queue it by SourceURL with AddImageURL and the
+// ImageFetcher fills in Base64, or Hash when the photo is stored already.
+type Image struct {
+	SourceURL string `json:"source_url,omitempty"` // Where the site serves the image
+	Base64    string `json:"base64,omitempty"`
+	Hash      string `json:"hash,omitempty"` // SHA-256 of an image the image store already holds
+}
+
+// AddImageURL queues a photo of a part for the ImageFetcher, in the order the site shows them.
+// The first photo becomes the cover. Repeated URLs and photos beyond MaxImagesPerPart are dropped.
+func (p *Part) AddImageURL(sourceURL string) {
+	if sourceURL == "" || len(p.Images) >= MaxImagesPerPart {
+		return
+	}
+	for _, image := range p.Images {
+		if image.SourceURL == sourceURL {
+			return
+		}
+	}
+	p.Images = append(p.Images, Image{SourceURL: sourceURL})
+}
+
+// dropMissingImages removes photos that could not be fetched and marks the gallery incomplete,
+// the first remaining one becomes the cover
+func (p *Part) dropMissingImages() {
+	kept := p.Images[:0]
+	for _, image := range p.Images {
+		if image.Base64 != "" || image.Hash != "" {
+			kept = append(kept, image)
+		} else {
+			p.GalleryIncomplete = true
+		}
+	}
+	p.Images = kept
+	if len(p.Images) == 0 {
+		p.Images = nil
+		return
+	}
+	p.ImageBase64 = p.Images[0].Base64
+}
+
+// Gallery returns the photos of a part in order. A part that only has a cover image, such as one
+// pushed by an older scraper, has a gallery of just that image.
+func (p *Part) Gallery() []Image {
+	if len(p.Images) > 0 {
+		return p.Images
+	}
+	if p.ImageBase64 != "" {
+		return []Image{{Base64: p.ImageBase64}}
+	}
+	return nil
 }
 
 // SearchParams represents the search parameters for finding parts
@@ -26,8 +93,42 @@ type SearchParams struct {
 	Model       string
 	YearFrom    int
 	YearTo      int
+	Keywords    string // Extra search text added to the vehicle query
+	MinPrice    int    // Minimum price in whole euros, 0 means no minimum
+	MaxPrice    int    // Maximum price in whole euros, 0 means no maximum
 	Offset      int
 	Limit       int
+	ProfileID   int // Search profile these params came from, 0 for ad-hoc searches
+}
+
+// joinSearchText joins search text fragments, skipping empty ones
+func joinSearchText(parts ...string) string {
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
+
+// FetchResult is the outcome of a FetchParts call
+type FetchResult struct {
+	Parts []Part
+	// Complete is set when Parts holds every listing matching the search. Listings that
+	// were not found are only aged out after complete results.
+	Complete bool
+	// Reason explains why the result is incomplete, e.g. "page limit of 100 reached"
+	Reason string
+}
+
+// CompleteResult returns a result holding every listing matching the search
+func CompleteResult(parts []Part) *FetchResult {
+	return &FetchResult{Parts: parts, Complete: true}
+}
+
+// TruncatedResult returns a result that is missing listings for the given reason
+func TruncatedResult(parts []Part, reason string) *FetchResult {
+	return &FetchResult{Parts: parts, Reason: reason}
+}
+
+// Truncated reports whether listings may be missing from the result
+func (r *FetchResult) Truncated() bool {
+	return !r.Complete
 }
 
 // SiteClient defines the interface that all site clients must implement
@@ -36,7 +137,7 @@ type SiteClient interface {
 	GetName() string
 
 	// FetchParts fetches parts from the site based on search parameters
-	FetchParts(ctx context.Context, params SearchParams) ([]Part, error)
+	FetchParts(ctx context.Context, params SearchParams) (*FetchResult, error)
 
 	// GetSiteID returns the database ID of the site this client represents
 	GetSiteID() int
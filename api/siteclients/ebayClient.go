@@ -9,6 +9,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 )
@@ -24,6 +25,9 @@ const (
 	prodSearchURL = "https://api.ebay.com/buy/browse/v1/item_summary/search"
 )
 
+// ebayMaxResults is the highest offset plus limit the Browse API search accepts
+const ebayMaxResults = 10000
+
 // TokenResponse represents the OAuth token response
 type TokenResponse struct {
 	AccessToken string `json:"access_token"`
@@ -45,12 +49,35 @@ type EbayItem struct {
 		Value    string `json:"value"`
 		Currency string `json:"currency"`
 	} `json:"price"`
-	Condition       string    `json:"condition"`
-	ItemWebURL      string    `json:"itemWebUrl"`
-	ItemOriginDate  time.Time `json:"itemOriginDate"`
-	ThumbnailImages []struct {
-		ImageURL string `json:"imageUrl"`
-	} `json:"thumbnailImages"`
+	ShippingOptions []struct {
+		ShippingCost struct {
+			Value    string `json:"value"`
+			Currency string `json:"currency"`
+		} `json:"shippingCost"`
+	} `json:"shippingOptions"`
+	Condition        string      `json:"condition"`
+	ItemWebURL       string      `json:"itemWebUrl"`
+	ItemOriginDate   time.Time   `json:"itemOriginDate"`
+	ThumbnailImages  []ebayImage `json:"thumbnailImages"`
+	AdditionalImages []ebayImage `json:"additionalImages"`
+}
+
+type ebayImage struct {
+	ImageURL string `json:"imageUrl"`
+}
+
+// imageURLs returns the photos of an item in order, the thumbnail first
+func (item *EbayItem) imageURLs() []string {
+	urls := make([]string, 0, 1+len(item.AdditionalImages))
+	if len(item.ThumbnailImages) > 0 && item.ThumbnailImages[0].ImageURL != "" {
+		urls = append(urls, item.ThumbnailImages[0].ImageURL)
+	}
+	for _, image := range item.AdditionalImages {
+		if image.ImageURL != "" {
+			urls = append(urls, image.ImageURL)
+		}
+	}
+	return urls
 }
 
 // Item represents a single search result item
@@ -66,15 +93,59 @@ type Item struct {
 	ThumbnailURL string `json:"thumbnailImages,omitempty"`
 }
 
+func init() {
+	Register("ebay", func(opts ClientOptions) (SiteClient, error) {
+		var config EbayConfig
+		if err := DecodeConfig(opts.Config, &config); err != nil {
+			return nil, err
+		}
+
+		// Credentials live in the environment unless the site config overrides them
+		if config.ClientID == "" {
+			config.ClientID = os.Getenv("EBAY_CLIENT_ID")
+		}
+		if config.ClientSecret == "" {
+			config.ClientSecret = os.Getenv("EBAY_CLIENT_SECRET")
+		}
+
+		client := NewEbayClient(opts.SiteID, config.ClientID, config.ClientSecret, config.Sandbox)
+		if config.Query != "" {
+			client.query = config.Query
+		}
+		if config.CategoryIDs != "" {
+			client.categoryIDs = config.CategoryIDs
+		}
+		if opts.Images != nil {
+			client.images = opts.Images
+		}
+		if opts.Transport != nil {
+			client.httpClient = opts.Transport.Client()
+		}
+		return client, nil
+	})
+}
+
+// EbayConfig holds the per-site settings for an eBay client
+type EbayConfig struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	Sandbox      bool   `json:"sandbox"`
+	Query        string `json:"query"`
+	CategoryIDs  string `json:"category_ids"`
+}
+
 // EbayClient implements the SiteClient interface for eBay
 type EbayClient struct {
 	baseURL      string
 	httpClient   *http.Client
+	images       *ImageFetcher
 	siteID       int
 	accessToken  string // token used for authentication
 	clientID     string // eBay App ID (Client ID)
 	clientSecret string // eBay Client Secret
 	isSandbox    bool   // Indicates if the client is in sandbox mode
+	query        string // Browse API search query from the site config, used when the request names no vehicle
+	categoryIDs  string // Browse API category filter
 }
 
 type ebayAPIError struct {
@@ -94,17 +165,21 @@ type ebayAPIError struct {
 	} `json:"errors"`
 }
 
+// defaultEbayQuery is searched when neither the site config nor the request name what to search
+// for
+const defaultEbayQuery = "(Mitsubishi Eclipse 2g, D32A)"
+
 // NewEbayClient creates a new EbayClient
 func NewEbayClient(siteID int, appID string, clientSecret string, isSandbox bool) *EbayClient {
 	return &EbayClient{
-		baseURL: "https://svcs.ebay.com/services/search/FindingService/v1",
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		baseURL:      "https://svcs.ebay.com/services/search/FindingService/v1",
+		httpClient:   DefaultTransport().Client(),
+		images:       DefaultImageFetcher(),
 		siteID:       siteID,
 		clientID:     appID,
 		clientSecret: clientSecret,
 		isSandbox:    isSandbox,
+		categoryIDs:  "6030",
 	}
 }
 
@@ -136,8 +211,7 @@ func (c *EbayClient) GetAccessToken() error {
 	req.Header.Set("Authorization", "Basic "+auth)
 
 	// Send request
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to get token: %w", err)
 	}
@@ -171,12 +245,40 @@ func (c *EbayClient) GetSiteID() int {
 	return c.siteID
 }
 
+// searchQuery returns the Browse API query for a search. The query of the requested vehicle wins,
+// then that of the site config, then the default; the extra keywords of params are appended.
+func (c *EbayClient) searchQuery(params SearchParams) string {
+	searchQuery := c.query
+	if searchQuery == "" {
+		searchQuery = defaultEbayQuery
+	}
+	if vehicle := ResolveVehicle(params); vehicle != nil && vehicle.EbayQuery != "" {
+		searchQuery = vehicle.EbayQuery
+	}
+	return WithKeywords(searchQuery, params)
+}
+
 // FetchParts fetches parts from eBay based on search parameters
-func (c *EbayClient) FetchParts(ctx context.Context, params SearchParams) ([]Part, error) {
+func (c *EbayClient) FetchParts(ctx context.Context, params SearchParams) (*FetchResult, error) {
 	log.Println("Fetching parts from eBay")
 	c.GetAccessToken()
 	log.Println("Access token retrieved")
 
+	searchQuery := c.searchQuery(params)
+
+	// Restrict the price range when requested
+	priceFilter := ""
+	if params.MinPrice > 0 || params.MaxPrice > 0 {
+		minPrice, maxPrice := "", ""
+		if params.MinPrice > 0 {
+			minPrice = fmt.Sprintf("%d", params.MinPrice)
+		}
+		if params.MaxPrice > 0 {
+			maxPrice = fmt.Sprintf("%d", params.MaxPrice)
+		}
+		priceFilter = fmt.Sprintf("price:[%s..%s],priceCurrency:EUR", minPrice, maxPrice)
+	}
+
 	allParts := []Part{}
 	offset := 0
 	for {
@@ -185,8 +287,11 @@ func (c *EbayClient) FetchParts(ctx context.Context, params SearchParams) ([]Par
 		query.Set("sort", "newlyListed")
 		query.Set("limit", "200")
 		query.Set("offset", fmt.Sprintf("%d", offset))
-		query.Set("q", "(Mitsubishi Eclipse 2g, D32A)")
-		query.Set("category_ids", "6030")
+		query.Set("q", searchQuery)
+		query.Set("category_ids", c.categoryIDs)
+		if priceFilter != "" {
+			query.Set("filter", priceFilter)
+		}
 
 		apiURL := fmt.Sprintf("https://api.ebay.com/buy/browse/v1/item_summary/search?%s", query.Encode())
 		req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
@@ -236,46 +341,35 @@ func (c *EbayClient) FetchParts(ctx context.Context, params SearchParams) ([]Par
 				Name:         item.Title,
 				URL:          item.ItemWebURL,
 				SiteID:       c.siteID,
-				Price:        "€ " + item.Price.Value,
+				Price:        item.Price.Value,
+				Currency:     item.Price.Currency,
 				CreationDate: item.ItemOriginDate,
 			}
-			// Fetch and convert image to base64
-			if len(item.ThumbnailImages) > 0 && item.ThumbnailImages[0].ImageURL != "" {
-				imageBase64, fetchErr := c.fetchImageAsBase64(ctx, item.ThumbnailImages[0].ImageURL)
-				if fetchErr == nil {
-					part.ImageBase64 = imageBase64
-				}
+			if len(item.ShippingOptions) > 0 {
+				part.ShippingCost = item.ShippingOptions[0].ShippingCost.Value
+			}
+			for _, imageURL := range item.imageURLs() {
+				part.AddImageURL(imageURL)
 			}
 			parts = append(parts, part)
 		}
+		c.images.FetchImages(ctx, c.httpClient, parts, nil)
 		allParts = append(allParts, parts...)
+		ReportProgress(ctx, offset/200+1, len(allParts))
 
 		// If less than 200 results returned, we're done
 		if len(parts) < 200 {
 			break
 		}
-		offset += 200
-	}
-	return allParts, nil
-}
 
-// fetchImageAsBase64 fetches an image from a URL and returns it as a base64 string
-func (c *EbayClient) fetchImageAsBase64(ctx context.Context, imageURL string) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create image request: %w", err)
-	}
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to fetch image: %w", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code for image: %d", resp.StatusCode)
-	}
-	imageData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read image data: %w", err)
+		if params.Limit > 0 && len(allParts) >= params.Limit {
+			return TruncatedResult(allParts[:params.Limit], fmt.Sprintf("limit of %d parts reached", params.Limit)), nil
+		}
+
+		offset += 200
+		if offset >= ebayMaxResults {
+			return TruncatedResult(allParts, fmt.Sprintf("eBay result window of %d items reached, %d matching", ebayMaxResults, apiResponse.Total)), nil
+		}
 	}
-	return base64.StdEncoding.EncodeToString(imageData), nil
+	return CompleteResult(allParts), nil
 }
@@ -0,0 +1,46 @@
+package siteclients
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// seededEbayConfig is the config the migrations give the default eBay site
+const seededEbayConfig = `{"query": "(Mitsubishi Eclipse 2g, D32A)", "category_ids": "6030"}`
+
+func TestEbaySearchQuery(t *testing.T) {
+	client, err := NewClient("ebay", ClientOptions{SiteID: 3, Config: json.RawMessage(seededEbayConfig)})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	ebay := client.(*EbayClient)
+
+	tests := []struct {
+		name   string
+		params SearchParams
+		want   string
+	}{
+		{"no vehicle uses the config", SearchParams{}, "(Mitsubishi Eclipse 2g, D32A)"},
+		{"galant", SearchParams{Make: "Mitsubishi", BaseModel: "Galant", Model: "VR-4"}, "(Mitsubishi Galant VR-4, VR4, E39A)"},
+		{"talon", SearchParams{Make: "Eagle", BaseModel: "Talon", Model: "1G"}, "(Eagle Talon 1g, 1990-1994)"},
+		{"laser", SearchParams{Make: "Plymouth", BaseModel: "Laser", Model: "RS"}, "(Plymouth Laser RS, Laser Turbo)"},
+		{"extra keywords", SearchParams{Keywords: "turbo"}, "(Mitsubishi Eclipse 2g, D32A) turbo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ebay.searchQuery(tt.params); got != tt.want {
+				t.Errorf("searchQuery = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEbaySearchQueryDefault(t *testing.T) {
+	client, err := NewClient("ebay", ClientOptions{SiteID: 3, Config: json.RawMessage(`{}`)})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if got := client.(*EbayClient).searchQuery(SearchParams{}); got != defaultEbayQuery {
+		t.Errorf("searchQuery = %q, want the default %q", got, defaultEbayQuery)
+	}
+}
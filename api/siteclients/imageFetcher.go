@@ -0,0 +1,329 @@
+package siteclients
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Image fetcher defaults
+const (
+	defaultImageWorkers  = 8
+	defaultImagesPerHost = 4
+	defaultMaxImageBytes = 10 << 20
+)
+
+// ImageIndex tells the image fetcher which photos are stored already, so they are not downloaded
+// again. Site image URLs are assumed to always serve the same photo.
+type ImageIndex interface {
+	// StoredImageHash returns the hash of the image downloaded from sourceURL before
+	StoredImageHash(sourceURL string) (string, bool)
+}
+
+// GalleryIndex tells the image fetcher which listings are stored unchanged with their full
+// gallery, so their gallery pages are not loaded again on every fetch. The index given to
+// NewImageFetcher may implement it.
+type GalleryIndex interface {
+	// UnchangedListings returns the IDs of the parts of a site that are stored with the same
+	// content and cover photo and a gallery of more than one photo
+	UnchangedListings(siteID int, parts []Part) map[string]bool
+}
+
+// GalleryParser reads the photo URLs on the gallery page of a listing and queues them on the
+// part with AddImageURL
+type GalleryParser func(part *Part, page io.Reader) error
+
+// ImageFetcherConfig limits the downloads of an image fetcher. Zero values use the defaults.
+type ImageFetcherConfig struct {
+	Workers  int   // Downloads running at once over all hosts (default 8)
+	PerHost  int   // Downloads running at once per host (default 4)
+	MaxBytes int64 // Images larger than this are skipped (default 10 MB)
+}
+
+// ImageFetcherConfigFromEnv reads the image fetcher limits from IMAGE_FETCH_WORKERS,
+// IMAGE_FETCH_PER_HOST and IMAGE_FETCH_MAX_BYTES. Unset or invalid values use the defaults.
+func ImageFetcherConfigFromEnv() ImageFetcherConfig {
+	workers, _ := strconv.Atoi(os.Getenv("IMAGE_FETCH_WORKERS"))
+	perHost, _ := strconv.Atoi(os.Getenv("IMAGE_FETCH_PER_HOST"))
+	maxBytes, _ := strconv.ParseInt(os.Getenv("IMAGE_FETCH_MAX_BYTES"), 10, 64)
+	return ImageFetcherConfig{Workers: workers, PerHost: perHost, MaxBytes: maxBytes}
+}
+
+// ImageFetcher downloads the photos of listings for every site client, concurrently but within
+// its limits. It is safe for concurrent use; share one between all clients so the limits hold
+// across fetches.
+type ImageFetcher struct {
+	config     ImageFetcherConfig
+	httpClient *http.Client
+	index      ImageIndex
+	workers    chan struct{}
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+// NewImageFetcher creates an image fetcher downloading through transport, DefaultTransport when
+// nil, so photos are retried and rate limited like the other requests to a site. index may be
+// nil, then every image is downloaded.
+func NewImageFetcher(config ImageFetcherConfig, index ImageIndex, transport *Transport) *ImageFetcher {
+	if config.Workers <= 0 {
+		config.Workers = defaultImageWorkers
+	}
+	if config.PerHost <= 0 {
+		config.PerHost = defaultImagesPerHost
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaultMaxImageBytes
+	}
+	if transport == nil {
+		transport = DefaultTransport()
+	}
+	return &ImageFetcher{
+		config:     config,
+		httpClient: transport.Client(),
+		index:      index,
+		workers:    make(chan struct{}, config.Workers),
+		hosts:      make(map[string]chan struct{}),
+	}
+}
+
+var defaultImageFetcher = sync.OnceValue(func() *ImageFetcher {
+	return NewImageFetcher(ImageFetcherConfig{}, nil, nil)
+})
+
+// DefaultImageFetcher returns the image fetcher of clients that were not given one
+func DefaultImageFetcher() *ImageFetcher {
+	return defaultImageFetcher()
+}
+
+// imageJob is one photo to download for one part
+type imageJob struct {
+	part  int
+	image int
+	url   string
+}
+
+// FetchGalleries loads the gallery pages of the parts with a GalleryURL, concurrently within the
+// limits of the fetcher, and lets parse queue the photos on them. Listings stored unchanged are
+// not loaded again but marked GalleryIncomplete, so their stored gallery is kept; so are
+// listings whose page fails. client and header are used as by FetchImages.
+func (f *ImageFetcher) FetchGalleries(ctx context.Context, client *http.Client, parts []Part, header http.Header, parse GalleryParser) {
+	if client == nil {
+		client = f.httpClient
+	}
+
+	var unchanged map[string]bool
+	if index, ok := f.index.(GalleryIndex); ok {
+		withGallery := make([]Part, 0)
+		for _, part := range parts {
+			if part.GalleryURL != "" {
+				withGallery = append(withGallery, part)
+			}
+		}
+		if len(withGallery) > 0 {
+			unchanged = index.UnchangedListings(withGallery[0].SiteID, withGallery)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range parts {
+		part := &parts[i]
+		if part.GalleryURL == "" {
+			continue
+		}
+		if unchanged[part.ID] {
+			part.GalleryURL = ""
+			part.GalleryIncomplete = true
+			continue
+		}
+
+		wg.Add(1)
+		go func(part *Part) {
+			defer wg.Done()
+			if err := f.fetchGallery(ctx, client, part, header, parse); err != nil {
+				part.GalleryIncomplete = true
+				if ctx.Err() == nil {
+					log.Printf("[ImageFetcher] Warning: failed to fetch gallery of part %s: %v", part.ID, err)
+				}
+			}
+			part.GalleryURL = ""
+		}(part)
+	}
+	wg.Wait()
+}
+
+// fetchGallery loads the gallery page of a part once a worker and a slot for its host are free
+func (f *ImageFetcher) fetchGallery(ctx context.Context, client *http.Client, part *Part, header http.Header, parse GalleryParser) error {
+	resp, release, err := f.get(ctx, client, part.GalleryURL, header)
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code for gallery page: %d", resp.StatusCode)
+	}
+	return parse(part, io.LimitReader(resp.Body, f.config.MaxBytes))
+}
+
+// FetchImages downloads the photos the parts were given with AddImageURL, concurrently, and
+// returns once they are done or ctx is cancelled. Photos that are stored already are not
+// downloaded but referenced by their hash. A photo that fails is dropped and logged; its part
+// keeps its other photos and is never held back. client is the HTTP client of the site, so its
+// photos go through the same proxies and cookies as its pages; the fetcher's own client is used
+// when nil. header is sent with every request, e.g. the Referer a site expects.
+func (f *ImageFetcher) FetchImages(ctx context.Context, client *http.Client, parts []Part, header http.Header) {
+	if client == nil {
+		client = f.httpClient
+	}
+
+	jobs := make([]imageJob, 0)
+	for i := range parts {
+		for j, image := range parts[i].Images {
+			if image.Base64 != "" || image.Hash != "" {
+				continue
+			}
+			if f.index != nil {
+				if hash, ok := f.index.StoredImageHash(image.SourceURL); ok {
+					parts[i].Images[j].Hash = hash
+					continue
+				}
+			}
+			jobs = append(jobs, imageJob{part: i, image: j, url: image.SourceURL})
+		}
+	}
+
+	if len(jobs) > 0 {
+		results := make([]string, len(jobs))
+		var wg sync.WaitGroup
+		for k, job := range jobs {
+			wg.Add(1)
+			go func(k int, job imageJob) {
+				defer wg.Done()
+				imageBase64, err := f.fetch(ctx, client, job.url, header)
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Printf("[ImageFetcher] Warning: failed to fetch image for part %s: %v", parts[job.part].ID, err)
+					}
+					return
+				}
+				results[k] = imageBase64
+				ReportImage(ctx)
+			}(k, job)
+		}
+		wg.Wait()
+
+		for k, job := range jobs {
+			parts[job.part].Images[job.image].Base64 = results[k]
+		}
+	}
+
+	for i := range parts {
+		parts[i].dropMissingImages()
+	}
+}
+
+// get sends a GET request once a worker and a slot for the host are free. release frees them
+// again and must be called once the response is read.
+func (f *ImageFetcher) get(ctx context.Context, client *http.Client, rawURL string, header http.Header) (*http.Response, func(), error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, nil, fmt.Errorf("invalid URL %q", rawURL)
+	}
+
+	// Wait for the host first, so downloads queued for a busy host do not hold up other hosts
+	held := make([]chan struct{}, 0, 2)
+	release := func() {
+		for _, slots := range held {
+			<-slots
+		}
+	}
+	for _, slots := range []chan struct{}{f.hostSlots(parsed.Host), f.workers} {
+		select {
+		case slots <- struct{}{}:
+			held = append(held, slots)
+		case <-ctx.Done():
+			release()
+			return nil, nil, ctx.Err()
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		release()
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return resp, release, nil
+}
+
+// fetch downloads an image once a worker and a slot for its host are free
+func (f *ImageFetcher) fetch(ctx context.Context, client *http.Client, imageURL string, header http.Header) (string, error) {
+	resp, release, err := f.get(ctx, client, imageURL, header)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch image: %w", err)
+	}
+	defer release()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code for image: %d", resp.StatusCode)
+	}
+	if resp.ContentLength > f.config.MaxBytes {
+		return "", fmt.Errorf("image is %d bytes, at most %d are allowed", resp.ContentLength, f.config.MaxBytes)
+	}
+
+	imageData, err := io.ReadAll(io.LimitReader(resp.Body, f.config.MaxBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read image data: %w", err)
+	}
+	if int64(len(imageData)) > f.config.MaxBytes {
+		return "", fmt.Errorf("image is larger than %d bytes", f.config.MaxBytes)
+	}
+	if contentType := imageContentType(resp.Header.Get("Content-Type"), imageData); !strings.HasPrefix(contentType, "image/") {
+		return "", fmt.Errorf("unexpected content type for image: %s", contentType)
+	}
+
+	return base64.StdEncoding.EncodeToString(imageData), nil
+}
+
+// hostSlots returns the semaphore limiting the downloads from a host
+func (f *ImageFetcher) hostSlots(host string) chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	slots, exists := f.hosts[host]
+	if !exists {
+		slots = make(chan struct{}, f.config.PerHost)
+		f.hosts[host] = slots
+	}
+	return slots
+}
+
+// imageContentType returns the media type of a response, sniffing the data when the server does
+// not say or only says it is binary
+func imageContentType(header string, data []byte) string {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil || mediaType == "" || mediaType == "application/octet-stream" || mediaType == "binary/octet-stream" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	return mediaType
+}
@@ -0,0 +1,80 @@
+package siteclients
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// unchangedIndex reports the listings in unchanged as stored with their gallery
+type unchangedIndex struct {
+	unchanged map[string]bool
+}
+
+func (i *unchangedIndex) StoredImageHash(sourceURL string) (string, bool) {
+	return "", false
+}
+
+func (i *unchangedIndex) UnchangedListings(siteID int, parts []Part) map[string]bool {
+	return i.unchanged
+}
+
+// lineGallery queues every line of a gallery page as a photo
+func lineGallery(part *Part, page io.Reader) error {
+	scanner := bufio.NewScanner(page)
+	for scanner.Scan() {
+		part.AddImageURL(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+func TestFetchGalleries(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, "https://img.example/2.jpg\nhttps://img.example/3.jpg\n")
+	}))
+	defer server.Close()
+
+	fetcher := NewImageFetcher(ImageFetcherConfig{}, &unchangedIndex{unchanged: map[string]bool{"stored": true}}, nil)
+	parts := []Part{
+		{ID: "new", GalleryURL: server.URL + "/new"},
+		{ID: "stored", GalleryURL: server.URL + "/stored"},
+		{ID: "broken", GalleryURL: server.URL + "/broken"},
+		{ID: "single"},
+	}
+	fetcher.FetchGalleries(context.Background(), server.Client(), parts, nil, lineGallery)
+
+	if got := requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2, the unchanged listing is not loaded again", got)
+	}
+	tests := []struct {
+		part       Part
+		images     int
+		incomplete bool
+	}{
+		{parts[0], 2, false},
+		{parts[1], 0, true},
+		{parts[2], 0, true},
+		{parts[3], 0, false},
+	}
+	for _, tt := range tests {
+		if len(tt.part.Images) != tt.images {
+			t.Errorf("%s: %d images, want %d", tt.part.ID, len(tt.part.Images), tt.images)
+		}
+		if tt.part.GalleryIncomplete != tt.incomplete {
+			t.Errorf("%s: GalleryIncomplete = %v, want %v", tt.part.ID, tt.part.GalleryIncomplete, tt.incomplete)
+		}
+		if tt.part.GalleryURL != "" {
+			t.Errorf("%s: GalleryURL still set", tt.part.ID)
+		}
+	}
+}
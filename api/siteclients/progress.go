@@ -0,0 +1,170 @@
+package siteclients
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Progress event types
+const (
+	ProgressStarted         = "started"
+	ProgressPageFetched     = "page_fetched"
+	ProgressImageDownloaded = "image_downloaded"
+	ProgressProxyFailed     = "proxy_failed"
+	ProgressPartsStored     = "parts_stored"
+	ProgressFinished        = "finished"
+	ProgressFailed          = "failed"
+)
+
+// ProgressEvent describes a step of a fetch. The counts are the totals of the fetch so far.
+type ProgressEvent struct {
+	Type        string    `json:"type"`
+	SiteID      int       `json:"site_id"`
+	RunID       int       `json:"run_id,omitempty"` // The fetch run, 0 when it could not be recorded
+	PagesDone   int       `json:"pages_done"`
+	PartsFound  int       `json:"parts_found"`
+	ImagesDone  int       `json:"images_done"`
+	PartsStored int       `json:"parts_stored"`
+	ProxyErrors int       `json:"proxy_errors,omitempty"` // Requests that failed through a proxy
+	Error       string    `json:"error,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// ProgressFunc receives the progress events of a fetch. It is called from the goroutine of
+// the fetch and should not block.
+type ProgressFunc func(event ProgressEvent)
+
+type progressListenersKey struct{}
+type progressTrackerKey struct{}
+
+// ProxyFailure counts the failed requests of a fetch through one proxy
+type ProxyFailure struct {
+	Proxy     string // The proxy URL without its password
+	Failures  int
+	LastError string
+}
+
+// progressTracker keeps the totals of one fetch and hands its events to the listeners
+type progressTracker struct {
+	mu            sync.Mutex
+	totals        ProgressEvent
+	listeners     []ProgressFunc
+	proxyFailures []ProxyFailure
+}
+
+// WithProgress returns a context that reports the progress of fetches started with it to fn,
+// in addition to the listeners already on ctx
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	parent, _ := ctx.Value(progressListenersKey{}).([]ProgressFunc)
+	listeners := make([]ProgressFunc, 0, len(parent)+1)
+	listeners = append(listeners, parent...)
+	listeners = append(listeners, fn)
+	return context.WithValue(ctx, progressListenersKey{}, listeners)
+}
+
+// StartProgress begins tracking a fetch of a site and emits its started event. Site clients
+// report into the returned context; without a call to StartProgress their reports are ignored.
+func StartProgress(ctx context.Context, siteID, runID int) context.Context {
+	listeners, _ := ctx.Value(progressListenersKey{}).([]ProgressFunc)
+	tracker := &progressTracker{
+		totals:    ProgressEvent{SiteID: siteID, RunID: runID},
+		listeners: listeners,
+	}
+	ctx = context.WithValue(ctx, progressTrackerKey{}, tracker)
+	tracker.emit(ProgressStarted, func(*ProgressEvent) {})
+	return ctx
+}
+
+// ReportProgress is called by site clients after every result page with the totals so far
+func ReportProgress(ctx context.Context, pagesDone, partsFound int) {
+	if tracker := trackerFrom(ctx); tracker != nil {
+		tracker.emit(ProgressPageFetched, func(totals *ProgressEvent) {
+			totals.PagesDone = pagesDone
+			totals.PartsFound = partsFound
+		})
+	}
+}
+
+// ReportImage is called by site clients after every image they downloaded
+func ReportImage(ctx context.Context) {
+	if tracker := trackerFrom(ctx); tracker != nil {
+		tracker.emit(ProgressImageDownloaded, func(totals *ProgressEvent) {
+			totals.ImagesDone++
+		})
+	}
+}
+
+// ReportProxyFailure is called by a ProxyPool for every request that failed through a proxy
+func ReportProxyFailure(ctx context.Context, proxy string, err error) {
+	if tracker := trackerFrom(ctx); tracker != nil {
+		tracker.emit(ProgressProxyFailed, func(totals *ProgressEvent) {
+			totals.ProxyErrors++
+			for i := range tracker.proxyFailures {
+				if tracker.proxyFailures[i].Proxy == proxy {
+					tracker.proxyFailures[i].Failures++
+					tracker.proxyFailures[i].LastError = err.Error()
+					return
+				}
+			}
+			tracker.proxyFailures = append(tracker.proxyFailures, ProxyFailure{Proxy: proxy, Failures: 1, LastError: err.Error()})
+		})
+	}
+}
+
+// ProxyFailures returns the proxies that failed during the fetch tracked by ctx, in the order
+// they first failed
+func ProxyFailures(ctx context.Context) []ProxyFailure {
+	tracker := trackerFrom(ctx)
+	if tracker == nil {
+		return nil
+	}
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	return append([]ProxyFailure(nil), tracker.proxyFailures...)
+}
+
+// ReportPartsStored is called once the new parts of a fetch are stored
+func ReportPartsStored(ctx context.Context, partsStored int) {
+	if tracker := trackerFrom(ctx); tracker != nil {
+		tracker.emit(ProgressPartsStored, func(totals *ProgressEvent) {
+			totals.PartsStored = partsStored
+		})
+	}
+}
+
+// FinishProgress emits the finished event of a fetch, or its failed event when err is set
+func FinishProgress(ctx context.Context, err error) {
+	tracker := trackerFrom(ctx)
+	if tracker == nil {
+		return
+	}
+
+	if err != nil {
+		tracker.emit(ProgressFailed, func(totals *ProgressEvent) {
+			totals.Error = err.Error()
+		})
+		return
+	}
+	tracker.emit(ProgressFinished, func(*ProgressEvent) {})
+}
+
+func trackerFrom(ctx context.Context) *progressTracker {
+	tracker, _ := ctx.Value(progressTrackerKey{}).(*progressTracker)
+	return tracker
+}
+
+// emit updates the totals and hands a copy to the listeners. Listeners are called with the
+// lock held so they see the events of a fetch in order.
+func (t *progressTracker) emit(eventType string, update func(totals *ProgressEvent)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	update(&t.totals)
+	event := t.totals
+	event.Type = eventType
+	event.Time = time.Now()
+	for _, listener := range t.listeners {
+		listener(event)
+	}
+}
@@ -0,0 +1,100 @@
+package siteclients
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ClientOptions carries everything a Factory needs to build a SiteClient for a sites row
+type ClientOptions struct {
+	// SiteID is the database ID of the site the client represents
+	SiteID int
+	// Config is the raw JSON config blob stored on the sites row
+	Config json.RawMessage
+	// Images downloads the photos of listings, DefaultImageFetcher when nil
+	Images *ImageFetcher
+	// Transport sends the requests of the client, DefaultTransport when nil
+	Transport *Transport
+}
+
+// Factory builds a SiteClient from the options of a single sites row
+type Factory func(opts ClientOptions) (SiteClient, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a client factory available under the given client type key.
+// It panics if the key is empty, the factory is nil or the key is registered twice.
+func Register(clientType string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if clientType == "" {
+		panic("siteclients: Register called with empty client type")
+	}
+	if factory == nil {
+		panic("siteclients: Register factory is nil for " + clientType)
+	}
+	if _, exists := factories[clientType]; exists {
+		panic("siteclients: Register called twice for " + clientType)
+	}
+	factories[clientType] = factory
+}
+
+// NewClient builds a SiteClient using the factory registered for clientType. A "proxy" section
+// in the site config routes the requests of the client through a ProxyPool.
+func NewClient(clientType string, opts ClientOptions) (SiteClient, error) {
+	factoriesMu.RLock()
+	factory, exists := factories[clientType]
+	factoriesMu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown client type %q", clientType)
+	}
+
+	proxies, err := ProxyPoolFromConfig(opts.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s client: %w", clientType, err)
+	}
+	if proxies != nil {
+		if opts.Transport == nil {
+			opts.Transport = DefaultTransport()
+		}
+		opts.Transport = opts.Transport.Via(proxies)
+	}
+
+	client, err := factory(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s client: %w", clientType, err)
+	}
+	return client, nil
+}
+
+// RegisteredTypes returns the sorted list of registered client type keys
+func RegisteredTypes() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	types := make([]string, 0, len(factories))
+	for clientType := range factories {
+		types = append(types, clientType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// DecodeConfig unmarshals a site config blob into v.
+// An empty blob leaves v untouched so factories can rely on their defaults.
+func DecodeConfig(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("invalid client config: %w", err)
+	}
+	return nil
+}
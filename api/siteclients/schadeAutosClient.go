@@ -2,10 +2,8 @@ package siteclients
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"strings"
@@ -35,21 +33,48 @@ func parseEnterDate(dateStr string) *time.Time {
 	return nil
 }
 
+func init() {
+	Register("schadeautos", func(opts ClientOptions) (SiteClient, error) {
+		var config SchadeAutosConfig
+		if err := DecodeConfig(opts.Config, &config); err != nil {
+			return nil, err
+		}
+		client := NewSchadeAutosClient(opts.SiteID, config)
+		if opts.Images != nil {
+			client.images = opts.Images
+		}
+		if opts.Transport != nil {
+			client.httpClient = opts.Transport.Client()
+		}
+		return client, nil
+	})
+}
+
+// SchadeAutosConfig holds the per-site settings for a SchadeAutos client
+type SchadeAutosConfig struct {
+	BaseURL string `json:"base_url"`
+}
+
 // SchadeAutosClient implements the SiteClient interface for schadeautos.nl
 type SchadeAutosClient struct {
 	baseURL    string
 	httpClient *http.Client
+	images     *ImageFetcher
 	siteID     int
 }
 
 // NewSchadeAutosClient creates a new SchadeAutos client
-func NewSchadeAutosClient(siteID int) *SchadeAutosClient {
+func NewSchadeAutosClient(siteID int, config SchadeAutosConfig) *SchadeAutosClient {
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = "https://www.schadeautos.nl"
+	}
+
 	return &SchadeAutosClient{
-		baseURL: "https://www.schadeautos.nl",
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		siteID: siteID,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: DefaultTransport().Client(),
+		images:     DefaultImageFetcher(),
+		siteID:     siteID,
 	}
 }
 
@@ -93,26 +118,46 @@ type stockPart struct {
 }
 
 // FetchParts fetches parts from SchadeAutos based on search parameters
-func (c *SchadeAutosClient) FetchParts(ctx context.Context, params SearchParams) ([]Part, error) {
+func (c *SchadeAutosClient) FetchParts(ctx context.Context, params SearchParams) (*FetchResult, error) {
+	// Resolve the vehicle to SchadeAutos widget codes, defaulting to the Eclipse D30
+	vehicle := ResolveVehicle(params)
+	if vehicle == nil {
+		vehicle = ResolveVehicle(SearchParams{Make: "Mitsubishi", BaseModel: "Eclipse", Model: "D30"})
+		vehicle.YearFrom, vehicle.YearTo = params.YearFrom, params.YearTo
+	}
+
+	// Levels without a known code fall back to a free text query
+	textQuery := ""
+	if vehicle.SchadeAutosMake == "" {
+		textQuery = vehicle.SearchText()
+	} else if vehicle.BaseModel != "" && vehicle.SchadeAutosBaseModel == "" {
+		textQuery = strings.TrimSpace(vehicle.BaseModel + " " + vehicle.Model)
+	}
+
+	vehicleType := params.VehicleType
+	if vehicleType == "" {
+		vehicleType = "P"
+	}
+
 	// Build form data
 	formData := url.Values{}
 
-	formData.Set("widget[vehicleType]", "P")
-	formData.Set("widget[make]", "A0001E2D")
-	formData.Set("widget[baseModel]", "A0001FHK")
-	formData.Set("widget[model]", "A0001FHL")
+	formData.Set("widget[vehicleType]", vehicleType)
+	formData.Set("widget[make]", vehicle.SchadeAutosMake)
+	formData.Set("widget[baseModel]", vehicle.SchadeAutosBaseModel)
+	formData.Set("widget[model]", vehicle.SchadeAutosModel)
 	formData.Set("widget[type]", "")
 	formData.Set("widget[vehicle]", "")
 
 	// Set year from with default
-	yearFrom := params.YearFrom
+	yearFrom := vehicle.YearFrom
 	if yearFrom == 0 {
 		yearFrom = 1995
 	}
 	formData.Set("widget[yearFrom]", fmt.Sprintf("%d", yearFrom))
 
 	// Set year to with default
-	yearTo := params.YearTo
+	yearTo := vehicle.YearTo
 	if yearTo == 0 {
 		yearTo = 2000
 	}
@@ -120,8 +165,12 @@ func (c *SchadeAutosClient) FetchParts(ctx context.Context, params SearchParams)
 
 	formData.Set("widget[category]", "")
 	formData.Set("widget[part]", "")
-	formData.Set("widget[priceMax]", "")
-	formData.Set("widget[query]", "")
+	priceMax := ""
+	if params.MaxPrice > 0 {
+		priceMax = fmt.Sprintf("%d", params.MaxPrice)
+	}
+	formData.Set("widget[priceMax]", priceMax)
+	formData.Set("widget[query]", WithKeywords(textQuery, params))
 
 	// Set offset with default
 	offset := params.Offset
@@ -150,7 +199,6 @@ func (c *SchadeAutosClient) FetchParts(ctx context.Context, params SearchParams)
 	}
 
 	// Set headers
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:143.0) Gecko/20100101 Firefox/143.0")
 	req.Header.Set("Accept", "application/json, text/javascript, */*; q=0.01")
 	req.Header.Set("Accept-Language", "en-US,en;q=0.5")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
@@ -189,25 +237,30 @@ func (c *SchadeAutosClient) FetchParts(ctx context.Context, params SearchParams)
 			Name:         stockPart.Name,
 			URL:          c.buildPartURL(partID, &stockPart),
 			SiteID:       c.siteID,
-			Price:        "€ " + stockPart.Price,
+			Price:        stockPart.Price,
+			Currency:     "EUR",
 			CreationDate: *parseEnterDate(stockPart.EnterDate),
 		}
 
-		// Fetch and convert image to base64
+		// The stock API only reports one picture per part
 		if stockPart.Picture != "" {
-			imageBase64, fetchErr := c.fetchImageAsBase64(ctx, stockPart.Picture)
-			if fetchErr != nil {
-				// Log error but continue with other parts
-				fmt.Printf("Warning: failed to fetch image for part %s: %v\n", partID, fetchErr)
-			} else {
-				part.ImageBase64 = imageBase64
-			}
+			part.AddImageURL(c.resolveImageURL(stockPart.Picture))
 		}
 
 		parts = append(parts, part)
 	}
-
-	return parts, nil
+	c.images.FetchImages(ctx, c.httpClient, parts, nil)
+	ReportProgress(ctx, 1, len(parts))
+
+	switch {
+	case apiResponse.Result.Limited:
+		return TruncatedResult(parts, "SchadeAutos limited the result set"), nil
+	case offset > 0:
+		return TruncatedResult(parts, fmt.Sprintf("results start at offset %d", offset)), nil
+	case len(parts) >= limit:
+		return TruncatedResult(parts, fmt.Sprintf("limit of %d parts reached", limit)), nil
+	}
+	return CompleteResult(parts), nil
 }
 
 // buildPartURL constructs the URL for a specific part
@@ -216,40 +269,12 @@ func (c *SchadeAutosClient) buildPartURL(partID string, part *stockPart) string
 	return fmt.Sprintf("%s/parts/eng/part/%s", c.baseURL, partID)
 }
 
-// fetchImageAsBase64 fetches an image from a URL and returns it as a base64 string
-func (c *SchadeAutosClient) fetchImageAsBase64(ctx context.Context, imageURL string) (string, error) {
-	// Handle relative URLs
+// resolveImageURL makes a picture URL of the stock API absolute
+func (c *SchadeAutosClient) resolveImageURL(imageURL string) string {
 	if strings.HasPrefix(imageURL, "//") {
-		imageURL = "https:" + imageURL
+		return "https:" + imageURL
 	} else if strings.HasPrefix(imageURL, "/") {
-		imageURL = c.baseURL + imageURL
+		return c.baseURL + imageURL
 	}
-
-	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create image request: %w", err)
-	}
-
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:143.0) Gecko/20100101 Firefox/143.0")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to fetch image: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code for image: %d", resp.StatusCode)
-	}
-
-	// Read image data
-	imageData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read image data: %w", err)
-	}
-
-	// Convert to base64
-	base64String := base64.StdEncoding.EncodeToString(imageData)
-
-	return base64String, nil
+	return imageURL
 }
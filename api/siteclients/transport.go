@@ -0,0 +1,342 @@
+package siteclients
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTP transport defaults
+const (
+	defaultMaxRetries        = 3
+	defaultBaseBackoff       = 1 * time.Second
+	defaultMaxBackoff        = 30 * time.Second
+	defaultAttemptTimeout    = 30 * time.Second
+	defaultRequestsPerSecond = 2
+	defaultRequestBurst      = 4
+)
+
+// defaultUserAgents are the browsers site clients present themselves as
+var defaultUserAgents = []string{
+	"Mozilla/5.0 (X11; Linux x86_64; rv:143.0) Gecko/20100101 Firefox/143.0",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15",
+}
+
+// HTTPConfig configures the transport site clients send their requests through. Zero values use
+// the defaults.
+type HTTPConfig struct {
+	MaxRetries        int           // Retries after a 429, 5xx gateway error or network error (default 3, negative for none)
+	BaseBackoff       time.Duration // Wait before the first retry, doubled for every further one (default 1s)
+	MaxBackoff        time.Duration // Longest wait before a retry; a longer Retry-After is not waited for (default 30s)
+	Timeout           time.Duration // Timeout of a single attempt, including reading the body (default 30s)
+	RequestsPerSecond float64       // Requests per second to a single host (default 2)
+	Burst             int           // Requests to a host that may be sent at once before the rate applies (default 4)
+	UserAgents        []string      // User-Agents handed out to clients in turn
+	Hooks             HTTPHooks
+}
+
+// HTTPHooks are called around every attempt, e.g. to log the traffic of a site. Both are optional.
+type HTTPHooks struct {
+	// OnRequest is called before an attempt is sent, attempt counts from 1
+	OnRequest func(req *http.Request, attempt int)
+	// OnResponse is called after an attempt with either its response or its error
+	OnResponse func(req *http.Request, resp *http.Response, err error, elapsed time.Duration)
+}
+
+// LogHooks returns hooks that log every request and response with the given prefix
+func LogHooks(prefix string) HTTPHooks {
+	return HTTPHooks{
+		OnRequest: func(req *http.Request, attempt int) {
+			log.Printf("[%s] %s %s (attempt %d)", prefix, req.Method, req.URL, attempt)
+		},
+		OnResponse: func(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+			if err != nil {
+				log.Printf("[%s] %s %s failed after %s: %v", prefix, req.Method, req.URL, elapsed.Round(time.Millisecond), err)
+				return
+			}
+			log.Printf("[%s] %s %s -> %d in %s", prefix, req.Method, req.URL, resp.StatusCode, elapsed.Round(time.Millisecond))
+		},
+	}
+}
+
+// HTTPConfigFromEnv reads the transport settings from HTTP_MAX_RETRIES, HTTP_RATE_LIMIT (requests
+// per second per host), HTTP_RATE_BURST and HTTP_USER_AGENTS (separated by |). Unset or invalid
+// values use the defaults. HTTP_LOG logs every request.
+func HTTPConfigFromEnv() HTTPConfig {
+	maxRetries, _ := strconv.Atoi(os.Getenv("HTTP_MAX_RETRIES"))
+	rate, _ := strconv.ParseFloat(os.Getenv("HTTP_RATE_LIMIT"), 64)
+	burst, _ := strconv.Atoi(os.Getenv("HTTP_RATE_BURST"))
+
+	config := HTTPConfig{MaxRetries: maxRetries, RequestsPerSecond: rate, Burst: burst}
+	for _, userAgent := range strings.Split(os.Getenv("HTTP_USER_AGENTS"), "|") {
+		if userAgent = strings.TrimSpace(userAgent); userAgent != "" {
+			config.UserAgents = append(config.UserAgents, userAgent)
+		}
+	}
+	if os.Getenv("HTTP_LOG") != "" {
+		config.Hooks = LogHooks("HTTP")
+	}
+	return config
+}
+
+// Transport is the http.RoundTripper of the site clients. It rate limits requests per host, and
+// retries 429 and 502-504 responses and network errors with exponential backoff, waiting at least
+// as long as Retry-After asks. Requests with a body are only retried when it can be rewound.
+// Share one transport between all clients so the rate limits hold across sites.
+type Transport struct {
+	config   HTTPConfig
+	base     http.RoundTripper
+	limiters *sync.Map // host -> *tokenBucket
+	next     *atomic.Uint64
+}
+
+// NewTransport creates a transport sending through base, http.DefaultTransport when nil
+func NewTransport(config HTTPConfig, base http.RoundTripper) *Transport {
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	} else if config.MaxRetries == 0 {
+		config.MaxRetries = defaultMaxRetries
+	}
+	if config.BaseBackoff <= 0 {
+		config.BaseBackoff = defaultBaseBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaultMaxBackoff
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultAttemptTimeout
+	}
+	if config.RequestsPerSecond <= 0 {
+		config.RequestsPerSecond = defaultRequestsPerSecond
+	}
+	if config.Burst <= 0 {
+		config.Burst = defaultRequestBurst
+	}
+	if len(config.UserAgents) == 0 {
+		config.UserAgents = defaultUserAgents
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{config: config, base: base, limiters: &sync.Map{}, next: &atomic.Uint64{}}
+}
+
+// Via returns a transport that sends through base, e.g. a ProxyPool, with the settings of t. The
+// rate limits of the hosts are shared with t.
+func (t *Transport) Via(base http.RoundTripper) *Transport {
+	via := *t
+	via.base = base
+	return &via
+}
+
+var defaultTransport = sync.OnceValue(func() *Transport {
+	return NewTransport(HTTPConfig{}, nil)
+})
+
+// DefaultTransport returns the transport of clients that were not given one
+func DefaultTransport() *Transport {
+	return defaultTransport()
+}
+
+// Client returns an HTTP client for a single site client. It has its own cookie jar, so consent
+// cookies a site sets are sent back, and one User-Agent of the pool for all its requests.
+func (t *Transport) Client() *http.Client {
+	jar, _ := cookiejar.New(nil)
+	userAgent := t.config.UserAgents[(t.next.Add(1)-1)%uint64(len(t.config.UserAgents))]
+	return &http.Client{
+		Transport: &userAgentTransport{transport: t, userAgent: userAgent},
+		Jar:       jar,
+	}
+}
+
+// userAgentTransport sets the User-Agent of a client on requests that do not carry their own
+type userAgentTransport struct {
+	transport *Transport
+	userAgent string
+}
+
+func (u *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", u.userAgent)
+	}
+	return u.transport.RoundTrip(req)
+}
+
+// RoundTrip sends a request, waiting for the rate limit of its host and retrying it when allowed
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	retryable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	limiter := t.limiter(req.URL.Host)
+
+	for attempt := 1; ; attempt++ {
+		if err := limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		resp, err := t.attempt(req, attempt)
+		if attempt > t.config.MaxRetries || !retryable || ctx.Err() != nil {
+			return resp, err
+		}
+
+		var delay time.Duration
+		switch {
+		case err != nil:
+			delay = t.backoff(attempt)
+		case shouldRetry(resp.StatusCode):
+			retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"))
+			if ok && retryAfter > t.config.MaxBackoff {
+				return resp, nil
+			}
+			delay = max(t.backoff(attempt), retryAfter)
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		default:
+			return resp, nil
+		}
+
+		log.Printf("[HTTP] %s %s: %v, retrying in %s (attempt %d of %d)", req.Method, req.URL.Redacted(), err, delay.Round(time.Millisecond), attempt+1, t.config.MaxRetries+1)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// attempt sends a request once. The attempt timeout keeps running until the body is closed.
+func (t *Transport) attempt(req *http.Request, attempt int) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.config.Timeout)
+	attemptReq := req.Clone(ctx)
+	if attempt > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to rewind request body: %w", err)
+		}
+		attemptReq.Body = body
+	}
+
+	if t.config.Hooks.OnRequest != nil {
+		t.config.Hooks.OnRequest(attemptReq, attempt)
+	}
+	start := time.Now()
+	resp, err := t.base.RoundTrip(attemptReq)
+	if t.config.Hooks.OnResponse != nil {
+		t.config.Hooks.OnResponse(attemptReq, resp, err, time.Since(start))
+	}
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// backoff returns the wait before the retry after the given attempt, with jitter so clients that
+// failed together do not retry together
+func (t *Transport) backoff(attempt int) time.Duration {
+	delay := t.config.BaseBackoff << (attempt - 1)
+	if delay <= 0 || delay > t.config.MaxBackoff {
+		delay = t.config.MaxBackoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// limiter returns the token bucket of a host
+func (t *Transport) limiter(host string) *tokenBucket {
+	if limiter, ok := t.limiters.Load(host); ok {
+		return limiter.(*tokenBucket)
+	}
+	limiter, _ := t.limiters.LoadOrStore(host, newTokenBucket(t.config.RequestsPerSecond, t.config.Burst))
+	return limiter.(*tokenBucket)
+}
+
+// shouldRetry reports whether a response status is worth retrying
+func shouldRetry(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+// cancelOnClose releases the attempt timeout of a response once its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// tokenBucket allows burst requests at once and then rate requests per second
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait takes a token, waiting until one is available or ctx is done
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	// Taking the token up front reserves it, a negative balance is the queue of waiting requests
+	b.tokens--
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the reserved token back
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
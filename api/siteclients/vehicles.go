@@ -0,0 +1,335 @@
+package siteclients
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SiteMappings holds how a taxonomy node is expressed on each supported site
+type SiteMappings struct {
+	// SchadeAutos is the internal widget code (e.g. "A0001E2D" for Mitsubishi)
+	SchadeAutos string `json:"schadeautos,omitempty"`
+	// Kleinanzeigen is the keyword search text
+	Kleinanzeigen string `json:"kleinanzeigen,omitempty"`
+	// Ebay is the Browse API query string
+	Ebay string `json:"ebay,omitempty"`
+}
+
+// VehicleModel is a concrete model generation with its production years
+type VehicleModel struct {
+	Name     string       `json:"name"`
+	Aliases  []string     `json:"aliases,omitempty"`
+	YearFrom int          `json:"year_from"`
+	YearTo   int          `json:"year_to"`
+	Sites    SiteMappings `json:"sites"`
+}
+
+// VehicleBaseModel groups the generations of a model line
+type VehicleBaseModel struct {
+	Name    string         `json:"name"`
+	Aliases []string       `json:"aliases,omitempty"`
+	Sites   SiteMappings   `json:"sites"`
+	Models  []VehicleModel `json:"models"`
+}
+
+// VehicleMake is a manufacturer with its model lines
+type VehicleMake struct {
+	Name       string             `json:"name"`
+	Aliases    []string           `json:"aliases,omitempty"`
+	Sites      SiteMappings       `json:"sites"`
+	BaseModels []VehicleBaseModel `json:"base_models"`
+}
+
+// Taxonomy is the make -> base model -> model -> years tree used to build site queries
+type Taxonomy struct {
+	Makes []VehicleMake `json:"makes"`
+}
+
+// DefaultTaxonomy covers the DSM platform and its siblings
+var DefaultTaxonomy = Taxonomy{
+	Makes: []VehicleMake{
+		{
+			Name:  "Mitsubishi",
+			Sites: SiteMappings{SchadeAutos: "A0001E2D", Kleinanzeigen: "Mitsubishi", Ebay: "Mitsubishi"},
+			BaseModels: []VehicleBaseModel{
+				{
+					Name:  "Eclipse",
+					Sites: SiteMappings{SchadeAutos: "A0001FHK", Kleinanzeigen: "Mitsubishi Eclipse", Ebay: "Mitsubishi Eclipse"},
+					Models: []VehicleModel{
+						{
+							Name:     "D20",
+							Aliases:  []string{"1G", "Eclipse D20", "D22A", "D27A"},
+							YearFrom: 1989,
+							YearTo:   1994,
+							Sites:    SiteMappings{Kleinanzeigen: "Mitsubishi Eclipse D20", Ebay: "(Mitsubishi Eclipse 1g, D27A)"},
+						},
+						{
+							Name:     "D30",
+							Aliases:  []string{"2G", "Eclipse D30", "D32A", "D38A"},
+							YearFrom: 1995,
+							YearTo:   1999,
+							Sites:    SiteMappings{SchadeAutos: "A0001FHL", Kleinanzeigen: "Mitsubishi Eclipse D30", Ebay: "(Mitsubishi Eclipse 2g, D32A)"},
+						},
+					},
+				},
+				{
+					Name:  "Galant",
+					Sites: SiteMappings{Kleinanzeigen: "Mitsubishi Galant", Ebay: "Mitsubishi Galant"},
+					Models: []VehicleModel{
+						{
+							Name:     "VR-4",
+							Aliases:  []string{"VR4", "Galant VR-4", "E39A"},
+							YearFrom: 1988,
+							YearTo:   1992,
+							Sites:    SiteMappings{Kleinanzeigen: "Galant VR4", Ebay: "(Mitsubishi Galant VR-4, VR4, E39A)"},
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:  "Eagle",
+			Sites: SiteMappings{Kleinanzeigen: "Eagle", Ebay: "Eagle"},
+			BaseModels: []VehicleBaseModel{
+				{
+					Name:  "Talon",
+					Sites: SiteMappings{Kleinanzeigen: "Eagle Talon", Ebay: "Eagle Talon"},
+					Models: []VehicleModel{
+						{
+							Name:     "1G",
+							Aliases:  []string{"Talon 1G"},
+							YearFrom: 1990,
+							YearTo:   1994,
+							Sites:    SiteMappings{Kleinanzeigen: "Eagle Talon", Ebay: "(Eagle Talon 1g, 1990-1994)"},
+						},
+						{
+							Name:     "2G",
+							Aliases:  []string{"Talon 2G"},
+							YearFrom: 1995,
+							YearTo:   1998,
+							Sites:    SiteMappings{Kleinanzeigen: "Eagle Talon", Ebay: "(Eagle Talon 2g, 1995-1998)"},
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:  "Plymouth",
+			Sites: SiteMappings{Kleinanzeigen: "Plymouth", Ebay: "Plymouth"},
+			BaseModels: []VehicleBaseModel{
+				{
+					Name:  "Laser",
+					Sites: SiteMappings{Kleinanzeigen: "Plymouth Laser", Ebay: "Plymouth Laser"},
+					Models: []VehicleModel{
+						{
+							Name:     "RS",
+							Aliases:  []string{"Laser RS", "RS Turbo"},
+							YearFrom: 1990,
+							YearTo:   1994,
+							Sites:    SiteMappings{Kleinanzeigen: "Plymouth Laser", Ebay: "(Plymouth Laser RS, Laser Turbo)"},
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+var (
+	taxonomyMu      sync.RWMutex
+	currentTaxonomy = DefaultTaxonomy
+)
+
+// LoadTaxonomy replaces the active taxonomy with the one in a JSON file
+func LoadTaxonomy(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read vehicle taxonomy %s: %w", path, err)
+	}
+
+	var taxonomy Taxonomy
+	if err := json.Unmarshal(data, &taxonomy); err != nil {
+		return fmt.Errorf("failed to parse vehicle taxonomy %s: %w", path, err)
+	}
+
+	taxonomyMu.Lock()
+	currentTaxonomy = taxonomy
+	taxonomyMu.Unlock()
+	return nil
+}
+
+// GetTaxonomy returns the active taxonomy
+func GetTaxonomy() Taxonomy {
+	taxonomyMu.RLock()
+	defer taxonomyMu.RUnlock()
+	return currentTaxonomy
+}
+
+// VehicleQuery is a vehicle from SearchParams resolved against the taxonomy.
+// Names are always set; site mappings are empty where the taxonomy has no entry.
+type VehicleQuery struct {
+	Make      string
+	BaseModel string
+	Model     string
+	YearFrom  int
+	YearTo    int
+
+	// SchadeAutos widget codes, per level
+	SchadeAutosMake      string
+	SchadeAutosBaseModel string
+	SchadeAutosModel     string
+
+	// Most specific keyword search text and eBay query that is known
+	Keywords  string
+	EbayQuery string
+}
+
+// SearchText returns plain text describing the vehicle, for sites without a mapping
+func (q *VehicleQuery) SearchText() string {
+	return joinSearchText(q.Make, q.BaseModel, q.Model)
+}
+
+// WithKeywords appends the extra keywords from params to a site query
+func WithKeywords(query string, params SearchParams) string {
+	return joinSearchText(query, params.Keywords)
+}
+
+// ResolveVehicle looks up the vehicle in params against the active taxonomy.
+// It returns nil when params name no vehicle so clients can use their configured defaults.
+// Vehicles missing from the taxonomy still resolve, with their names used as search text.
+func ResolveVehicle(params SearchParams) *VehicleQuery {
+	if params.Make == "" && params.BaseModel == "" && params.Model == "" {
+		return nil
+	}
+
+	query := &VehicleQuery{
+		Make:      params.Make,
+		BaseModel: params.BaseModel,
+		Model:     params.Model,
+		YearFrom:  params.YearFrom,
+		YearTo:    params.YearTo,
+	}
+
+	taxonomy := GetTaxonomy()
+	vehicleMake := findMake(taxonomy.Makes, params.Make)
+	if vehicleMake == nil {
+		query.Keywords = query.SearchText()
+		query.EbayQuery = query.SearchText()
+		return query
+	}
+
+	query.Make = vehicleMake.Name
+	query.SchadeAutosMake = vehicleMake.Sites.SchadeAutos
+	query.applySites(vehicleMake.Sites)
+
+	baseModel := findBaseModel(vehicleMake.BaseModels, params.BaseModel)
+	if baseModel == nil {
+		if params.BaseModel != "" {
+			query.Keywords = query.SearchText()
+			query.EbayQuery = query.SearchText()
+		}
+		return query
+	}
+
+	query.BaseModel = baseModel.Name
+	query.SchadeAutosBaseModel = baseModel.Sites.SchadeAutos
+	query.applySites(baseModel.Sites)
+
+	model := findModel(baseModel.Models, params.Model)
+	if model == nil {
+		if params.Model != "" {
+			query.Keywords = query.SearchText()
+			query.EbayQuery = query.SearchText()
+		} else if params.YearFrom == 0 && params.YearTo == 0 {
+			query.YearFrom, query.YearTo = baseModelYears(baseModel)
+		}
+		return query
+	}
+
+	query.Model = model.Name
+	query.SchadeAutosModel = model.Sites.SchadeAutos
+	query.applySites(model.Sites)
+	if query.YearFrom == 0 {
+		query.YearFrom = model.YearFrom
+	}
+	if query.YearTo == 0 {
+		query.YearTo = model.YearTo
+	}
+	return query
+}
+
+// applySites overrides the search strings with the more specific mappings that are set
+func (q *VehicleQuery) applySites(sites SiteMappings) {
+	if sites.Kleinanzeigen != "" {
+		q.Keywords = sites.Kleinanzeigen
+	}
+	if sites.Ebay != "" {
+		q.EbayQuery = sites.Ebay
+	}
+}
+
+// baseModelYears returns the year span covered by all generations of a base model
+func baseModelYears(baseModel *VehicleBaseModel) (int, int) {
+	yearFrom, yearTo := 0, 0
+	for _, model := range baseModel.Models {
+		if yearFrom == 0 || model.YearFrom < yearFrom {
+			yearFrom = model.YearFrom
+		}
+		if model.YearTo > yearTo {
+			yearTo = model.YearTo
+		}
+	}
+	return yearFrom, yearTo
+}
+
+// matchesName compares a taxonomy name and its aliases case-insensitively
+func matchesName(name string, aliases []string, value string) bool {
+	if strings.EqualFold(name, value) {
+		return true
+	}
+	for _, alias := range aliases {
+		if strings.EqualFold(alias, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func findMake(makes []VehicleMake, name string) *VehicleMake {
+	if name == "" {
+		return nil
+	}
+	for i := range makes {
+		if matchesName(makes[i].Name, makes[i].Aliases, name) {
+			return &makes[i]
+		}
+	}
+	return nil
+}
+
+func findBaseModel(baseModels []VehicleBaseModel, name string) *VehicleBaseModel {
+	if name == "" {
+		return nil
+	}
+	for i := range baseModels {
+		if matchesName(baseModels[i].Name, baseModels[i].Aliases, name) {
+			return &baseModels[i]
+		}
+	}
+	return nil
+}
+
+func findModel(models []VehicleModel, name string) *VehicleModel {
+	if name == "" {
+		return nil
+	}
+	for i := range models {
+		if matchesName(models[i].Name, models[i].Aliases, name) {
+			return &models[i]
+		}
+	}
+	return nil
+}
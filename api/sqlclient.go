@@ -2,24 +2,28 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"strings"
 	"time"
 
 	. "dsmpartsfinder-api/models"
+	"dsmpartsfinder-api/prices"
 
 	_ "github.com/glebarez/go-sqlite"
 )
 
 // SQLClient wraps database operations for the DSM Parts Finder
 type SQLClient struct {
-	db *sql.DB
+	db        *sql.DB
+	eventHook func() // Called after events were written to the outbox
 }
 
 func (c *SQLClient) GetTotalPartsCount() (int, error) {
 	var count int
-	query := "SELECT COUNT(*) FROM parts"
+	query := "SELECT COUNT(*) FROM parts WHERE status != 'removed'"
 	err := c.db.QueryRow(query).Scan(&count)
 	if err != nil {
 		logError("Failed to get total parts count", err)
@@ -28,44 +32,87 @@ func (c *SQLClient) GetTotalPartsCount() (int, error) {
 	return count, nil
 }
 
-func (c *SQLClient) GetFilteredPartsCount(typeFilter string, siteIDs []int, newerThan time.Time, search string) (int, error) {
+func (c *SQLClient) GetFilteredPartsCount(filter PartFilter) (int, error) {
+	where, params := buildPartFilterWhere(filter)
+
+	var count int
+	err := c.db.QueryRow("SELECT COUNT(*) FROM parts WHERE 1=1"+where, params...).Scan(&count)
+	if err != nil {
+		logError("Failed to get filtered parts count", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// buildPartFilterWhere builds the WHERE conditions and parameters for a part filter
+func buildPartFilterWhere(filter PartFilter) (string, []interface{}) {
 	queryBuilder := strings.Builder{}
 	params := make([]interface{}, 0)
 
-	queryBuilder.WriteString("SELECT COUNT(*) FROM parts WHERE 1=1")
+	if statuses := filter.Statuses(); statuses != nil {
+		placeholders := make([]string, len(statuses))
+		for i, status := range statuses {
+			placeholders[i] = "?"
+			params = append(params, status)
+		}
+		queryBuilder.WriteString(" AND status IN (" + strings.Join(placeholders, ",") + ")")
+	}
 
-	if typeFilter != "" {
+	if filter.TypeName != "" {
 		queryBuilder.WriteString(" AND type_name = ?")
-		params = append(params, typeFilter)
+		params = append(params, filter.TypeName)
 	}
 
-	if len(siteIDs) > 0 {
-		placeholders := make([]string, len(siteIDs))
-		for i := range siteIDs {
+	if len(filter.SiteIDs) > 0 {
+		placeholders := make([]string, len(filter.SiteIDs))
+		for i := range filter.SiteIDs {
 			placeholders[i] = "?"
-			params = append(params, siteIDs[i])
+			params = append(params, filter.SiteIDs[i])
 		}
 		queryBuilder.WriteString(" AND site_id IN (" + strings.Join(placeholders, ",") + ")")
 	}
 
-	if !newerThan.IsZero() {
+	if newerThan := filter.NewerThan(); !newerThan.IsZero() {
 		queryBuilder.WriteString(" AND creation_date > ?")
 		params = append(params, newerThan)
 	}
 
-	if search != "" {
+	if filter.Search != "" {
 		queryBuilder.WriteString(" AND (name LIKE ? OR description LIKE ? OR type_name LIKE ?)")
-		searchPattern := "%" + search + "%"
+		searchPattern := "%" + filter.Search + "%"
 		params = append(params, searchPattern, searchPattern, searchPattern)
 	}
 
-	var count int
-	err := c.db.QueryRow(queryBuilder.String(), params...).Scan(&count)
-	if err != nil {
-		logError("Failed to get filtered parts count", err)
-		return 0, err
+	if filter.MinPrice != nil {
+		queryBuilder.WriteString(" AND price_amount >= ?")
+		params = append(params, int64(math.Round(*filter.MinPrice*100)))
 	}
-	return count, nil
+
+	if filter.MaxPrice != nil {
+		queryBuilder.WriteString(" AND price_amount <= ?")
+		params = append(params, int64(math.Round(*filter.MaxPrice*100)))
+	}
+
+	if filter.MinPrice != nil || filter.MaxPrice != nil {
+		queryBuilder.WriteString(" AND price_currency = ?")
+		params = append(params, filter.PriceCurrency())
+	}
+
+	if filter.PriceDroppedSince != nil {
+		// A price point lower than the one recorded before it
+		queryBuilder.WriteString(` AND EXISTS (
+			SELECT 1 FROM part_price_history h
+			WHERE h.part_id = parts.id AND h.observed_at >= ?
+				AND h.price_amount < (
+					SELECT prev.price_amount FROM part_price_history prev
+					WHERE prev.part_id = h.part_id AND prev.id < h.id
+					ORDER BY prev.id DESC LIMIT 1
+				)
+		)`)
+		params = append(params, filter.PriceDroppedSince.UTC().Format("2006-01-02 15:04:05"))
+	}
+
+	return queryBuilder.String(), params
 }
 
 // NewSQLClient creates and initializes a new SQLClient
@@ -103,9 +150,37 @@ func logSuccess(message string) {
 	log.Printf("SUCCESS: %s", message)
 }
 
+// siteColumns lists the sites columns in the order scanSite expects them, including the
+// outcome of the latest fetch runs
+const siteColumns = `id, site_url, site_name, client_type, config, grace_period_hours, ingest_token_hash != '',
+	schedule, schedule_jitter_seconds, schedule_paused,
+	(SELECT MAX(started_at) FROM fetch_runs WHERE fetch_runs.site_id = sites.id),
+	(SELECT status FROM fetch_runs WHERE fetch_runs.site_id = sites.id ORDER BY started_at DESC, id DESC LIMIT 1),
+	(SELECT MAX(finished_at) FROM fetch_runs WHERE fetch_runs.site_id = sites.id AND status = 'succeeded')`
+
+// scanSite scans a single sites row selected with siteColumns
+func scanSite(scanner rowScanner) (*Site, error) {
+	var site Site
+	var config string
+	var lastFetchStatus sql.NullString
+	var lastFetchAt, lastSuccessfulFetchAt interface{}
+	err := scanner.Scan(&site.ID, &site.URL, &site.Name, &site.ClientType, &config, &site.GracePeriodHours, &site.IngestEnabled,
+		&site.Schedule, &site.ScheduleJitterSeconds, &site.SchedulePaused,
+		&lastFetchAt, &lastFetchStatus, &lastSuccessfulFetchAt)
+	if err != nil {
+		return nil, err
+	}
+
+	site.Config = json.RawMessage(config)
+	site.LastFetchAt = parseDBTime(lastFetchAt)
+	site.LastFetchStatus = lastFetchStatus.String
+	site.LastSuccessfulFetchAt = parseDBTime(lastSuccessfulFetchAt)
+	return &site, nil
+}
+
 // GetAllSites retrieves all sites from the database
 func (c *SQLClient) GetAllSites() ([]Site, error) {
-	rows, err := c.db.Query("SELECT id, site_url, site_name FROM sites")
+	rows, err := c.db.Query("SELECT " + siteColumns + " FROM sites")
 	if err != nil {
 		logError("Failed to query sites", err)
 		return nil, err
@@ -114,13 +189,12 @@ func (c *SQLClient) GetAllSites() ([]Site, error) {
 
 	var sites []Site
 	for rows.Next() {
-		var site Site
-		err := rows.Scan(&site.ID, &site.URL, &site.Name)
+		site, err := scanSite(rows)
 		if err != nil {
 			logError("Failed to scan site data", err)
 			return nil, err
 		}
-		sites = append(sites, site)
+		sites = append(sites, *site)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -134,10 +208,7 @@ func (c *SQLClient) GetAllSites() ([]Site, error) {
 
 // GetSiteByID retrieves a single site by its ID
 func (c *SQLClient) GetSiteByID(id int) (*Site, error) {
-	var site Site
-	err := c.db.QueryRow("SELECT id, site_url, site_name FROM sites WHERE id = ?", id).
-		Scan(&site.ID, &site.URL, &site.Name)
-
+	site, err := scanSite(c.db.QueryRow("SELECT "+siteColumns+" FROM sites WHERE id = ?", id))
 	if err == sql.ErrNoRows {
 		return nil, sql.ErrNoRows
 	} else if err != nil {
@@ -146,12 +217,33 @@ func (c *SQLClient) GetSiteByID(id int) (*Site, error) {
 	}
 
 	logSuccess(fmt.Sprintf("Retrieved site with ID %d", id))
-	return &site, nil
+	return site, nil
+}
+
+// normalizeSiteConfig returns the config blob to store, defaulting to an empty JSON object
+func normalizeSiteConfig(config json.RawMessage) (json.RawMessage, error) {
+	if len(config) == 0 || string(config) == "null" {
+		return json.RawMessage("{}"), nil
+	}
+	if !json.Valid(config) {
+		return nil, fmt.Errorf("site config is not valid JSON")
+	}
+	return config, nil
 }
 
 // CreateSite creates a new site in the database
-func (c *SQLClient) CreateSite(name, url string) (*Site, error) {
-	result, err := c.db.Exec("INSERT INTO sites (site_url, site_name) VALUES (?, ?)", url, name)
+func (c *SQLClient) CreateSite(name, url, clientType string, config json.RawMessage, gracePeriodHours int) (*Site, error) {
+	config, err := normalizeSiteConfig(config)
+	if err != nil {
+		logError("Failed to create site", err)
+		return nil, err
+	}
+	if gracePeriodHours <= 0 {
+		gracePeriodHours = defaultGracePeriodHours
+	}
+
+	result, err := c.db.Exec("INSERT INTO sites (site_url, site_name, client_type, config, grace_period_hours) VALUES (?, ?, ?, ?, ?)",
+		url, name, clientType, string(config), gracePeriodHours)
 	if err != nil {
 		logError("Failed to create site", err)
 		return nil, err
@@ -164,9 +256,12 @@ func (c *SQLClient) CreateSite(name, url string) (*Site, error) {
 	}
 
 	site := &Site{
-		ID:   int(id),
-		Name: name,
-		URL:  url,
+		ID:               int(id),
+		Name:             name,
+		URL:              url,
+		ClientType:       clientType,
+		Config:           config,
+		GracePeriodHours: gracePeriodHours,
 	}
 
 	logSuccess(fmt.Sprintf("Created site with ID %d", id))
@@ -174,8 +269,18 @@ func (c *SQLClient) CreateSite(name, url string) (*Site, error) {
 }
 
 // UpdateSite updates an existing site in the database
-func (c *SQLClient) UpdateSite(id int, name, url string) (*Site, error) {
-	result, err := c.db.Exec("UPDATE sites SET site_url = ?, site_name = ? WHERE id = ?", url, name, id)
+func (c *SQLClient) UpdateSite(id int, name, url, clientType string, config json.RawMessage, gracePeriodHours int) (*Site, error) {
+	config, err := normalizeSiteConfig(config)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to update site with ID %d", id), err)
+		return nil, err
+	}
+	if gracePeriodHours <= 0 {
+		gracePeriodHours = defaultGracePeriodHours
+	}
+
+	result, err := c.db.Exec("UPDATE sites SET site_url = ?, site_name = ?, client_type = ?, config = ?, grace_period_hours = ? WHERE id = ?",
+		url, name, clientType, string(config), gracePeriodHours, id)
 	if err != nil {
 		logError(fmt.Sprintf("Failed to update site with ID %d", id), err)
 		return nil, err
@@ -191,14 +296,31 @@ func (c *SQLClient) UpdateSite(id int, name, url string) (*Site, error) {
 		return nil, sql.ErrNoRows
 	}
 
-	site := &Site{
-		ID:   id,
-		Name: name,
-		URL:  url,
+	logSuccess(fmt.Sprintf("Updated site with ID %d", id))
+	return c.GetSiteByID(id)
+}
+
+// UpdateSiteSchedule stores when the scheduler fetches a site
+func (c *SQLClient) UpdateSiteSchedule(id int, schedule string, jitterSeconds int, paused bool) error {
+	result, err := c.db.Exec("UPDATE sites SET schedule = ?, schedule_jitter_seconds = ?, schedule_paused = ? WHERE id = ?",
+		schedule, jitterSeconds, paused, id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to update schedule of site with ID %d", id), err)
+		return err
 	}
 
-	logSuccess(fmt.Sprintf("Updated site with ID %d", id))
-	return site, nil
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logError("Failed to get rows affected", err)
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	logSuccess(fmt.Sprintf("Updated schedule of site with ID %d to %q (jitter %ds, paused %v)", id, schedule, jitterSeconds, paused))
+	return nil
 }
 
 // DeleteSite deletes a site from the database
@@ -223,13 +345,104 @@ func (c *SQLClient) DeleteSite(id int) error {
 	return nil
 }
 
-// CreatePart creates a new part in the database
-func (c *SQLClient) CreatePart(partID, description, typeName, name, imageBase64, url string, siteID int, price string, creationDate time.Time) (*Part, error) {
+// partColumns lists the parts columns in the order scanPart expects them
+const partColumns = `id, part_id, description, type_name, name, image_hash, url, site_id, price, created_at, updated_at, last_seen, creation_date,
+	price_amount, price_currency, price_negotiable, price_free, shipping_cost, content_hash,
+	status, missing_since, removed_at, relisted_at, relist_of`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPart scans a single parts row selected with partColumns
+func scanPart(scanner rowScanner) (*Part, error) {
+	var part Part
+	var imageHash string
+	var price, currency sql.NullString
+	var creationDate, missingSince, removedAt, relistedAt interface{}
+	var priceAmount, shippingCost, relistOf sql.NullInt64
+	err := scanner.Scan(
+		&part.ID, &part.PartID, &part.Description, &part.TypeName,
+		&part.Name, &imageHash, &part.URL, &part.SiteID, &price,
+		&part.CreatedAt, &part.UpdatedAt, &part.LastSeen, &creationDate,
+		&priceAmount, &currency, &part.PriceNegotiable, &part.PriceFree, &shippingCost, &part.ContentHash,
+		&part.Status, &missingSince, &removedAt, &relistedAt, &relistOf,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	part.SetImage(imageHash)
+	part.CreationDate = parseDBTime(creationDate)
+	part.MissingSince = parseDBTime(missingSince)
+	part.RemovedAt = parseDBTime(removedAt)
+	part.RelistedAt = parseDBTime(relistedAt)
+	if relistOf.Valid {
+		id := int(relistOf.Int64)
+		part.RelistOf = &id
+	}
+	if price.Valid {
+		part.Price = price.String
+	}
+	if currency.Valid {
+		part.PriceCurrency = currency.String
+	}
+	if priceAmount.Valid {
+		part.PriceAmount = &priceAmount.Int64
+	}
+	if shippingCost.Valid {
+		part.ShippingCost = &shippingCost.Int64
+	}
+	return &part, nil
+}
+
+// parseDBTime converts a timestamp column that may come back as time or text
+func parseDBTime(value interface{}) *time.Time {
+	switch v := value.(type) {
+	case time.Time:
+		return &v
+	case string:
+		if parsedTime, err := time.Parse("2006-01-02 15:04:05", v); err == nil {
+			return &parsedTime
+		}
+	case []byte:
+		if parsedTime, err := time.Parse("2006-01-02 15:04:05", string(v)); err == nil {
+			return &parsedTime
+		}
+	}
+	return nil
+}
+
+// nullableInt64 converts an optional amount into a value for a nullable column
+func nullableInt64(value *int64) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+// CreatePart creates a new part in the database with its gallery, the first image is the cover
+func (c *SQLClient) CreatePart(partID, description, typeName, name string, images []PartImage, url string, siteID int, price string, parsedPrice prices.Price, creationDate time.Time) (*Part, error) {
 	formattedDate := creationDate.Format("2006-01-02 15:04:05")
-	result, err := c.db.Exec(`
-		INSERT INTO parts (part_id, description, type_name, name, image_base64, url, site_id, price, last_seen, creation_date)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?)
-	`, partID, description, typeName, name, imageBase64, url, siteID, price, formattedDate)
+	content := newPartContent(name, description, typeName, images, url, price)
+	imageHash := content.ImageHash
+	contentHash := content.hash()
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		logError("Failed to begin part transaction", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO parts (part_id, description, type_name, name, image_hash, url, site_id, price, last_seen, creation_date,
+			price_amount, price_currency, price_negotiable, price_free, shipping_cost, content_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?)
+	`, partID, description, typeName, name, imageHash, url, siteID, price, formattedDate,
+		nullableInt64(parsedPrice.Amount), parsedPrice.Currency, parsedPrice.Negotiable, parsedPrice.Free, nullableInt64(parsedPrice.ShippingCost),
+		contentHash)
 	if err != nil {
 		logError("Failed to create part", err)
 		return nil, err
@@ -241,17 +454,51 @@ func (c *SQLClient) CreatePart(partID, description, typeName, name, imageBase64,
 		return nil, err
 	}
 
+	if err := insertPricePoint(tx, int(id), price, parsedPrice); err != nil {
+		logError(fmt.Sprintf("Failed to record initial price of part %d", id), err)
+	}
+	if err := replacePartImages(tx, int(id), images); err != nil {
+		logError(fmt.Sprintf("Failed to store images of part %d", id), err)
+		return nil, err
+	}
+
 	part := &Part{
-		ID:          int(id),
-		PartID:      partID,
-		Description: description,
-		TypeName:    typeName,
-		Name:        name,
-		ImageBase64: imageBase64,
-		URL:         url,
-		SiteID:      siteID,
-		Price:       price,
+		ID:              int(id),
+		PartID:          partID,
+		Description:     description,
+		TypeName:        typeName,
+		Name:            name,
+		URL:             url,
+		SiteID:          siteID,
+		Price:           price,
+		PriceAmount:     parsedPrice.Amount,
+		PriceCurrency:   parsedPrice.Currency,
+		PriceNegotiable: parsedPrice.Negotiable,
+		PriceFree:       parsedPrice.Free,
+		ShippingCost:    parsedPrice.ShippingCost,
+		ContentHash:     contentHash,
+		Status:          PartStatusActive,
+	}
+	part.SetImage(imageHash)
+	if !creationDate.IsZero() {
+		part.CreationDate = &creationDate
+	}
+
+	stored, err := scanPart(tx.QueryRow("SELECT "+partColumns+" FROM parts WHERE id = ?", id))
+	if err != nil {
+		logError(fmt.Sprintf("Failed to read back part %d", id), err)
+		return nil, err
 	}
+	if err := insertEvent(tx, PartCreatedEvent{Part: *stored}); err != nil {
+		logError(fmt.Sprintf("Failed to publish creation of part %d", id), err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logError("Failed to commit part", err)
+		return nil, err
+	}
+	c.eventsStored()
 
 	logSuccess(fmt.Sprintf("Created part with ID %d", id))
 	return part, nil
@@ -259,28 +506,8 @@ func (c *SQLClient) CreatePart(partID, description, typeName, name, imageBase64,
 
 // GetPartByID retrieves a single part by its database ID
 func (c *SQLClient) GetPartByID(id int) (*Part, error) {
-	var part Part
-	var price sql.NullString
-	var creationDate sql.NullString
-	err := c.db.QueryRow(`
-		SELECT id, part_id, description, type_name, name, image_base64, url, site_id, price, created_at, updated_at, last_seen, creation_date
-		FROM parts WHERE id = ?
-	`, id).Scan(
-		&part.ID, &part.PartID, &part.Description, &part.TypeName,
-		&part.Name, &part.ImageBase64, &part.URL, &part.SiteID, &price,
-		&part.CreatedAt, &part.UpdatedAt, &part.LastSeen, &creationDate,
-	)
-	if creationDate.Valid {
-		parsedTime, err := time.Parse("2006-01-02 15:04:05", creationDate.String)
-		if err == nil {
-			part.CreationDate = &parsedTime
-		}
-	}
-
-	if price.Valid {
-		part.Price = price.String
-	}
-
+	row := c.db.QueryRow("SELECT "+partColumns+" FROM parts WHERE id = ?", id)
+	part, err := scanPart(row)
 	if err == sql.ErrNoRows {
 		return nil, sql.ErrNoRows
 	} else if err != nil {
@@ -289,110 +516,87 @@ func (c *SQLClient) GetPartByID(id int) (*Part, error) {
 	}
 
 	logSuccess(fmt.Sprintf("Retrieved part with ID %d", id))
-	return &part, nil
+	return part, nil
 }
 
-// GetPartsBySiteID retrieves all parts for a specific site
-func (c *SQLClient) GetPartsBySiteID(siteID int, limit, offset int) ([]Part, error) {
-	query := `
-		SELECT id, part_id, description, type_name, name, image_base64, url, site_id, price, created_at, updated_at, last_seen, creation_date
-		FROM parts
-		WHERE site_id = ?
-		ORDER BY created_at DESC
-		LIMIT ? OFFSET ?
-	`
-
-	rows, err := c.db.Query(query, siteID, limit, offset)
+// queryParts runs a parts query selecting partColumns and scans all rows
+func (c *SQLClient) queryParts(query string, args ...interface{}) ([]Part, error) {
+	rows, err := c.db.Query(query, args...)
 	if err != nil {
-		logError(fmt.Sprintf("Failed to query parts for site ID %d", siteID), err)
 		return nil, err
 	}
 	defer rows.Close()
 
 	var parts []Part
 	for rows.Next() {
-		var part Part
-		var price sql.NullString
-		var creationDate sql.NullString
-		err := rows.Scan(
-			&part.ID, &part.PartID, &part.Description, &part.TypeName,
-			&part.Name, &part.ImageBase64, &part.URL, &part.SiteID, &price,
-			&part.CreatedAt, &part.UpdatedAt, &part.LastSeen, &creationDate,
-		)
-		if creationDate.Valid {
-			parsedTime, err := time.Parse("2006-01-02 15:04:05", creationDate.String)
-			if err == nil {
-				part.CreationDate = &parsedTime
-			}
-		}
+		part, err := scanPart(rows)
 		if err != nil {
 			logError("Failed to scan part data", err)
 			return nil, err
 		}
-		if price.Valid {
-			part.Price = price.String
-		}
-		parts = append(parts, part)
+		parts = append(parts, *part)
 	}
 
 	if err = rows.Err(); err != nil {
 		logError("Error iterating parts", err)
 		return nil, err
 	}
+	return parts, nil
+}
+
+// GetPartsBySiteID retrieves all parts for a specific site
+func (c *SQLClient) GetPartsBySiteID(siteID int, limit, offset int) ([]Part, error) {
+	query := `
+		SELECT ` + partColumns + `
+		FROM parts
+		WHERE site_id = ? AND status != 'removed'
+		ORDER BY created_at DESC
+		LIMIT ? OFFSET ?
+	`
+
+	parts, err := c.queryParts(query, siteID, limit, offset)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to query parts for site ID %d", siteID), err)
+		return nil, err
+	}
 
 	logSuccess(fmt.Sprintf("Retrieved %d parts for site ID %d", len(parts), siteID))
 	return parts, nil
 }
 
 // GetFilteredParts retrieves filtered parts from the database
-func (c *SQLClient) GetFilteredParts(limit, offset int, typeFilter string, siteIDs []int, newerThan time.Time, search string, sortBy string, sortDesc bool) ([]Part, error) {
+func (c *SQLClient) GetFilteredParts(limit, offset int, filter PartFilter) ([]Part, error) {
 	queryBuilder := strings.Builder{}
-	params := make([]interface{}, 0)
 
 	queryBuilder.WriteString(`
-		SELECT id, part_id, description, type_name, name, image_base64, url, site_id, price, created_at, updated_at, last_seen, creation_date
+		SELECT ` + partColumns + `
 		FROM parts
 		WHERE 1=1`)
 
-	if typeFilter != "" {
-		queryBuilder.WriteString(" AND type_name = ?")
-		params = append(params, typeFilter)
-	}
-
-	if len(siteIDs) > 0 {
-		placeholders := make([]string, len(siteIDs))
-		for i := range siteIDs {
-			placeholders[i] = "?"
-			params = append(params, siteIDs[i])
-		}
-		queryBuilder.WriteString(" AND site_id IN (" + strings.Join(placeholders, ",") + ")")
-	}
-
-	if !newerThan.IsZero() {
-		queryBuilder.WriteString(" AND creation_date > ?")
-		params = append(params, newerThan)
-	}
-
-	if search != "" {
-		queryBuilder.WriteString(" AND (name LIKE ? OR description LIKE ? OR type_name LIKE ?)")
-		searchPattern := "%" + search + "%"
-		params = append(params, searchPattern, searchPattern, searchPattern)
-	}
+	where, params := buildPartFilterWhere(filter)
+	queryBuilder.WriteString(where)
 
 	// Handle sorting
-	switch sortBy {
+	switch filter.SortBy {
 	case "creation_date_asc", "creation_date_desc":
-		if sortDesc {
+		if filter.SortDesc {
 			queryBuilder.WriteString(" ORDER BY creation_date DESC")
 		} else {
 			queryBuilder.WriteString(" ORDER BY creation_date ASC")
 		}
 	case "name_asc", "name_desc":
-		if sortDesc {
+		if filter.SortDesc {
 			queryBuilder.WriteString(" ORDER BY name DESC")
 		} else {
 			queryBuilder.WriteString(" ORDER BY name ASC")
 		}
+	case "price_asc", "price_desc":
+		// Parts without a known amount always go last
+		if filter.SortDesc {
+			queryBuilder.WriteString(" ORDER BY price_amount IS NULL, price_amount DESC")
+		} else {
+			queryBuilder.WriteString(" ORDER BY price_amount IS NULL, price_amount ASC")
+		}
 	case "recent_seen":
 		queryBuilder.WriteString(" ORDER BY last_seen DESC")
 	default:
@@ -403,87 +607,56 @@ func (c *SQLClient) GetFilteredParts(limit, offset int, typeFilter string, siteI
 	queryBuilder.WriteString(" LIMIT ? OFFSET ?")
 	params = append(params, limit, offset)
 
-	rows, err := c.db.Query(queryBuilder.String(), params...)
+	parts, err := c.queryParts(queryBuilder.String(), params...)
 	if err != nil {
-		// logError(fmt.Sprintf("Failed to query parts for site ID %d", siteID), err)
+		logError("Failed to query filtered parts", err)
 		return nil, err
 	}
-	defer rows.Close()
 
-	var parts []Part
-	for rows.Next() {
-		var part Part
-		var price sql.NullString
-		err := rows.Scan(
-			&part.ID, &part.PartID, &part.Description, &part.TypeName,
-			&part.Name, &part.ImageBase64, &part.URL, &part.SiteID, &price,
-			&part.CreatedAt, &part.UpdatedAt, &part.LastSeen, &part.CreationDate,
-		)
-		if err != nil {
-			logError("Failed to scan part data", err)
-			return nil, err
-		}
-		if price.Valid {
-			part.Price = price.String
-		}
-		parts = append(parts, part)
-	}
+	return parts, nil
+}
 
-	if err = rows.Err(); err != nil {
-		logError("Error iterating parts", err)
+// GetPartsAfterID retrieves the parts matching a filter with a DB ID after afterID and up to
+// upToID, oldest first. The sort order of the filter is ignored.
+func (c *SQLClient) GetPartsAfterID(afterID, upToID, limit int, filter PartFilter) ([]Part, error) {
+	where, params := buildPartFilterWhere(filter)
+	params = append([]interface{}{afterID, upToID}, params...)
+	params = append(params, limit)
+
+	parts, err := c.queryParts("SELECT "+partColumns+" FROM parts WHERE id > ? AND id <= ?"+where+" ORDER BY id LIMIT ?", params...)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to query parts after ID %d", afterID), err)
 		return nil, err
 	}
-
-	// logSuccess(fmt.Sprintf("Retrieved %d parts for site ID %d", len(parts), siteID))
 	return parts, nil
 }
 
+// GetLatestPartID returns the DB ID of the last stored part, 0 when there are none
+func (c *SQLClient) GetLatestPartID() (int, error) {
+	var id int
+	err := c.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM parts").Scan(&id)
+	if err != nil {
+		logError("Failed to get latest part ID", err)
+		return 0, err
+	}
+	return id, nil
+}
+
 // / GetAllParts retrieves all parts
 func (c *SQLClient) GetAllParts(limit, offset int) ([]Part, error) {
 	query := `
-		SELECT id, part_id, description, type_name, name, image_base64, url, site_id, price, created_at, updated_at, last_seen, creation_date
+		SELECT ` + partColumns + `
 		FROM parts
+		WHERE status != 'removed'
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := c.db.Query(query, limit, offset)
+	parts, err := c.queryParts(query, limit, offset)
 	if err != nil {
 		logError("Failed to query parts", err)
 		return nil, err
 	}
-	defer rows.Close()
-
-	var parts []Part
-	for rows.Next() {
-		var part Part
-		var price sql.NullString
-		var creationDate sql.NullString
-		err := rows.Scan(
-			&part.ID, &part.PartID, &part.Description, &part.TypeName,
-			&part.Name, &part.ImageBase64, &part.URL, &part.SiteID, &price,
-			&part.CreatedAt, &part.UpdatedAt, &part.LastSeen, &creationDate,
-		)
-		if creationDate.Valid {
-			parsedTime, err := time.Parse("2006-01-02 15:04:05", creationDate.String)
-			if err == nil {
-				part.CreationDate = &parsedTime
-			}
-		}
-		if err != nil {
-			logError("Failed to scan part data", err)
-			return nil, err
-		}
-		if price.Valid {
-			part.Price = price.String
-		}
-		parts = append(parts, part)
-	}
-
-	if err = rows.Err(); err != nil {
-		logError("Error iterating parts", err)
-		return nil, err
-	}
 
 	logSuccess(fmt.Sprintf("Retrieved %d parts", len(parts)))
 	return parts, nil
@@ -537,6 +710,51 @@ func (c *SQLClient) GetExistingPartIDs(partIDs []string, siteID int) (map[string
 	return existingParts, nil
 }
 
+// GetStoredParts returns the stored parts of a site with the given part IDs and their galleries,
+// keyed by part ID
+func (c *SQLClient) GetStoredParts(partIDs []string, siteID int) (map[string]Part, error) {
+	storedParts := make(map[string]Part)
+	if len(partIDs) == 0 {
+		return storedParts, nil
+	}
+
+	placeholders := make([]string, len(partIDs))
+	args := make([]interface{}, len(partIDs)+1)
+	args[0] = siteID
+
+	for i, partID := range partIDs {
+		placeholders[i] = "?"
+		args[i+1] = partID
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s FROM parts
+		WHERE site_id = ? AND part_id IN (%s)
+	`, partColumns, strings.Join(placeholders, ","))
+
+	parts, err := c.queryParts(query, args...)
+	if err != nil {
+		logError("Failed to query stored parts", err)
+		return nil, err
+	}
+
+	ids := make([]int, len(parts))
+	for i, part := range parts {
+		ids[i] = part.ID
+	}
+	galleries, err := c.getPartImagesByPartIDs(ids)
+	if err != nil {
+		logError("Failed to query images of stored parts", err)
+		return nil, err
+	}
+
+	for _, part := range parts {
+		part.Images = galleries[part.ID]
+		storedParts[part.PartID] = part
+	}
+	return storedParts, nil
+}
+
 // UpdateLastSeen updates the last_seen timestamp for multiple parts
 func (c *SQLClient) UpdateLastSeen(partIDs []string, siteID int) error {
 	if len(partIDs) == 0 {
@@ -574,34 +792,46 @@ func (c *SQLClient) UpdateLastSeen(partIDs []string, siteID int) error {
 	return nil
 }
 
-// DeleteStaleParts deletes parts that haven't been seen since a specific time
-func (c *SQLClient) DeleteStaleParts(siteID int, olderThan time.Time) (int64, error) {
-	result, err := c.db.Exec(`
-		DELETE FROM parts
-		WHERE site_id = ? AND last_seen < ?
-	`, siteID, olderThan)
-	if err != nil {
-		logError(fmt.Sprintf("Failed to delete stale parts for site ID %d", siteID), err)
-		return 0, err
+// partChildTables are the tables whose part_id references parts.id. Foreign keys are
+// not enforced by the driver, so their rows are deleted together with the parts.
+var partChildTables = []string{"part_search_profiles", "part_price_history", "part_changes", "alerts", "part_images"}
+
+// deletePartChildren deletes the rows referencing the parts matched by partsWhere
+func (c *SQLClient) deletePartChildren(partsWhere string, args ...interface{}) error {
+	for _, table := range partChildTables {
+		query := fmt.Sprintf("DELETE FROM %s WHERE part_id IN (SELECT id FROM parts WHERE %s)", table, partsWhere)
+		if _, err := c.db.Exec(query, args...); err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
 	}
+	return nil
+}
 
-	rowsAffected, err := result.RowsAffected()
+// UpdatePart updates an existing part and replaces its gallery, the first image is the cover. The
+// changes are recorded in the change log with a PartUpdated event, and a changed price in the
+// price history with a PriceChanged event, all in one transaction. stored is the part as it was.
+func (c *SQLClient) UpdatePart(stored *Part, partID, description, typeName, name string, images []PartImage, url string, siteID int, price string, parsedPrice prices.Price, changes []PartChange, priceChanged bool) (*Part, error) {
+	id := stored.ID
+	content := newPartContent(name, description, typeName, images, url, price)
+	imageHash := content.ImageHash
+	contentHash := content.hash()
+
+	tx, err := c.db.Begin()
 	if err != nil {
-		logError("Failed to get rows affected for stale parts deletion", err)
-		return 0, err
+		logError("Failed to begin part transaction", err)
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	log.Printf("Deleted %d stale parts for site ID %d (older than %s)", rowsAffected, siteID, olderThan.Format("2006-01-02 15:04:05"))
-	return rowsAffected, nil
-}
-
-// UpdatePart updates an existing part in the database
-func (c *SQLClient) UpdatePart(id int, partID, description, typeName, name, imageBase64, url string, siteID int, price string) (*Part, error) {
-	result, err := c.db.Exec(`
+	result, err := tx.Exec(`
 		UPDATE parts
-		SET part_id = ?, description = ?, type_name = ?, name = ?, image_base64 = ?, url = ?, site_id = ?, price = ?, updated_at = CURRENT_TIMESTAMP, last_seen = CURRENT_TIMESTAMP
+		SET part_id = ?, description = ?, type_name = ?, name = ?, image_hash = ?, url = ?, site_id = ?, price = ?,
+			price_amount = ?, price_currency = ?, price_negotiable = ?, price_free = ?, shipping_cost = ?, content_hash = ?,
+			updated_at = CURRENT_TIMESTAMP, last_seen = CURRENT_TIMESTAMP
 		WHERE id = ?
-	`, partID, description, typeName, name, imageBase64, url, siteID, price, id)
+	`, partID, description, typeName, name, imageHash, url, siteID, price,
+		nullableInt64(parsedPrice.Amount), parsedPrice.Currency, parsedPrice.Negotiable, parsedPrice.Free, nullableInt64(parsedPrice.ShippingCost),
+		contentHash, id)
 	if err != nil {
 		logError(fmt.Sprintf("Failed to update part with ID %d", id), err)
 		return nil, err
@@ -617,12 +847,59 @@ func (c *SQLClient) UpdatePart(id int, partID, description, typeName, name, imag
 		return nil, sql.ErrNoRows
 	}
 
-	// Fetch and return the updated part
-	return c.GetPartByID(id)
+	if err := replacePartImages(tx, id, images); err != nil {
+		logError(fmt.Sprintf("Failed to store images of part %d", id), err)
+		return nil, err
+	}
+	if err := insertPartChanges(tx, id, changes); err != nil {
+		return nil, err
+	}
+	if priceChanged {
+		if err := insertPricePoint(tx, id, price, parsedPrice); err != nil {
+			logError(fmt.Sprintf("Failed to record price history of part %d", id), err)
+			return nil, err
+		}
+	}
+
+	updated, err := scanPart(tx.QueryRow("SELECT "+partColumns+" FROM parts WHERE id = ?", id))
+	if err != nil {
+		logError(fmt.Sprintf("Failed to read back part %d", id), err)
+		return nil, err
+	}
+	if err := insertEvent(tx, PartUpdatedEvent{Part: *updated, Changes: changes}); err != nil {
+		logError(fmt.Sprintf("Failed to publish update of part %d", id), err)
+		return nil, err
+	}
+	if priceChanged {
+		err := insertEvent(tx, PriceChangedEvent{
+			Part:      *updated,
+			OldPrice:  stored.Price,
+			OldAmount: stored.PriceAmount,
+			NewPrice:  price,
+			NewAmount: parsedPrice.Amount,
+		})
+		if err != nil {
+			logError(fmt.Sprintf("Failed to publish price change of part %d", id), err)
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logError("Failed to commit part", err)
+		return nil, err
+	}
+	c.eventsStored()
+
+	return updated, nil
 }
 
 // DeletePart deletes a part from the database
 func (c *SQLClient) DeletePart(id int) error {
+	if err := c.deletePartChildren("id = ?", id); err != nil {
+		logError(fmt.Sprintf("Failed to delete related rows of part %d", id), err)
+		return err
+	}
+
 	result, err := c.db.Exec("DELETE FROM parts WHERE id = ?", id)
 	if err != nil {
 		logError(fmt.Sprintf("Failed to delete part with ID %d", id), err)
@@ -645,6 +922,11 @@ func (c *SQLClient) DeletePart(id int) error {
 
 // DeletePartsBySiteID deletes all parts for a specific site
 func (c *SQLClient) DeletePartsBySiteID(siteID int) error {
+	if err := c.deletePartChildren("site_id = ?", siteID); err != nil {
+		logError(fmt.Sprintf("Failed to delete related rows of parts for site ID %d", siteID), err)
+		return err
+	}
+
 	result, err := c.db.Exec("DELETE FROM parts WHERE site_id = ?", siteID)
 	if err != nil {
 		logError(fmt.Sprintf("Failed to delete parts for site ID %d", siteID), err)
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	. "dsmpartsfinder-api/models"
+)
+
+const digestSubscriptionColumns = "id, email, frequency, enabled, last_sent_at, created_at, updated_at"
+
+// scanDigestSubscription scans a single digest subscription row
+func scanDigestSubscription(scanner rowScanner) (*DigestSubscription, error) {
+	var subscription DigestSubscription
+	var lastSentAt interface{}
+	err := scanner.Scan(&subscription.ID, &subscription.Email, &subscription.Frequency, &subscription.Enabled,
+		&lastSentAt, &subscription.CreatedAt, &subscription.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	subscription.LastSentAt = parseDBTime(lastSentAt)
+	return &subscription, nil
+}
+
+// GetDigestSubscriptions retrieves the digest subscriptions, optionally only the enabled ones of
+// a frequency
+func (c *SQLClient) GetDigestSubscriptions(frequency string, enabledOnly bool) ([]DigestSubscription, error) {
+	query := "SELECT " + digestSubscriptionColumns + " FROM digest_subscriptions WHERE 1=1"
+	params := make([]interface{}, 0)
+	if frequency != "" {
+		query += " AND frequency = ?"
+		params = append(params, frequency)
+	}
+	if enabledOnly {
+		query += " AND enabled = 1"
+	}
+	query += " ORDER BY id"
+
+	rows, err := c.db.Query(query, params...)
+	if err != nil {
+		logError("Failed to query digest subscriptions", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := make([]DigestSubscription, 0)
+	for rows.Next() {
+		subscription, err := scanDigestSubscription(rows)
+		if err != nil {
+			logError("Failed to scan digest subscription data", err)
+			return nil, err
+		}
+		subscriptions = append(subscriptions, *subscription)
+	}
+
+	if err = rows.Err(); err != nil {
+		logError("Error iterating digest subscriptions", err)
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+// GetDigestSubscriptionByID retrieves a single digest subscription by its ID
+func (c *SQLClient) GetDigestSubscriptionByID(id int) (*DigestSubscription, error) {
+	row := c.db.QueryRow("SELECT "+digestSubscriptionColumns+" FROM digest_subscriptions WHERE id = ?", id)
+	subscription, err := scanDigestSubscription(row)
+	if err == sql.ErrNoRows {
+		return nil, sql.ErrNoRows
+	} else if err != nil {
+		logError(fmt.Sprintf("Failed to query digest subscription with ID %d", id), err)
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// CreateDigestSubscription creates a new digest subscription in the database
+func (c *SQLClient) CreateDigestSubscription(req DigestSubscriptionRequest) (*DigestSubscription, error) {
+	enabled := req.Enabled == nil || *req.Enabled
+
+	result, err := c.db.Exec("INSERT INTO digest_subscriptions (email, frequency, enabled) VALUES (?, ?, ?)",
+		req.Email, req.Frequency, enabled)
+	if err != nil {
+		logError("Failed to create digest subscription", err)
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		logError("Failed to get last insert ID for digest subscription", err)
+		return nil, err
+	}
+
+	logSuccess(fmt.Sprintf("Created digest subscription with ID %d", id))
+	return c.GetDigestSubscriptionByID(int(id))
+}
+
+// UpdateDigestSubscription updates an existing digest subscription in the database
+func (c *SQLClient) UpdateDigestSubscription(id int, req DigestSubscriptionRequest) (*DigestSubscription, error) {
+	enabled := req.Enabled == nil || *req.Enabled
+
+	result, err := c.db.Exec(`
+		UPDATE digest_subscriptions
+		SET email = ?, frequency = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, req.Email, req.Frequency, enabled, id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to update digest subscription with ID %d", id), err)
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logError("Failed to get rows affected", err)
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	logSuccess(fmt.Sprintf("Updated digest subscription with ID %d", id))
+	return c.GetDigestSubscriptionByID(id)
+}
+
+// DeleteDigestSubscription deletes a digest subscription
+func (c *SQLClient) DeleteDigestSubscription(id int) error {
+	result, err := c.db.Exec("DELETE FROM digest_subscriptions WHERE id = ?", id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to delete digest subscription with ID %d", id), err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logError("Failed to get rows affected", err)
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	logSuccess(fmt.Sprintf("Deleted digest subscription with ID %d", id))
+	return nil
+}
+
+// MarkDigestSent records the end of the period of the digest sent to a subscription, the next
+// digest starts there
+func (c *SQLClient) MarkDigestSent(id int, until time.Time) error {
+	_, err := c.db.Exec("UPDATE digest_subscriptions SET last_sent_at = ? WHERE id = ?", dbTime(until), id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to mark digest of subscription %d as sent", id), err)
+	}
+	return err
+}
+
+// GetPartsStoredBetween retrieves the parts first stored in a period that were not removed
+// since, ordered by site and category
+func (c *SQLClient) GetPartsStoredBetween(since, until time.Time) ([]Part, error) {
+	parts, err := c.queryParts(`
+		SELECT `+partColumns+` FROM parts
+		WHERE created_at >= ? AND created_at < ? AND status != ?
+		ORDER BY site_id, type_name, id
+	`, dbTime(since), dbTime(until), PartStatusRemoved)
+	if err != nil {
+		logError("Failed to query parts stored in period", err)
+		return nil, err
+	}
+	return parts, nil
+}
+
+// GetPartsRemovedBetween retrieves the parts removed in a period, ordered by site
+func (c *SQLClient) GetPartsRemovedBetween(since, until time.Time) ([]Part, error) {
+	parts, err := c.queryParts(`
+		SELECT `+partColumns+` FROM parts
+		WHERE status = ? AND removed_at >= ? AND removed_at < ?
+		ORDER BY site_id, removed_at, id
+	`, PartStatusRemoved, dbTime(since), dbTime(until))
+	if err != nil {
+		logError("Failed to query parts removed in period", err)
+		return nil, err
+	}
+	return parts, nil
+}
+
+// GetPriceDropsBetween retrieves the parts that are cheaper than before a period because of a
+// price change in it. The old price is the last one observed before the period.
+func (c *SQLClient) GetPriceDropsBetween(since, until time.Time) ([]DigestPriceDrop, error) {
+	rows, err := c.db.Query(`
+		SELECT p.id, before.price, before.price_amount
+		FROM parts p
+		JOIN part_price_history before ON before.id = (
+			SELECT id FROM part_price_history
+			WHERE part_id = p.id AND observed_at < ?
+			ORDER BY observed_at DESC, id DESC LIMIT 1
+		)
+		WHERE p.status != ?
+			AND p.price_amount < before.price_amount
+			AND p.price_currency = before.price_currency
+			AND EXISTS (
+				SELECT 1 FROM part_price_history h
+				WHERE h.part_id = p.id AND h.observed_at >= ? AND h.observed_at < ?
+			)
+		ORDER BY p.id
+	`, dbTime(since), PartStatusRemoved, dbTime(since), dbTime(until))
+	if err != nil {
+		logError("Failed to query price drops in period", err)
+		return nil, err
+	}
+
+	drops := make([]DigestPriceDrop, 0)
+	partIDs := make([]int, 0)
+	for rows.Next() {
+		var drop DigestPriceDrop
+		var partID int
+		if err := rows.Scan(&partID, &drop.OldPrice, &drop.OldAmount); err != nil {
+			rows.Close()
+			logError("Failed to scan price drop", err)
+			return nil, err
+		}
+		drops = append(drops, drop)
+		partIDs = append(partIDs, partID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		logError("Error iterating price drops", err)
+		return nil, err
+	}
+
+	for i, partID := range partIDs {
+		part, err := c.GetPartByID(partID)
+		if err != nil {
+			return nil, err
+		}
+		drops[i].Part = *part
+		if drops[i].OldAmount > 0 && part.PriceAmount != nil {
+			drops[i].Percent = int((drops[i].OldAmount - *part.PriceAmount) * 100 / drops[i].OldAmount)
+		}
+	}
+	return drops, nil
+}
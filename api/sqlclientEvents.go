@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	. "dsmpartsfinder-api/models"
+)
+
+const eventColumns = "id, type, site_id, part_id, payload, created_at"
+
+// scanEvent scans a single event row selected with eventColumns
+func scanEvent(scanner rowScanner) (*Event, error) {
+	var event Event
+	var siteID, partID sql.NullInt64
+	var payload string
+	if err := scanner.Scan(&event.ID, &event.Type, &siteID, &partID, &payload, &event.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	event.SiteID = int(siteID.Int64)
+	event.PartID = int(partID.Int64)
+	event.Payload = json.RawMessage(payload)
+	return &event, nil
+}
+
+// nullableID converts an optional ID into a value for a nullable column
+func nullableID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// insertEvent writes an event to the outbox. Pass a transaction to store the event together
+// with the change it describes.
+func insertEvent(db execer, event DomainEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event.EventType(), err)
+	}
+
+	siteID, partID := event.Subject()
+	_, err = db.Exec("INSERT INTO event_outbox (type, site_id, part_id, payload) VALUES (?, ?, ?, ?)",
+		event.EventType(), nullableID(siteID), nullableID(partID), string(payload))
+	return err
+}
+
+// SetEventHook sets a function called after events were written to the outbox, so the event
+// bus does not have to wait for its next poll
+func (c *SQLClient) SetEventHook(hook func()) {
+	c.eventHook = hook
+}
+
+// eventsStored calls the event hook
+func (c *SQLClient) eventsStored() {
+	if c.eventHook != nil {
+		c.eventHook()
+	}
+}
+
+// PublishEvent writes an event to the outbox on its own
+func (c *SQLClient) PublishEvent(event DomainEvent) error {
+	if err := insertEvent(c.db, event); err != nil {
+		logError(fmt.Sprintf("Failed to publish %s event", event.EventType()), err)
+		return err
+	}
+	c.eventsStored()
+	return nil
+}
+
+// GetEventsAfter retrieves up to limit events with an ID after afterID, oldest first
+func (c *SQLClient) GetEventsAfter(afterID, limit int) ([]Event, error) {
+	return c.queryEvents("SELECT "+eventColumns+" FROM event_outbox WHERE id > ? ORDER BY id LIMIT ?", afterID, limit)
+}
+
+// buildEventFilterWhere builds the WHERE clause and parameters for an event filter
+func buildEventFilterWhere(filter EventFilter) (string, []interface{}) {
+	conditions := make([]string, 0)
+	params := make([]interface{}, 0)
+
+	if filter.Type != "" {
+		conditions = append(conditions, "type = ?")
+		params = append(params, filter.Type)
+	}
+	if filter.SiteID != 0 {
+		conditions = append(conditions, "site_id = ?")
+		params = append(params, filter.SiteID)
+	}
+	if filter.PartID != 0 {
+		conditions = append(conditions, "part_id = ?")
+		params = append(params, filter.PartID)
+	}
+
+	if len(conditions) == 0 {
+		return "", params
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), params
+}
+
+// GetEvents retrieves the events matching the filter, newest first
+func (c *SQLClient) GetEvents(filter EventFilter, limit, offset int) ([]Event, error) {
+	where, params := buildEventFilterWhere(filter)
+	params = append(params, limit, offset)
+	return c.queryEvents("SELECT "+eventColumns+" FROM event_outbox"+where+" ORDER BY id DESC LIMIT ? OFFSET ?", params...)
+}
+
+// GetEventsCount counts the events matching the filter
+func (c *SQLClient) GetEventsCount(filter EventFilter) (int, error) {
+	where, params := buildEventFilterWhere(filter)
+
+	var count int
+	if err := c.db.QueryRow("SELECT COUNT(*) FROM event_outbox"+where, params...).Scan(&count); err != nil {
+		logError("Failed to count events", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// queryEvents runs a query selecting eventColumns and scans the events
+func (c *SQLClient) queryEvents(query string, args ...interface{}) ([]Event, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		logError("Failed to query events", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]Event, 0)
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			logError("Failed to scan event data", err)
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+
+	if err = rows.Err(); err != nil {
+		logError("Error iterating events", err)
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetEventCursor returns the last event a subscriber handled. A new subscriber starts after
+// the latest event, it does not get the events from before it existed.
+func (c *SQLClient) GetEventCursor(subscriber string) (int, error) {
+	_, err := c.db.Exec(`
+		INSERT OR IGNORE INTO event_cursors (subscriber, last_event_id)
+		VALUES (?, (SELECT COALESCE(MAX(id), 0) FROM event_outbox))
+	`, subscriber)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to create event cursor of %s", subscriber), err)
+		return 0, err
+	}
+
+	var lastEventID int
+	err = c.db.QueryRow("SELECT last_event_id FROM event_cursors WHERE subscriber = ?", subscriber).Scan(&lastEventID)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to query event cursor of %s", subscriber), err)
+		return 0, err
+	}
+	return lastEventID, nil
+}
+
+// AdvanceEventCursor records that a subscriber handled every event up to lastEventID
+func (c *SQLClient) AdvanceEventCursor(subscriber string, lastEventID int) error {
+	_, err := c.db.Exec("UPDATE event_cursors SET last_event_id = ?, updated_at = CURRENT_TIMESTAMP WHERE subscriber = ?",
+		lastEventID, subscriber)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to advance event cursor of %s", subscriber), err)
+	}
+	return err
+}
+
+// PruneEvents deletes the events created before the given time, up to the event with ID upToID
+func (c *SQLClient) PruneEvents(before time.Time, upToID int) (int64, error) {
+	result, err := c.db.Exec("DELETE FROM event_outbox WHERE created_at < ? AND id <= ?", dbTime(before), upToID)
+	if err != nil {
+		logError("Failed to prune events", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
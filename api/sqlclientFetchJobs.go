@@ -0,0 +1,302 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	. "dsmpartsfinder-api/models"
+)
+
+const fetchJobColumns = `id, site_id, profile_id, triggered_by, params, status, attempts, max_attempts, last_error,
+	pages_done, parts_found, new_count, run_after, created_at, started_at, finished_at`
+
+// scanFetchJob scans a single fetch job row selected with fetchJobColumns
+func scanFetchJob(scanner rowScanner) (*FetchJob, error) {
+	var job FetchJob
+	var profileID sql.NullInt64
+	var params string
+	var runAfter, startedAt, finishedAt interface{}
+	err := scanner.Scan(
+		&job.ID, &job.SiteID, &profileID, &job.Trigger, &params, &job.Status, &job.Attempts, &job.MaxAttempts,
+		&job.LastError, &job.PagesDone, &job.PartsFound, &job.NewCount, &runAfter, &job.CreatedAt, &startedAt, &finishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if profileID.Valid {
+		id := int(profileID.Int64)
+		job.ProfileID = &id
+	}
+	job.Params = json.RawMessage(params)
+	job.RunAfter = parseDBTime(runAfter)
+	job.StartedAt = parseDBTime(startedAt)
+	job.FinishedAt = parseDBTime(finishedAt)
+	return &job, nil
+}
+
+// EnqueueFetchJob queues a fetch of a site. When a job for the same site, profile and params is
+// still queued, that job is returned instead and coalesced is true.
+func (c *SQLClient) EnqueueFetchJob(siteID, profileID int, trigger string, params interface{}, maxAttempts int) (job *FetchJob, coalesced bool, err error) {
+	encodedParams, err := json.Marshal(params)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode fetch params: %w", err)
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		logError("Failed to begin transaction", err)
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	var nullableProfileID interface{}
+	if profileID != 0 {
+		nullableProfileID = profileID
+	}
+
+	// Only jobs of the same profile are coalesced, IS matches the NULL of jobs without one
+	var id int64
+	err = tx.QueryRow("SELECT id FROM fetch_jobs WHERE site_id = ? AND profile_id IS ? AND params = ? AND status = ? ORDER BY id LIMIT 1",
+		siteID, nullableProfileID, string(encodedParams), FetchJobQueued).Scan(&id)
+	if err == nil {
+		coalesced = true
+	} else if err != sql.ErrNoRows {
+		logError("Failed to look up queued fetch jobs", err)
+		return nil, false, err
+	} else {
+		result, err := tx.Exec(`
+			INSERT INTO fetch_jobs (site_id, profile_id, triggered_by, params, status, max_attempts, run_after)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, siteID, nullableProfileID, trigger, string(encodedParams), FetchJobQueued, maxAttempts, dbTime(time.Now()))
+		if err != nil {
+			logError("Failed to enqueue fetch job", err)
+			return nil, false, err
+		}
+
+		id, err = result.LastInsertId()
+		if err != nil {
+			logError("Failed to get last insert ID for fetch job", err)
+			return nil, false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logError("Failed to commit fetch job", err)
+		return nil, false, err
+	}
+
+	job, err = c.GetFetchJobByID(int(id))
+	return job, coalesced, err
+}
+
+// ClaimNextFetchJob marks the oldest due job of a site without running jobs as running and
+// returns it, or nil when no job can run right now
+func (c *SQLClient) ClaimNextFetchJob() (*FetchJob, error) {
+	var id int
+	err := c.db.QueryRow(`
+		UPDATE fetch_jobs
+		SET status = ?, attempts = attempts + 1, pages_done = 0, parts_found = 0, started_at = CURRENT_TIMESTAMP, finished_at = NULL
+		WHERE id = (
+			SELECT id FROM fetch_jobs
+			WHERE status = ? AND run_after <= ?
+				AND site_id NOT IN (SELECT site_id FROM fetch_jobs WHERE status = ?)
+			ORDER BY run_after, id
+			LIMIT 1
+		)
+		RETURNING id
+	`, FetchJobRunning, FetchJobQueued, dbTime(time.Now()), FetchJobRunning).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		logError("Failed to claim fetch job", err)
+		return nil, err
+	}
+	return c.GetFetchJobByID(id)
+}
+
+// FinishFetchJob stores the final status of a job
+func (c *SQLClient) FinishFetchJob(id int, status, lastError string, newCount int) error {
+	_, err := c.db.Exec("UPDATE fetch_jobs SET status = ?, last_error = ?, new_count = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ?",
+		status, lastError, newCount, id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to finish fetch job %d", id), err)
+	}
+	return err
+}
+
+// RetryFetchJob queues a failed job again, to run no earlier than runAfter
+func (c *SQLClient) RetryFetchJob(id int, lastError string, runAfter time.Time) error {
+	_, err := c.db.Exec("UPDATE fetch_jobs SET status = ?, last_error = ?, run_after = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ?",
+		FetchJobQueued, lastError, dbTime(runAfter), id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to retry fetch job %d", id), err)
+	}
+	return err
+}
+
+// CancelQueuedFetchJob cancels a job that has not started yet. It returns false when the job
+// is not queued.
+func (c *SQLClient) CancelQueuedFetchJob(id int) (bool, error) {
+	result, err := c.db.Exec("UPDATE fetch_jobs SET status = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?",
+		FetchJobCancelled, id, FetchJobQueued)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to cancel fetch job %d", id), err)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logError("Failed to get rows affected", err)
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// UpdateFetchJobProgress stores the pages fetched and parts found so far by a running job
+func (c *SQLClient) UpdateFetchJobProgress(id, pagesDone, partsFound int) error {
+	_, err := c.db.Exec("UPDATE fetch_jobs SET pages_done = ?, parts_found = ? WHERE id = ?", pagesDone, partsFound, id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to update progress of fetch job %d", id), err)
+	}
+	return err
+}
+
+// RequeueInterruptedFetchJobs queues the jobs that were running when the API stopped again.
+// The interrupted attempt does not count.
+func (c *SQLClient) RequeueInterruptedFetchJobs() (int64, error) {
+	result, err := c.db.Exec(`
+		UPDATE fetch_jobs
+		SET status = ?, attempts = MAX(attempts - 1, 0), started_at = NULL
+		WHERE status = ?
+	`, FetchJobQueued, FetchJobRunning)
+	if err != nil {
+		logError("Failed to requeue interrupted fetch jobs", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetFetchJobByID retrieves a single fetch job by its ID
+func (c *SQLClient) GetFetchJobByID(id int) (*FetchJob, error) {
+	row := c.db.QueryRow("SELECT "+fetchJobColumns+" FROM fetch_jobs WHERE id = ?", id)
+	job, err := scanFetchJob(row)
+	if err == sql.ErrNoRows {
+		return nil, sql.ErrNoRows
+	} else if err != nil {
+		logError(fmt.Sprintf("Failed to query fetch job with ID %d", id), err)
+		return nil, err
+	}
+	return job, nil
+}
+
+// CreateFetchBatch records a fetch requested through the API and links its jobs
+func (c *SQLClient) CreateFetchBatch(params interface{}, jobIDs []int) (int, error) {
+	encodedParams, err := json.Marshal(params)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode fetch params: %w", err)
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		logError("Failed to begin transaction", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO fetch_batches (params) VALUES (?)", string(encodedParams))
+	if err != nil {
+		logError("Failed to create fetch batch", err)
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		logError("Failed to get last insert ID for fetch batch", err)
+		return 0, err
+	}
+
+	for _, jobID := range jobIDs {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO fetch_batch_jobs (batch_id, job_id) VALUES (?, ?)", id, jobID); err != nil {
+			logError(fmt.Sprintf("Failed to link fetch job %d to batch %d", jobID, id), err)
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logError("Failed to commit fetch batch", err)
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// GetFetchBatchByID retrieves a fetch batch with its jobs, ordered by site
+func (c *SQLClient) GetFetchBatchByID(id int) (*FetchBatch, error) {
+	var batch FetchBatch
+	var params string
+	var cancelledAt interface{}
+	err := c.db.QueryRow("SELECT id, params, created_at, cancelled_at FROM fetch_batches WHERE id = ?", id).
+		Scan(&batch.ID, &params, &batch.CreatedAt, &cancelledAt)
+	if err == sql.ErrNoRows {
+		return nil, sql.ErrNoRows
+	} else if err != nil {
+		logError(fmt.Sprintf("Failed to query fetch batch with ID %d", id), err)
+		return nil, err
+	}
+	batch.Params = json.RawMessage(params)
+	batch.CancelledAt = parseDBTime(cancelledAt)
+
+	rows, err := c.db.Query(`
+		SELECT `+fetchJobColumns+` FROM fetch_jobs
+		WHERE id IN (SELECT job_id FROM fetch_batch_jobs WHERE batch_id = ?)
+		ORDER BY site_id, id
+	`, id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to query jobs of fetch batch %d", id), err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	batch.Jobs = make([]FetchJob, 0)
+	for rows.Next() {
+		job, err := scanFetchJob(rows)
+		if err != nil {
+			logError("Failed to scan fetch job data", err)
+			return nil, err
+		}
+		batch.Jobs = append(batch.Jobs, *job)
+		batch.PagesDone += job.PagesDone
+		batch.PartsFound += job.PartsFound
+		batch.NewCount += job.NewCount
+	}
+
+	if err = rows.Err(); err != nil {
+		logError("Error iterating fetch jobs", err)
+		return nil, err
+	}
+
+	batch.Status = FetchBatchStatus(batch.Jobs, batch.CancelledAt != nil)
+	return &batch, nil
+}
+
+// MarkFetchBatchCancelled records that a fetch batch was cancelled
+func (c *SQLClient) MarkFetchBatchCancelled(id int) error {
+	result, err := c.db.Exec("UPDATE fetch_batches SET cancelled_at = COALESCE(cancelled_at, CURRENT_TIMESTAMP) WHERE id = ?", id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to cancel fetch batch %d", id), err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logError("Failed to get rows affected", err)
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
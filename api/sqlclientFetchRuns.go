@@ -0,0 +1,218 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	. "dsmpartsfinder-api/models"
+)
+
+const fetchRunColumns = `id, site_id, profile_id, triggered_by, params, status, complete, incomplete_reason,
+	fetched_count, new_count, updated_count, stale_count, error_count, error, proxy_failures, started_at, finished_at`
+
+// scanFetchRun scans a single fetch run row selected with fetchRunColumns
+func scanFetchRun(scanner rowScanner) (*FetchRun, error) {
+	var run FetchRun
+	var profileID sql.NullInt64
+	var params, proxyFailures string
+	var finishedAt interface{}
+	err := scanner.Scan(
+		&run.ID, &run.SiteID, &profileID, &run.Trigger, &params, &run.Status, &run.Complete, &run.IncompleteReason,
+		&run.FetchedCount, &run.NewCount, &run.UpdatedCount, &run.StaleCount, &run.ErrorCount, &run.Error,
+		&proxyFailures, &run.StartedAt, &finishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if profileID.Valid {
+		id := int(profileID.Int64)
+		run.ProfileID = &id
+	}
+	run.Params = json.RawMessage(params)
+	run.ProxyFailures = make([]ProxyFailure, 0)
+	if err := json.Unmarshal([]byte(proxyFailures), &run.ProxyFailures); err != nil {
+		return nil, fmt.Errorf("failed to decode proxy failures of fetch run %d: %w", run.ID, err)
+	}
+	run.FinishedAt = parseDBTime(finishedAt)
+	return &run, nil
+}
+
+// CreateFetchRun records the start of a fetch run
+func (c *SQLClient) CreateFetchRun(siteID, profileID int, trigger string, params interface{}) (*FetchRun, error) {
+	encodedParams, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode fetch params: %w", err)
+	}
+
+	var nullableProfileID interface{}
+	if profileID != 0 {
+		nullableProfileID = profileID
+	}
+
+	result, err := c.db.Exec(`
+		INSERT INTO fetch_runs (site_id, profile_id, triggered_by, params, status)
+		VALUES (?, ?, ?, ?, ?)
+	`, siteID, nullableProfileID, trigger, string(encodedParams), FetchRunRunning)
+	if err != nil {
+		logError("Failed to create fetch run", err)
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		logError("Failed to get last insert ID for fetch run", err)
+		return nil, err
+	}
+
+	return c.GetFetchRunByID(int(id))
+}
+
+// FinishFetchRun stores the outcome of a fetch run
+func (c *SQLClient) FinishFetchRun(run *FetchRun) error {
+	proxyFailures := run.ProxyFailures
+	if proxyFailures == nil {
+		proxyFailures = make([]ProxyFailure, 0)
+	}
+	encodedProxyFailures, err := json.Marshal(proxyFailures)
+	if err != nil {
+		return fmt.Errorf("failed to encode proxy failures: %w", err)
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		logError("Failed to begin fetch run transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE fetch_runs
+		SET status = ?, complete = ?, incomplete_reason = ?, fetched_count = ?, new_count = ?, updated_count = ?,
+			stale_count = ?, error_count = ?, error = ?, proxy_failures = ?, finished_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, run.Status, run.Complete, run.IncompleteReason, run.FetchedCount, run.NewCount, run.UpdatedCount,
+		run.StaleCount, run.ErrorCount, run.Error, string(encodedProxyFailures), run.ID)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to finish fetch run %d", run.ID), err)
+		return err
+	}
+
+	finished, err := scanFetchRun(tx.QueryRow("SELECT "+fetchRunColumns+" FROM fetch_runs WHERE id = ?", run.ID))
+	if err != nil {
+		logError(fmt.Sprintf("Failed to read back fetch run %d", run.ID), err)
+		return err
+	}
+	if err := insertEvent(tx, FetchRunFinishedEvent{Run: *finished}); err != nil {
+		logError(fmt.Sprintf("Failed to publish end of fetch run %d", run.ID), err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logError("Failed to commit fetch run", err)
+		return err
+	}
+	c.eventsStored()
+
+	run.FinishedAt = finished.FinishedAt
+	return nil
+}
+
+// FailInterruptedFetchRuns marks runs that were still running when the API stopped as failed
+func (c *SQLClient) FailInterruptedFetchRuns() (int64, error) {
+	result, err := c.db.Exec(`
+		UPDATE fetch_runs
+		SET status = ?, error = 'interrupted by a restart', finished_at = CURRENT_TIMESTAMP
+		WHERE status = ?
+	`, FetchRunFailed, FetchRunRunning)
+	if err != nil {
+		logError("Failed to fail interrupted fetch runs", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetFetchRunByID retrieves a single fetch run by its ID
+func (c *SQLClient) GetFetchRunByID(id int) (*FetchRun, error) {
+	row := c.db.QueryRow("SELECT "+fetchRunColumns+" FROM fetch_runs WHERE id = ?", id)
+	run, err := scanFetchRun(row)
+	if err == sql.ErrNoRows {
+		return nil, sql.ErrNoRows
+	} else if err != nil {
+		logError(fmt.Sprintf("Failed to query fetch run with ID %d", id), err)
+		return nil, err
+	}
+	return run, nil
+}
+
+// buildFetchRunFilterWhere builds the WHERE conditions and parameters for a fetch run filter
+func buildFetchRunFilterWhere(filter FetchRunFilter) (string, []interface{}) {
+	conditions := make([]string, 0)
+	params := make([]interface{}, 0)
+
+	if filter.SiteID != 0 {
+		conditions = append(conditions, "site_id = ?")
+		params = append(params, filter.SiteID)
+	}
+	if filter.ProfileID != 0 {
+		conditions = append(conditions, "profile_id = ?")
+		params = append(params, filter.ProfileID)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		params = append(params, filter.Status)
+	}
+	if filter.Trigger != "" {
+		conditions = append(conditions, "triggered_by = ?")
+		params = append(params, filter.Trigger)
+	}
+
+	if len(conditions) == 0 {
+		return "", params
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), params
+}
+
+// GetFetchRuns retrieves fetch runs matching the filter, newest first
+func (c *SQLClient) GetFetchRuns(filter FetchRunFilter, limit, offset int) ([]FetchRun, error) {
+	where, params := buildFetchRunFilterWhere(filter)
+	query := "SELECT " + fetchRunColumns + " FROM fetch_runs" + where + " ORDER BY started_at DESC, id DESC LIMIT ? OFFSET ?"
+	params = append(params, limit, offset)
+
+	rows, err := c.db.Query(query, params...)
+	if err != nil {
+		logError("Failed to query fetch runs", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]FetchRun, 0)
+	for rows.Next() {
+		run, err := scanFetchRun(rows)
+		if err != nil {
+			logError("Failed to scan fetch run data", err)
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+
+	if err = rows.Err(); err != nil {
+		logError("Error iterating fetch runs", err)
+		return nil, err
+	}
+	return runs, nil
+}
+
+// GetFetchRunsCount counts the fetch runs matching the filter
+func (c *SQLClient) GetFetchRunsCount(filter FetchRunFilter) (int, error) {
+	where, params := buildFetchRunFilterWhere(filter)
+
+	var count int
+	if err := c.db.QueryRow("SELECT COUNT(*) FROM fetch_runs"+where, params...).Scan(&count); err != nil {
+		logError("Failed to count fetch runs", err)
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+)
+
+// hashIngestToken returns the hex SHA-256 of an ingest token, which is all that is stored
+func hashIngestToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSiteIngestToken creates a new ingest token for a site, replacing any previous one. The
+// token is only returned here, the database keeps its hash.
+func (c *SQLClient) CreateSiteIngestToken(siteID int) (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		logError("Failed to create ingest token", err)
+		return "", err
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	result, err := c.db.Exec("UPDATE sites SET ingest_token_hash = ? WHERE id = ?", hashIngestToken(token), siteID)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to store ingest token of site with ID %d", siteID), err)
+		return "", err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logError("Failed to get rows affected", err)
+		return "", err
+	}
+
+	if rowsAffected == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	logSuccess(fmt.Sprintf("Created ingest token for site with ID %d", siteID))
+	return token, nil
+}
+
+// RevokeSiteIngestToken removes the ingest token of a site, disabling ingest for it
+func (c *SQLClient) RevokeSiteIngestToken(siteID int) error {
+	result, err := c.db.Exec("UPDATE sites SET ingest_token_hash = '' WHERE id = ?", siteID)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to revoke ingest token of site with ID %d", siteID), err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logError("Failed to get rows affected", err)
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	logSuccess(fmt.Sprintf("Revoked ingest token of site with ID %d", siteID))
+	return nil
+}
+
+// CheckSiteIngestToken reports whether token is the ingest token of a site. A site without a
+// token accepts none.
+func (c *SQLClient) CheckSiteIngestToken(siteID int, token string) (bool, error) {
+	var tokenHash string
+	err := c.db.QueryRow("SELECT ingest_token_hash FROM sites WHERE id = ?", siteID).Scan(&tokenHash)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		logError(fmt.Sprintf("Failed to query ingest token of site with ID %d", siteID), err)
+		return false, err
+	}
+
+	if tokenHash == "" || token == "" {
+		return false, nil
+	}
+	return subtle.ConstantTimeCompare([]byte(hashIngestToken(token)), []byte(tokenHash)) == 1, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	. "dsmpartsfinder-api/models"
+)
+
+// defaultGracePeriodHours is how long parts may go unseen before they are marked removed
+const defaultGracePeriodHours = 72
+
+// dbTime formats a time like CURRENT_TIMESTAMP does, for comparisons with timestamp columns
+func dbTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// ReviveParts makes missing and removed parts that were seen again active and logs the status
+// change. Parts that come back after being removed are marked as relisted.
+func (c *SQLClient) ReviveParts(partIDs []string, siteID int) (int64, error) {
+	if len(partIDs) == 0 {
+		return 0, nil
+	}
+
+	placeholders := make([]string, len(partIDs))
+	partArgs := make([]interface{}, len(partIDs))
+
+	for i, partID := range partIDs {
+		placeholders[i] = "?"
+		partArgs[i] = partID
+	}
+	inClause := strings.Join(placeholders, ",")
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		logError("Failed to begin revive transaction", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	args := append([]interface{}{PartStatusActive, siteID, PartStatusActive}, partArgs...)
+	_, err = tx.Exec(fmt.Sprintf(`
+		INSERT INTO part_changes (part_id, field, old_value, new_value)
+		SELECT id, 'status', status, ? FROM parts
+		WHERE site_id = ? AND status != ? AND part_id IN (%s)
+	`, inClause), args...)
+	if err != nil {
+		logError("Failed to log revived parts", err)
+		return 0, err
+	}
+
+	args = append([]interface{}{PartStatusRemoved, PartStatusActive, siteID, PartStatusActive}, partArgs...)
+	result, err := tx.Exec(fmt.Sprintf(`
+		UPDATE parts
+		SET relisted_at = CASE WHEN status = ? THEN CURRENT_TIMESTAMP ELSE relisted_at END,
+			status = ?, missing_since = NULL, removed_at = NULL
+		WHERE site_id = ? AND status != ? AND part_id IN (%s)
+	`, inClause), args...)
+	if err != nil {
+		logError("Failed to revive parts", err)
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logError("Failed to commit revived parts", err)
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected > 0 {
+		log.Printf("Revived %d parts in site ID %d", rowsAffected, siteID)
+	}
+	return rowsAffected, nil
+}
+
+// MarkMissingParts marks the active parts found by a search profile that were not seen
+// since the given time, i.e. not by the fetch that started then, as missing and logs the
+// status change
+func (c *SQLClient) MarkMissingParts(siteID, profileID int, seenBefore time.Time) (int64, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		logError("Failed to begin missing parts transaction", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO part_changes (part_id, field, old_value, new_value)
+		SELECT id, 'status', status, ? FROM parts
+		WHERE site_id = ? AND status = ? AND last_seen < ?
+			AND id IN (SELECT part_id FROM part_search_profiles WHERE profile_id = ?)
+	`, PartStatusMissing, siteID, PartStatusActive, dbTime(seenBefore), profileID)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to log missing parts for site ID %d", siteID), err)
+		return 0, err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE parts
+		SET status = ?, missing_since = CURRENT_TIMESTAMP
+		WHERE site_id = ? AND status = ? AND last_seen < ?
+			AND id IN (SELECT part_id FROM part_search_profiles WHERE profile_id = ?)
+	`, PartStatusMissing, siteID, PartStatusActive, dbTime(seenBefore), profileID)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to mark missing parts for site ID %d", siteID), err)
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logError("Failed to get rows affected for missing parts", err)
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logError("Failed to commit missing parts", err)
+		return 0, err
+	}
+	return rowsAffected, nil
+}
+
+// RemoveStaleParts marks the parts of a site that were not seen since the given time as
+// removed. Removed parts are kept, with their last price, so they stay queryable.
+func (c *SQLClient) RemoveStaleParts(siteID int, notSeenSince time.Time) (int64, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		logError("Failed to begin stale parts transaction", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO part_changes (part_id, field, old_value, new_value)
+		SELECT id, 'status', status, ? FROM parts
+		WHERE site_id = ? AND status != ? AND last_seen < ?
+	`, PartStatusRemoved, siteID, PartStatusRemoved, dbTime(notSeenSince))
+	if err != nil {
+		logError(fmt.Sprintf("Failed to log stale parts for site ID %d", siteID), err)
+		return 0, err
+	}
+
+	removedIDs, err := queryIDs(tx, `
+		UPDATE parts
+		SET status = ?, removed_at = CURRENT_TIMESTAMP, missing_since = COALESCE(missing_since, last_seen)
+		WHERE site_id = ? AND status != ? AND last_seen < ?
+		RETURNING id
+	`, PartStatusRemoved, siteID, PartStatusRemoved, dbTime(notSeenSince))
+	if err != nil {
+		logError(fmt.Sprintf("Failed to remove stale parts for site ID %d", siteID), err)
+		return 0, err
+	}
+
+	for _, id := range removedIDs {
+		part, err := scanPart(tx.QueryRow("SELECT "+partColumns+" FROM parts WHERE id = ?", id))
+		if err != nil {
+			logError(fmt.Sprintf("Failed to read back removed part %d", id), err)
+			return 0, err
+		}
+		if err := insertEvent(tx, PartRemovedEvent{Part: *part}); err != nil {
+			logError(fmt.Sprintf("Failed to publish removal of part %d", id), err)
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logError("Failed to commit stale parts", err)
+		return 0, err
+	}
+	if len(removedIDs) > 0 {
+		c.eventsStored()
+	}
+
+	rowsAffected := int64(len(removedIDs))
+
+	log.Printf("Removed %d stale parts for site ID %d (not seen since %s)", rowsAffected, siteID, notSeenSince.Format("2006-01-02 15:04:05"))
+	return rowsAffected, nil
+}
+
+// FindRelistedPart returns the ID of a recently missing or removed part of a site with the
+// same name, which a new listing is most likely a relist of, or 0 when there is none
+func (c *SQLClient) FindRelistedPart(siteID int, name string, removedSince time.Time, excludeID int) (int, error) {
+	var id int
+	err := c.db.QueryRow(`
+		SELECT id FROM parts
+		WHERE site_id = ? AND id != ? AND name = ? COLLATE NOCASE
+			AND (status = ? OR (status = ? AND removed_at >= ?))
+		ORDER BY COALESCE(removed_at, missing_since) DESC
+		LIMIT 1
+	`, siteID, excludeID, name, PartStatusMissing, PartStatusRemoved, dbTime(removedSince)).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		logError(fmt.Sprintf("Failed to look up relisted part for site ID %d", siteID), err)
+		return 0, err
+	}
+	return id, nil
+}
+
+// SetRelistOf links a new part to the removed listing it relists
+func (c *SQLClient) SetRelistOf(id, relistOf int) error {
+	_, err := c.db.Exec("UPDATE parts SET relist_of = ?, relisted_at = CURRENT_TIMESTAMP WHERE id = ?", relistOf, id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to link part %d as relist of %d", id, relistOf), err)
+	}
+	return err
+}
+
+// queryer is implemented by *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// queryIDs runs a query returning a single integer column and collects the values
+func queryIDs(db queryer, query string, args ...interface{}) ([]int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "dsmpartsfinder-api/models"
+	"dsmpartsfinder-api/prices"
+)
+
+func TestStatusTransitionsAreLogged(t *testing.T) {
+	sqlClient := newTestSQLClient(t)
+
+	const siteID, profileID = 1, 1
+	part, err := sqlClient.CreatePart("p1", "", "Turbo", "TD05H", nil, "https://example.com/p1", siteID, "100 €", prices.Parse("100 €", "EUR"), time.Now())
+	if err != nil {
+		t.Fatalf("CreatePart: %v", err)
+	}
+	if err := sqlClient.AddPartProfileMatches([]string{"p1"}, siteID, profileID); err != nil {
+		t.Fatalf("AddPartProfileMatches: %v", err)
+	}
+
+	// A fetch that started after the part was last seen did not find it
+	if marked, err := sqlClient.MarkMissingParts(siteID, profileID, time.Now().Add(time.Minute)); err != nil || marked != 1 {
+		t.Fatalf("MarkMissingParts = %d, %v, want 1 part", marked, err)
+	}
+	if revived, err := sqlClient.ReviveParts([]string{"p1"}, siteID); err != nil || revived != 1 {
+		t.Fatalf("ReviveParts = %d, %v, want 1 part", revived, err)
+	}
+	if removed, err := sqlClient.RemoveStaleParts(siteID, time.Now().Add(time.Minute)); err != nil || removed != 1 {
+		t.Fatalf("RemoveStaleParts = %d, %v, want 1 part", removed, err)
+	}
+	if revived, err := sqlClient.ReviveParts([]string{"p1"}, siteID); err != nil || revived != 1 {
+		t.Fatalf("ReviveParts = %d, %v, want 1 part", revived, err)
+	}
+
+	changes, err := sqlClient.GetPartChanges(part.ID)
+	if err != nil {
+		t.Fatalf("GetPartChanges: %v", err)
+	}
+	// Newest first
+	want := [][2]string{
+		{PartStatusRemoved, PartStatusActive},
+		{PartStatusActive, PartStatusRemoved},
+		{PartStatusMissing, PartStatusActive},
+		{PartStatusActive, PartStatusMissing},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("logged %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	for i, change := range changes {
+		if change.Field != "status" || change.OldValue != want[i][0] || change.NewValue != want[i][1] {
+			t.Errorf("change %d = %s %s -> %s, want status %s -> %s", i, change.Field, change.OldValue, change.NewValue, want[i][0], want[i][1])
+		}
+	}
+}
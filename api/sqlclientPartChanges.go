@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+
+	. "dsmpartsfinder-api/models"
+)
+
+// insertPartChanges stores the edited fields of a part in its change log
+func insertPartChanges(db execer, partID int, changes []PartChange) error {
+	for _, change := range changes {
+		_, err := db.Exec(`
+			INSERT INTO part_changes (part_id, field, old_value, new_value)
+			VALUES (?, ?, ?, ?)
+		`, partID, change.Field, change.OldValue, change.NewValue)
+		if err != nil {
+			logError(fmt.Sprintf("Failed to record change of %s for part %d", change.Field, partID), err)
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPartChanges returns the change log of a part, newest first
+func (c *SQLClient) GetPartChanges(partID int) ([]PartChange, error) {
+	rows, err := c.db.Query(`
+		SELECT id, part_id, field, old_value, new_value, changed_at
+		FROM part_changes
+		WHERE part_id = ?
+		ORDER BY changed_at DESC, id DESC
+	`, partID)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to query changes of part %d", partID), err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make([]PartChange, 0)
+	for rows.Next() {
+		var change PartChange
+		if err := rows.Scan(&change.ID, &change.PartID, &change.Field, &change.OldValue, &change.NewValue, &change.ChangedAt); err != nil {
+			logError("Failed to scan part change", err)
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	. "dsmpartsfinder-api/models"
+)
+
+// replacePartImages replaces the gallery of a part. Pass a transaction to store the gallery
+// together with the part.
+func replacePartImages(db execer, partID int, images []PartImage) error {
+	if _, err := db.Exec("DELETE FROM part_images WHERE part_id = ?", partID); err != nil {
+		return err
+	}
+	for i, image := range images {
+		_, err := db.Exec("INSERT INTO part_images (part_id, position, image_hash, source_url) VALUES (?, ?, ?, ?)",
+			partID, i, image.Hash, image.SourceURL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPartImages retrieves the gallery of a part, cover first
+func (c *SQLClient) GetPartImages(partID int) ([]PartImage, error) {
+	galleries, err := c.getPartImagesByPartIDs([]int{partID})
+	if err != nil {
+		logError(fmt.Sprintf("Failed to query images of part %d", partID), err)
+		return nil, err
+	}
+	images := galleries[partID]
+	if images == nil {
+		images = make([]PartImage, 0)
+	}
+	return images, nil
+}
+
+// GetImageHashBySourceURL returns the hash of the image last stored for a source URL, or an
+// empty string when no part has an image from it
+func (c *SQLClient) GetImageHashBySourceURL(sourceURL string) (string, error) {
+	var hash string
+	err := c.db.QueryRow(`
+		SELECT image_hash FROM part_images
+		WHERE source_url = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`, sourceURL).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		logError(fmt.Sprintf("Failed to look up image of %s", sourceURL), err)
+		return "", err
+	}
+	return hash, nil
+}
+
+// getPartImagesByPartIDs retrieves the galleries of several parts by their DB IDs
+func (c *SQLClient) getPartImagesByPartIDs(partIDs []int) (map[int][]PartImage, error) {
+	galleries := make(map[int][]PartImage)
+	if len(partIDs) == 0 {
+		return galleries, nil
+	}
+
+	placeholders := make([]string, len(partIDs))
+	args := make([]interface{}, len(partIDs))
+	for i, partID := range partIDs {
+		placeholders[i] = "?"
+		args[i] = partID
+	}
+
+	rows, err := c.db.Query(fmt.Sprintf(`
+		SELECT part_id, position, image_hash, source_url
+		FROM part_images
+		WHERE part_id IN (%s)
+		ORDER BY part_id, position
+	`, strings.Join(placeholders, ",")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var partID, position int
+		var hash, sourceURL string
+		if err := rows.Scan(&partID, &position, &hash, &sourceURL); err != nil {
+			return nil, err
+		}
+		galleries[partID] = append(galleries[partID], NewPartImage(position, hash, sourceURL))
+	}
+	return galleries, rows.Err()
+}
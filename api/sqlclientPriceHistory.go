@@ -0,0 +1,53 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	. "dsmpartsfinder-api/models"
+	"dsmpartsfinder-api/prices"
+)
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertPricePoint records an observed price for a part
+func insertPricePoint(db execer, partID int, price string, parsedPrice prices.Price) error {
+	_, err := db.Exec(`
+		INSERT INTO part_price_history (part_id, price, price_amount, price_currency)
+		VALUES (?, ?, ?, ?)
+	`, partID, price, nullableInt64(parsedPrice.Amount), parsedPrice.Currency)
+	return err
+}
+
+// GetPriceHistory returns the observed prices of a part, oldest first
+func (c *SQLClient) GetPriceHistory(partID int) ([]PricePoint, error) {
+	rows, err := c.db.Query(`
+		SELECT id, part_id, price, price_amount, price_currency, observed_at
+		FROM part_price_history
+		WHERE part_id = ?
+		ORDER BY observed_at ASC, id ASC
+	`, partID)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to query price history of part %d", partID), err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]PricePoint, 0)
+	for rows.Next() {
+		var point PricePoint
+		var amount sql.NullInt64
+		if err := rows.Scan(&point.ID, &point.PartID, &point.Price, &amount, &point.PriceCurrency, &point.ObservedAt); err != nil {
+			logError("Failed to scan price history", err)
+			return nil, err
+		}
+		if amount.Valid {
+			point.PriceAmount = &amount.Int64
+		}
+		history = append(history, point)
+	}
+	return history, rows.Err()
+}
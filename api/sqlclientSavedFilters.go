@@ -0,0 +1,312 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	. "dsmpartsfinder-api/models"
+)
+
+const savedFilterColumns = `id, name, filter, notifier, target, enabled, quiet_hours_start, quiet_hours_end,
+	created_at, updated_at`
+
+// scanSavedFilter scans a single saved filter row
+func scanSavedFilter(scanner rowScanner) (*SavedFilter, error) {
+	var savedFilter SavedFilter
+	var filter string
+	err := scanner.Scan(
+		&savedFilter.ID, &savedFilter.Name, &filter, &savedFilter.Notifier, &savedFilter.Target, &savedFilter.Enabled,
+		&savedFilter.QuietHoursStart, &savedFilter.QuietHoursEnd, &savedFilter.CreatedAt, &savedFilter.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter != "" {
+		if err := json.Unmarshal([]byte(filter), &savedFilter.Filter); err != nil {
+			return nil, fmt.Errorf("invalid filter for saved filter %d: %w", savedFilter.ID, err)
+		}
+	}
+	return &savedFilter, nil
+}
+
+// GetSavedFilters retrieves all saved filters, optionally only the enabled ones
+func (c *SQLClient) GetSavedFilters(enabledOnly bool) ([]SavedFilter, error) {
+	query := "SELECT " + savedFilterColumns + " FROM saved_filters"
+	if enabledOnly {
+		query += " WHERE enabled = 1"
+	}
+	query += " ORDER BY id"
+
+	rows, err := c.db.Query(query)
+	if err != nil {
+		logError("Failed to query saved filters", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	savedFilters := make([]SavedFilter, 0)
+	for rows.Next() {
+		savedFilter, err := scanSavedFilter(rows)
+		if err != nil {
+			logError("Failed to scan saved filter data", err)
+			return nil, err
+		}
+		savedFilters = append(savedFilters, *savedFilter)
+	}
+
+	if err = rows.Err(); err != nil {
+		logError("Error iterating saved filters", err)
+		return nil, err
+	}
+
+	return savedFilters, nil
+}
+
+// GetSavedFilterByID retrieves a single saved filter by its ID
+func (c *SQLClient) GetSavedFilterByID(id int) (*SavedFilter, error) {
+	row := c.db.QueryRow("SELECT "+savedFilterColumns+" FROM saved_filters WHERE id = ?", id)
+	savedFilter, err := scanSavedFilter(row)
+	if err == sql.ErrNoRows {
+		return nil, sql.ErrNoRows
+	} else if err != nil {
+		logError(fmt.Sprintf("Failed to query saved filter with ID %d", id), err)
+		return nil, err
+	}
+	return savedFilter, nil
+}
+
+// CreateSavedFilter creates a new saved filter in the database
+func (c *SQLClient) CreateSavedFilter(req SavedFilterRequest) (*SavedFilter, error) {
+	filter, enabled := savedFilterRequestValues(&req)
+
+	result, err := c.db.Exec(`
+		INSERT INTO saved_filters (name, filter, notifier, target, enabled, quiet_hours_start, quiet_hours_end)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, req.Name, filter, req.Notifier, req.Target, enabled, req.QuietHoursStart, req.QuietHoursEnd)
+	if err != nil {
+		logError("Failed to create saved filter", err)
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		logError("Failed to get last insert ID for saved filter", err)
+		return nil, err
+	}
+
+	logSuccess(fmt.Sprintf("Created saved filter with ID %d", id))
+	return c.GetSavedFilterByID(int(id))
+}
+
+// UpdateSavedFilter updates an existing saved filter in the database. Parts already alerted
+// are not alerted again, even when they match the changed filter differently.
+func (c *SQLClient) UpdateSavedFilter(id int, req SavedFilterRequest) (*SavedFilter, error) {
+	filter, enabled := savedFilterRequestValues(&req)
+
+	result, err := c.db.Exec(`
+		UPDATE saved_filters
+		SET name = ?, filter = ?, notifier = ?, target = ?, enabled = ?, quiet_hours_start = ?, quiet_hours_end = ?,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, req.Name, filter, req.Notifier, req.Target, enabled, req.QuietHoursStart, req.QuietHoursEnd, id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to update saved filter with ID %d", id), err)
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logError("Failed to get rows affected", err)
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	logSuccess(fmt.Sprintf("Updated saved filter with ID %d", id))
+	return c.GetSavedFilterByID(id)
+}
+
+// DeleteSavedFilter deletes a saved filter and its alerts
+func (c *SQLClient) DeleteSavedFilter(id int) error {
+	if _, err := c.db.Exec("DELETE FROM alerts WHERE saved_filter_id = ?", id); err != nil {
+		logError(fmt.Sprintf("Failed to delete alerts for saved filter %d", id), err)
+		return err
+	}
+
+	result, err := c.db.Exec("DELETE FROM saved_filters WHERE id = ?", id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to delete saved filter with ID %d", id), err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logError("Failed to get rows affected", err)
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	logSuccess(fmt.Sprintf("Deleted saved filter with ID %d", id))
+	return nil
+}
+
+// savedFilterRequestValues encodes the filter for storage and fills in the defaults
+func savedFilterRequestValues(req *SavedFilterRequest) (string, bool) {
+	// The sort order has no meaning for alerts
+	req.Filter.SortBy = ""
+	req.Filter.SortDesc = false
+	encoded, _ := json.Marshal(req.Filter)
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	return string(encoded), enabled
+}
+
+// PartMatchesFilter reports whether the part with the given DB ID matches a part filter
+func (c *SQLClient) PartMatchesFilter(id int, filter PartFilter) (bool, error) {
+	where, params := buildPartFilterWhere(filter)
+	params = append([]interface{}{id}, params...)
+
+	var matches bool
+	if err := c.db.QueryRow("SELECT EXISTS (SELECT 1 FROM parts WHERE id = ?"+where+")", params...).Scan(&matches); err != nil {
+		logError(fmt.Sprintf("Failed to match part %d against filter", id), err)
+		return false, err
+	}
+	return matches, nil
+}
+
+const alertColumns = "id, saved_filter_id, part_id, status, attempts, last_error, created_at, sent_at"
+
+// scanAlert scans a single alert row
+func scanAlert(scanner rowScanner) (*SavedFilterAlert, error) {
+	var alert SavedFilterAlert
+	var sentAt interface{}
+	err := scanner.Scan(&alert.ID, &alert.SavedFilterID, &alert.PartID, &alert.Status, &alert.Attempts,
+		&alert.LastError, &alert.CreatedAt, &sentAt)
+	if err != nil {
+		return nil, err
+	}
+	alert.SentAt = parseDBTime(sentAt)
+	return &alert, nil
+}
+
+// queryAlerts runs a query selecting alertColumns and scans the alerts
+func (c *SQLClient) queryAlerts(query string, args ...interface{}) ([]SavedFilterAlert, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		logError("Failed to query alerts", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := make([]SavedFilterAlert, 0)
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			logError("Failed to scan alert data", err)
+			return nil, err
+		}
+		alerts = append(alerts, *alert)
+	}
+
+	if err = rows.Err(); err != nil {
+		logError("Error iterating alerts", err)
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// CreateAlert records a pending alert for a part matching a saved filter. It reports false when
+// the part was already alerted for the filter.
+func (c *SQLClient) CreateAlert(savedFilterID, partID int) (bool, error) {
+	result, err := c.db.Exec("INSERT OR IGNORE INTO alerts (saved_filter_id, part_id, status) VALUES (?, ?, ?)",
+		savedFilterID, partID, AlertPending)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to create alert for part %d and saved filter %d", partID, savedFilterID), err)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// GetPendingAlerts retrieves the alerts waiting to be sent, grouped by saved filter
+func (c *SQLClient) GetPendingAlerts() ([]SavedFilterAlert, error) {
+	return c.queryAlerts("SELECT "+alertColumns+" FROM alerts WHERE status = ? ORDER BY saved_filter_id, id", AlertPending)
+}
+
+// GetAlerts retrieves the alerts of a saved filter, newest first
+func (c *SQLClient) GetAlerts(savedFilterID, limit, offset int) ([]SavedFilterAlert, error) {
+	return c.queryAlerts("SELECT "+alertColumns+" FROM alerts WHERE saved_filter_id = ? ORDER BY id DESC LIMIT ? OFFSET ?",
+		savedFilterID, limit, offset)
+}
+
+// GetAlertsCount counts the alerts of a saved filter
+func (c *SQLClient) GetAlertsCount(savedFilterID int) (int, error) {
+	var count int
+	if err := c.db.QueryRow("SELECT COUNT(*) FROM alerts WHERE saved_filter_id = ?", savedFilterID).Scan(&count); err != nil {
+		logError(fmt.Sprintf("Failed to count alerts for saved filter %d", savedFilterID), err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// alertIDsIn returns the placeholders and parameters for an IN clause over alert IDs
+func alertIDsIn(ids []int) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	params := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		params[i] = id
+	}
+	return "(" + strings.Join(placeholders, ",") + ")", params
+}
+
+// MarkAlertsSent records that the given alerts were delivered
+func (c *SQLClient) MarkAlertsSent(ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	in, params := alertIDsIn(ids)
+	params = append([]interface{}{AlertSent}, params...)
+	_, err := c.db.Exec(`
+		UPDATE alerts SET status = ?, attempts = attempts + 1, last_error = '', sent_at = CURRENT_TIMESTAMP
+		WHERE id IN `+in, params...)
+	if err != nil {
+		logError("Failed to mark alerts as sent", err)
+	}
+	return err
+}
+
+// MarkAlertsFailed records a failed delivery of the given alerts. They stay pending for another
+// attempt until maxAttempts is reached.
+func (c *SQLClient) MarkAlertsFailed(ids []int, deliveryErr string, maxAttempts int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	in, params := alertIDsIn(ids)
+	params = append([]interface{}{maxAttempts, AlertFailed, AlertPending, deliveryErr}, params...)
+	_, err := c.db.Exec(`
+		UPDATE alerts
+		SET status = CASE WHEN attempts + 1 >= ? THEN ? ELSE ? END, attempts = attempts + 1, last_error = ?
+		WHERE id IN `+in, params...)
+	if err != nil {
+		logError("Failed to mark alerts as failed", err)
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	. "dsmpartsfinder-api/models"
+)
+
+func TestCreateAlertDedupe(t *testing.T) {
+	sqlClient := newTestSQLClient(t)
+
+	savedFilter, err := sqlClient.CreateSavedFilter(SavedFilterRequest{
+		Name:     "Turbos",
+		Filter:   PartFilter{Search: "turbo"},
+		Notifier: "webhook",
+		Target:   "http://localhost/hook",
+	})
+	if err != nil {
+		t.Fatalf("CreateSavedFilter: %v", err)
+	}
+	other, err := sqlClient.CreateSavedFilter(SavedFilterRequest{
+		Name:     "Everything",
+		Notifier: "webhook",
+		Target:   "http://localhost/hook",
+	})
+	if err != nil {
+		t.Fatalf("CreateSavedFilter: %v", err)
+	}
+
+	steps := []struct {
+		filterID int
+		partID   int
+		created  bool
+	}{
+		{savedFilter.ID, 1, true},
+		{savedFilter.ID, 1, false}, // Same part again
+		{savedFilter.ID, 2, true},
+		{other.ID, 1, true}, // Same part for another filter
+		{other.ID, 1, false},
+	}
+	for _, step := range steps {
+		created, err := sqlClient.CreateAlert(step.filterID, step.partID)
+		if err != nil {
+			t.Fatalf("CreateAlert(%d, %d): %v", step.filterID, step.partID, err)
+		}
+		if created != step.created {
+			t.Errorf("CreateAlert(%d, %d) = %v, want %v", step.filterID, step.partID, created, step.created)
+		}
+	}
+
+	for filterID, want := range map[int]int{savedFilter.ID: 2, other.ID: 1} {
+		count, err := sqlClient.GetAlertsCount(filterID)
+		if err != nil {
+			t.Fatalf("GetAlertsCount(%d): %v", filterID, err)
+		}
+		if count != want {
+			t.Errorf("GetAlertsCount(%d) = %d, want %d", filterID, count, want)
+		}
+	}
+
+	pending, err := sqlClient.GetPendingAlerts()
+	if err != nil {
+		t.Fatalf("GetPendingAlerts: %v", err)
+	}
+	if len(pending) != 3 {
+		t.Errorf("GetPendingAlerts returned %d alerts, want 3", len(pending))
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	. "dsmpartsfinder-api/models"
+)
+
+const searchProfileColumns = `id, name, vehicle_type, make, base_model, model, year_from, year_to,
+	keywords, min_price, max_price, site_ids, enabled, created_at, updated_at`
+
+// scanSearchProfile scans a single search profile row
+func scanSearchProfile(scanner rowScanner) (*SearchProfile, error) {
+	var profile SearchProfile
+	var siteIDs string
+	err := scanner.Scan(
+		&profile.ID, &profile.Name, &profile.VehicleType, &profile.Make, &profile.BaseModel, &profile.Model,
+		&profile.YearFrom, &profile.YearTo, &profile.Keywords, &profile.MinPrice, &profile.MaxPrice,
+		&siteIDs, &profile.Enabled, &profile.CreatedAt, &profile.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	profile.SiteIDs = make([]int, 0)
+	if siteIDs != "" {
+		if err := json.Unmarshal([]byte(siteIDs), &profile.SiteIDs); err != nil {
+			return nil, fmt.Errorf("invalid site_ids for search profile %d: %w", profile.ID, err)
+		}
+	}
+	return &profile, nil
+}
+
+// GetSearchProfiles retrieves all search profiles, optionally only the enabled ones
+func (c *SQLClient) GetSearchProfiles(enabledOnly bool) ([]SearchProfile, error) {
+	query := "SELECT " + searchProfileColumns + " FROM search_profiles"
+	if enabledOnly {
+		query += " WHERE enabled = 1"
+	}
+	query += " ORDER BY id"
+
+	rows, err := c.db.Query(query)
+	if err != nil {
+		logError("Failed to query search profiles", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := make([]SearchProfile, 0)
+	for rows.Next() {
+		profile, err := scanSearchProfile(rows)
+		if err != nil {
+			logError("Failed to scan search profile data", err)
+			return nil, err
+		}
+		profiles = append(profiles, *profile)
+	}
+
+	if err = rows.Err(); err != nil {
+		logError("Error iterating search profiles", err)
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// GetSearchProfileByID retrieves a single search profile by its ID
+func (c *SQLClient) GetSearchProfileByID(id int) (*SearchProfile, error) {
+	row := c.db.QueryRow("SELECT "+searchProfileColumns+" FROM search_profiles WHERE id = ?", id)
+	profile, err := scanSearchProfile(row)
+	if err == sql.ErrNoRows {
+		return nil, sql.ErrNoRows
+	} else if err != nil {
+		logError(fmt.Sprintf("Failed to query search profile with ID %d", id), err)
+		return nil, err
+	}
+	return profile, nil
+}
+
+// CreateSearchProfile creates a new search profile in the database
+func (c *SQLClient) CreateSearchProfile(req SearchProfileRequest) (*SearchProfile, error) {
+	siteIDs, enabled := searchProfileRequestValues(&req)
+
+	result, err := c.db.Exec(`
+		INSERT INTO search_profiles (name, vehicle_type, make, base_model, model, year_from, year_to, keywords, min_price, max_price, site_ids, enabled)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, req.Name, req.VehicleType, req.Make, req.BaseModel, req.Model, req.YearFrom, req.YearTo,
+		req.Keywords, req.MinPrice, req.MaxPrice, siteIDs, enabled)
+	if err != nil {
+		logError("Failed to create search profile", err)
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		logError("Failed to get last insert ID for search profile", err)
+		return nil, err
+	}
+
+	logSuccess(fmt.Sprintf("Created search profile with ID %d", id))
+	return c.GetSearchProfileByID(int(id))
+}
+
+// UpdateSearchProfile updates an existing search profile in the database
+func (c *SQLClient) UpdateSearchProfile(id int, req SearchProfileRequest) (*SearchProfile, error) {
+	siteIDs, enabled := searchProfileRequestValues(&req)
+
+	result, err := c.db.Exec(`
+		UPDATE search_profiles
+		SET name = ?, vehicle_type = ?, make = ?, base_model = ?, model = ?, year_from = ?, year_to = ?,
+			keywords = ?, min_price = ?, max_price = ?, site_ids = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, req.Name, req.VehicleType, req.Make, req.BaseModel, req.Model, req.YearFrom, req.YearTo,
+		req.Keywords, req.MinPrice, req.MaxPrice, siteIDs, enabled, id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to update search profile with ID %d", id), err)
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logError("Failed to get rows affected", err)
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	logSuccess(fmt.Sprintf("Updated search profile with ID %d", id))
+	return c.GetSearchProfileByID(id)
+}
+
+// DeleteSearchProfile deletes a search profile and its part matches
+func (c *SQLClient) DeleteSearchProfile(id int) error {
+	if _, err := c.db.Exec("DELETE FROM part_search_profiles WHERE profile_id = ?", id); err != nil {
+		logError(fmt.Sprintf("Failed to delete part matches for search profile %d", id), err)
+		return err
+	}
+
+	result, err := c.db.Exec("DELETE FROM search_profiles WHERE id = ?", id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to delete search profile with ID %d", id), err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logError("Failed to get rows affected", err)
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	logSuccess(fmt.Sprintf("Deleted search profile with ID %d", id))
+	return nil
+}
+
+// searchProfileRequestValues converts the request fields that need encoding for storage
+// and fills in the default vehicle type
+func searchProfileRequestValues(req *SearchProfileRequest) (string, bool) {
+	if req.VehicleType == "" {
+		req.VehicleType = "P"
+	}
+
+	siteIDs := req.SiteIDs
+	if siteIDs == nil {
+		siteIDs = []int{}
+	}
+	encoded, _ := json.Marshal(siteIDs)
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	return string(encoded), enabled
+}
+
+// AddPartProfileMatches records that the given parts of a site were found by a search profile
+func (c *SQLClient) AddPartProfileMatches(partIDs []string, siteID, profileID int) error {
+	if len(partIDs) == 0 || profileID == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(partIDs))
+	args := make([]interface{}, len(partIDs)+2)
+	args[0] = profileID
+	args[1] = siteID
+
+	for i, partID := range partIDs {
+		placeholders[i] = "?"
+		args[i+2] = partID
+	}
+
+	query := fmt.Sprintf(`
+		INSERT OR IGNORE INTO part_search_profiles (part_id, profile_id)
+		SELECT id, ? FROM parts
+		WHERE site_id = ? AND part_id IN (%s)
+	`, strings.Join(placeholders, ","))
+
+	if _, err := c.db.Exec(query, args...); err != nil {
+		logError(fmt.Sprintf("Failed to record matches for search profile %d", profileID), err)
+		return err
+	}
+	return nil
+}
+
+// GetPartProfileIDs returns the IDs of the search profiles that matched a part
+func (c *SQLClient) GetPartProfileIDs(partID int) ([]int, error) {
+	rows, err := c.db.Query("SELECT profile_id FROM part_search_profiles WHERE part_id = ? ORDER BY profile_id", partID)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to query search profiles for part %d", partID), err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	profileIDs := make([]int, 0)
+	for rows.Next() {
+		var profileID int
+		if err := rows.Scan(&profileID); err != nil {
+			logError("Failed to scan search profile ID", err)
+			return nil, err
+		}
+		profileIDs = append(profileIDs, profileID)
+	}
+	return profileIDs, rows.Err()
+}
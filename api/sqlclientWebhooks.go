@@ -0,0 +1,359 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	. "dsmpartsfinder-api/models"
+)
+
+const webhookColumns = "id, name, url, secret, events, filter, enabled, created_at, updated_at"
+
+// scanWebhook scans a single webhook row
+func scanWebhook(scanner rowScanner) (*WebhookSubscription, error) {
+	var webhook WebhookSubscription
+	var events, filter string
+	err := scanner.Scan(&webhook.ID, &webhook.Name, &webhook.URL, &webhook.Secret, &events, &filter,
+		&webhook.Enabled, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.Events = make([]string, 0)
+	if events != "" {
+		if err := json.Unmarshal([]byte(events), &webhook.Events); err != nil {
+			return nil, fmt.Errorf("invalid events for webhook %d: %w", webhook.ID, err)
+		}
+	}
+	if filter != "" {
+		if err := json.Unmarshal([]byte(filter), &webhook.Filter); err != nil {
+			return nil, fmt.Errorf("invalid filter for webhook %d: %w", webhook.ID, err)
+		}
+	}
+	return &webhook, nil
+}
+
+// GetWebhooks retrieves all webhooks, optionally only the enabled ones
+func (c *SQLClient) GetWebhooks(enabledOnly bool) ([]WebhookSubscription, error) {
+	query := "SELECT " + webhookColumns + " FROM webhooks"
+	if enabledOnly {
+		query += " WHERE enabled = 1"
+	}
+	query += " ORDER BY id"
+
+	rows, err := c.db.Query(query)
+	if err != nil {
+		logError("Failed to query webhooks", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := make([]WebhookSubscription, 0)
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			logError("Failed to scan webhook data", err)
+			return nil, err
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		logError("Error iterating webhooks", err)
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhookByID retrieves a single webhook by its ID
+func (c *SQLClient) GetWebhookByID(id int) (*WebhookSubscription, error) {
+	row := c.db.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", id)
+	webhook, err := scanWebhook(row)
+	if err == sql.ErrNoRows {
+		return nil, sql.ErrNoRows
+	} else if err != nil {
+		logError(fmt.Sprintf("Failed to query webhook with ID %d", id), err)
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// CreateWebhook creates a new webhook in the database, generating a secret when the request
+// has none
+func (c *SQLClient) CreateWebhook(req WebhookSubscriptionRequest) (*WebhookSubscription, error) {
+	events, filter, enabled := webhookRequestValues(&req)
+
+	if req.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+		}
+		req.Secret = hex.EncodeToString(secret)
+	}
+
+	result, err := c.db.Exec(`
+		INSERT INTO webhooks (name, url, secret, events, filter, enabled)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, req.Name, req.URL, req.Secret, events, filter, enabled)
+	if err != nil {
+		logError("Failed to create webhook", err)
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		logError("Failed to get last insert ID for webhook", err)
+		return nil, err
+	}
+
+	logSuccess(fmt.Sprintf("Created webhook with ID %d", id))
+	return c.GetWebhookByID(int(id))
+}
+
+// UpdateWebhook updates an existing webhook in the database. An empty secret keeps the current one.
+func (c *SQLClient) UpdateWebhook(id int, req WebhookSubscriptionRequest) (*WebhookSubscription, error) {
+	events, filter, enabled := webhookRequestValues(&req)
+
+	result, err := c.db.Exec(`
+		UPDATE webhooks
+		SET name = ?, url = ?, secret = COALESCE(NULLIF(?, ''), secret), events = ?, filter = ?, enabled = ?,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, req.Name, req.URL, req.Secret, events, filter, enabled, id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to update webhook with ID %d", id), err)
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logError("Failed to get rows affected", err)
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	logSuccess(fmt.Sprintf("Updated webhook with ID %d", id))
+	return c.GetWebhookByID(id)
+}
+
+// DeleteWebhook deletes a webhook and its delivery log
+func (c *SQLClient) DeleteWebhook(id int) error {
+	if _, err := c.db.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", id); err != nil {
+		logError(fmt.Sprintf("Failed to delete deliveries of webhook %d", id), err)
+		return err
+	}
+
+	result, err := c.db.Exec("DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to delete webhook with ID %d", id), err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logError("Failed to get rows affected", err)
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	logSuccess(fmt.Sprintf("Deleted webhook with ID %d", id))
+	return nil
+}
+
+// webhookRequestValues encodes the request fields that need encoding for storage
+func webhookRequestValues(req *WebhookSubscriptionRequest) (string, string, bool) {
+	// The sort order has no meaning for deliveries
+	req.Filter.SortBy = ""
+	req.Filter.SortDesc = false
+
+	events := req.Events
+	if events == nil {
+		events = []string{}
+	}
+	encodedEvents, _ := json.Marshal(events)
+	encodedFilter, _ := json.Marshal(req.Filter)
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	return string(encodedEvents), string(encodedFilter), enabled
+}
+
+const webhookDeliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts, response_status,
+	last_error, next_attempt_at, created_at, delivered_at`
+
+// scanWebhookDelivery scans a single webhook delivery row
+func scanWebhookDelivery(scanner rowScanner) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var payload string
+	var nextAttemptAt, deliveredAt interface{}
+	err := scanner.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &payload,
+		&delivery.Status, &delivery.Attempts, &delivery.ResponseStatus, &delivery.LastError, &nextAttemptAt,
+		&delivery.CreatedAt, &deliveredAt)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.Payload = json.RawMessage(payload)
+	delivery.NextAttemptAt = parseDBTime(nextAttemptAt)
+	delivery.DeliveredAt = parseDBTime(deliveredAt)
+	return &delivery, nil
+}
+
+// queryWebhookDeliveries runs a query selecting webhookDeliveryColumns and scans the deliveries
+func (c *SQLClient) queryWebhookDeliveries(query string, args ...interface{}) ([]WebhookDelivery, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		logError("Failed to query webhook deliveries", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]WebhookDelivery, 0)
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			logError("Failed to scan webhook delivery data", err)
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		logError("Error iterating webhook deliveries", err)
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// CreateWebhookDelivery queues the delivery of an event to a webhook. It reports false when the
+// event was already queued for the webhook, e.g. when the event bus delivered it again.
+func (c *SQLClient) CreateWebhookDelivery(webhookID int, event Event, eventType string) (bool, error) {
+	result, err := c.db.Exec(`
+		INSERT OR IGNORE INTO webhook_deliveries (webhook_id, event_id, event_type, payload, status)
+		VALUES (?, ?, ?, ?, ?)
+	`, webhookID, event.ID, eventType, string(event.Payload), WebhookDeliveryPending)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to queue event %d for webhook %d", event.ID, webhookID), err)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// GetDueWebhookDeliveries retrieves up to limit pending deliveries whose next attempt is due,
+// oldest first
+func (c *SQLClient) GetDueWebhookDeliveries(now time.Time, limit int) ([]WebhookDelivery, error) {
+	return c.queryWebhookDeliveries(`
+		SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, id
+		LIMIT ?
+	`, WebhookDeliveryPending, dbTime(now), limit)
+}
+
+// GetWebhookDeliveries retrieves the delivery log of a webhook, newest first, optionally only
+// the deliveries with a status
+func (c *SQLClient) GetWebhookDeliveries(webhookID int, status string, limit, offset int) ([]WebhookDelivery, error) {
+	query := "SELECT " + webhookDeliveryColumns + " FROM webhook_deliveries WHERE webhook_id = ?"
+	params := []interface{}{webhookID}
+	if status != "" {
+		query += " AND status = ?"
+		params = append(params, status)
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	params = append(params, limit, offset)
+	return c.queryWebhookDeliveries(query, params...)
+}
+
+// GetWebhookDeliveriesCount counts the deliveries of a webhook, optionally only the ones with a status
+func (c *SQLClient) GetWebhookDeliveriesCount(webhookID int, status string) (int, error) {
+	query := "SELECT COUNT(*) FROM webhook_deliveries WHERE webhook_id = ?"
+	params := []interface{}{webhookID}
+	if status != "" {
+		query += " AND status = ?"
+		params = append(params, status)
+	}
+
+	var count int
+	if err := c.db.QueryRow(query, params...).Scan(&count); err != nil {
+		logError(fmt.Sprintf("Failed to count deliveries of webhook %d", webhookID), err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// MarkWebhookDeliverySucceeded records a successful attempt of a delivery
+func (c *SQLClient) MarkWebhookDeliverySucceeded(id, responseStatus int) error {
+	_, err := c.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = attempts + 1, response_status = ?, last_error = '', next_attempt_at = NULL,
+			delivered_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, WebhookDeliverySucceeded, responseStatus, id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to mark webhook delivery %d as succeeded", id), err)
+	}
+	return err
+}
+
+// MarkWebhookDeliveryFailed records a failed attempt of a delivery. It is retried at
+// nextAttemptAt, or failed for good when that is nil.
+func (c *SQLClient) MarkWebhookDeliveryFailed(id, responseStatus int, deliveryErr string, nextAttemptAt *time.Time) error {
+	status := WebhookDeliveryFailed
+	var next interface{}
+	if nextAttemptAt != nil {
+		status = WebhookDeliveryPending
+		next = dbTime(*nextAttemptAt)
+	}
+
+	_, err := c.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = attempts + 1, response_status = ?, last_error = ?, next_attempt_at = ?
+		WHERE id = ?
+	`, status, responseStatus, deliveryErr, next, id)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to mark webhook delivery %d as failed", id), err)
+	}
+	return err
+}
+
+// RedeliverWebhookDelivery queues a delivery of a webhook again with a fresh set of attempts
+func (c *SQLClient) RedeliverWebhookDelivery(webhookID, id int) (*WebhookDelivery, error) {
+	result, err := c.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND webhook_id = ?
+	`, WebhookDeliveryPending, id, webhookID)
+	if err != nil {
+		logError(fmt.Sprintf("Failed to requeue webhook delivery %d", id), err)
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	row := c.db.QueryRow("SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE id = ?", id)
+	return scanWebhookDelivery(row)
+}
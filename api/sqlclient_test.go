@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dsmpartsfinder-api/images"
+	. "dsmpartsfinder-api/models"
+	"dsmpartsfinder-api/prices"
+
+	"github.com/pressly/goose/v3"
+)
+
+// newTestSQLClient opens a migrated database in a temporary directory
+func newTestSQLClient(t *testing.T) *SQLClient {
+	t.Helper()
+	dir := t.TempDir()
+
+	sqlClient, err := NewSQLClient(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLClient: %v", err)
+	}
+	t.Cleanup(func() { sqlClient.Close() })
+
+	imageStore, err := images.NewStore(filepath.Join(dir, "images"))
+	if err != nil {
+		t.Fatalf("images.NewStore: %v", err)
+	}
+	subFS, err := fs.Sub(migrationsFS, "migrations")
+	if err != nil {
+		t.Fatalf("fs.Sub: %v", err)
+	}
+	provider, err := goose.NewProvider(goose.DialectSQLite3, sqlClient.db, subFS, goose.WithGoMigrations(goMigrations(imageStore)...))
+	if err != nil {
+		t.Fatalf("goose.NewProvider: %v", err)
+	}
+	if _, err := provider.Up(context.Background()); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	return sqlClient
+}
+
+func TestUpdatePartRecordsChangesAndEvents(t *testing.T) {
+	sqlClient := newTestSQLClient(t)
+
+	oldPrice := prices.Parse("100 €", "EUR")
+	created, err := sqlClient.CreatePart("p1", "Used turbo", "Turbo", "TD05H", nil, "https://example.com/p1", 1, "100 €", oldPrice, time.Now())
+	if err != nil {
+		t.Fatalf("CreatePart: %v", err)
+	}
+	stored, err := sqlClient.GetPartByID(created.ID)
+	if err != nil {
+		t.Fatalf("GetPartByID: %v", err)
+	}
+
+	newPrice := prices.Parse("80 €", "EUR")
+	changes := []PartChange{
+		{Field: "description", OldValue: "Used turbo", NewValue: "Used turbo, rebuilt"},
+		{Field: "price", OldValue: "100 €", NewValue: "80 €"},
+	}
+	updated, err := sqlClient.UpdatePart(stored, "p1", "Used turbo, rebuilt", "Turbo", "TD05H", nil, "https://example.com/p1", 1, "80 €", newPrice, changes, true)
+	if err != nil {
+		t.Fatalf("UpdatePart: %v", err)
+	}
+	if updated.Description != "Used turbo, rebuilt" || updated.ContentHash == stored.ContentHash {
+		t.Errorf("part was not updated: %+v", updated)
+	}
+
+	recorded, err := sqlClient.GetPartChanges(created.ID)
+	if err != nil {
+		t.Fatalf("GetPartChanges: %v", err)
+	}
+	if len(recorded) != 2 {
+		t.Errorf("recorded %d changes, want 2", len(recorded))
+	}
+
+	history, err := sqlClient.GetPriceHistory(created.ID)
+	if err != nil {
+		t.Fatalf("GetPriceHistory: %v", err)
+	}
+	if len(history) != 2 || history[1].Price != "80 €" {
+		t.Errorf("price history = %+v, want the initial and the new price", history)
+	}
+
+	events, err := sqlClient.GetEventsAfter(0, 10)
+	if err != nil {
+		t.Fatalf("GetEventsAfter: %v", err)
+	}
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	want := []string{EventPartCreated, EventPartUpdated, EventPriceChanged}
+	if len(types) != len(want) {
+		t.Fatalf("events = %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Errorf("events = %v, want %v", types, want)
+			break
+		}
+	}
+
+	var priceChange PriceChangedEvent
+	if err := events[2].Decode(&priceChange); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if priceChange.OldPrice != "100 €" || priceChange.NewPrice != "80 €" || !priceChange.Dropped() {
+		t.Errorf("price change = %+v, want a drop from 100 € to 80 €", priceChange)
+	}
+}
+
+func TestUpdatePartRollsBackMissingPart(t *testing.T) {
+	sqlClient := newTestSQLClient(t)
+
+	missing := &Part{ID: 42}
+	if _, err := sqlClient.UpdatePart(missing, "p42", "", "", "Gone", nil, "", 1, "5 €", prices.Parse("5 €", "EUR"),
+		[]PartChange{{Field: "name", OldValue: "", NewValue: "Gone"}}, true); err == nil {
+		t.Fatal("UpdatePart of a missing part returned no error")
+	}
+
+	events, err := sqlClient.GetEventsAfter(0, 10)
+	if err != nil {
+		t.Fatalf("GetEventsAfter: %v", err)
+	}
+	changes, err := sqlClient.GetPartChanges(42)
+	if err != nil {
+		t.Fatalf("GetPartChanges: %v", err)
+	}
+	if len(events) != 0 || len(changes) != 0 {
+		t.Errorf("failed update left %d events and %d changes behind", len(events), len(changes))
+	}
+}
+
+func TestEnqueueFetchJobCoalescesPerProfile(t *testing.T) {
+	sqlClient := newTestSQLClient(t)
+
+	params := map[string]string{"keywords": "turbo"}
+	tests := []struct {
+		name          string
+		profileID     int
+		wantCoalesced bool
+	}{
+		{"first job without profile", 0, false},
+		{"same job without profile", 0, true},
+		{"profile 1", 1, false},
+		{"profile 1 again", 1, true},
+		{"profile 2", 2, false},
+	}
+	for _, tt := range tests {
+		_, coalesced, err := sqlClient.EnqueueFetchJob(1, tt.profileID, "manual", params, 3)
+		if err != nil {
+			t.Fatalf("%s: EnqueueFetchJob: %v", tt.name, err)
+		}
+		if coalesced != tt.wantCoalesced {
+			t.Errorf("%s: coalesced = %v, want %v", tt.name, coalesced, tt.wantCoalesced)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	. "dsmpartsfinder-api/models"
+	"dsmpartsfinder-api/notify"
+)
+
+const (
+	// webhookPollInterval is how often due deliveries are looked for when nothing woke the
+	// service, e.g. for retries
+	webhookPollInterval = 5 * time.Second
+	// webhookBatchSize is how many due deliveries are sent per round
+	webhookBatchSize = 50
+	// webhookTimeout bounds a single attempt
+	webhookTimeout = 15 * time.Second
+	// maxWebhookAttempts is how often a delivery is tried before it is failed
+	maxWebhookAttempts = 8
+	// webhookRetryBaseDelay is the delay before the first retry, doubled for every further attempt
+	webhookRetryBaseDelay = 30 * time.Second
+	webhookRetryMaxDelay  = 6 * time.Hour
+)
+
+// WebhookService posts the domain events to the webhook subscriptions that asked for them. Every
+// event is queued once per subscription in the webhook_deliveries table, which doubles as the
+// delivery log, and failed attempts are retried with exponential backoff.
+type WebhookService struct {
+	sqlClient *SQLClient
+	client    *http.Client
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewWebhookService creates a new webhook service. Subscribe HandleEvent to the event bus and
+// call Start.
+func NewWebhookService(sqlClient *SQLClient) *WebhookService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WebhookService{
+		sqlClient: sqlClient,
+		client:    &http.Client{Timeout: webhookTimeout},
+		wake:      make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+}
+
+// Start begins sending due deliveries, including the ones left over from before a restart
+func (s *WebhookService) Start() {
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(webhookPollInterval)
+		defer ticker.Stop()
+
+		for {
+			s.sendDue()
+
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-s.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Println("[WebhookService] Webhook service started")
+}
+
+// Stop stops sending deliveries. Pending deliveries are sent after the next start.
+func (s *WebhookService) Stop() {
+	log.Println("[WebhookService] Stopping webhook service...")
+	s.cancel()
+	<-s.done
+	log.Println("[WebhookService] Webhook service stopped")
+}
+
+// Wake makes the service look for due deliveries right away
+func (s *WebhookService) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// webhookEventType maps a domain event to the webhook event type it is delivered as, "" when
+// webhooks do not receive it
+func webhookEventType(event Event) (string, error) {
+	switch event.Type {
+	case EventPartCreated, EventPriceChanged, EventPartRemoved:
+		return event.Type, nil
+	case EventFetchRunFinished:
+		var finished FetchRunFinishedEvent
+		if err := event.Decode(&finished); err != nil {
+			return "", err
+		}
+		if finished.Run.Status == FetchRunFailed {
+			return WebhookEventFetchFailed, nil
+		}
+	}
+	return "", nil
+}
+
+// HandleEvent queues a delivery of the event for every enabled webhook subscription that asked
+// for it and whose part filter matches
+func (s *WebhookService) HandleEvent(event Event) error {
+	eventType, err := webhookEventType(event)
+	if err != nil || eventType == "" {
+		return err
+	}
+
+	webhooks, err := s.sqlClient.GetWebhooks(true)
+	if err != nil {
+		return err
+	}
+
+	queued := 0
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(eventType) {
+			continue
+		}
+		matches, err := s.matches(&webhook, event)
+		if err != nil {
+			return err
+		}
+		if !matches {
+			continue
+		}
+
+		ok, err := s.sqlClient.CreateWebhookDelivery(webhook.ID, event, eventType)
+		if err != nil {
+			return err
+		}
+		if ok {
+			queued++
+		}
+	}
+
+	if queued > 0 {
+		s.Wake()
+	}
+	return nil
+}
+
+// matches reports whether an event passes the part filter of a webhook subscription. Part events
+// are matched against the part regardless of its status, so removals can be filtered too; other
+// events only against the sites of the filter.
+func (s *WebhookService) matches(webhook *WebhookSubscription, event Event) (bool, error) {
+	if event.PartID == 0 {
+		if len(webhook.Filter.SiteIDs) == 0 {
+			return true, nil
+		}
+		for _, siteID := range webhook.Filter.SiteIDs {
+			if siteID == event.SiteID {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	filter := webhook.Filter
+	filter.Status = "all"
+	return s.sqlClient.PartMatchesFilter(event.PartID, filter)
+}
+
+// sendDue sends the deliveries whose next attempt is due. After a failed attempt, the other
+// deliveries of the same webhook wait for the next round so one dead receiver cannot hold up
+// the rest.
+func (s *WebhookService) sendDue() {
+	deliveries, err := s.sqlClient.GetDueWebhookDeliveries(time.Now(), webhookBatchSize)
+	if err != nil {
+		log.Printf("[WebhookService] WARNING: Failed to load due deliveries: %v", err)
+		return
+	}
+
+	webhooks := make(map[int]*WebhookSubscription)
+	failing := make(map[int]bool)
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		if s.ctx.Err() != nil {
+			return
+		}
+		if failing[delivery.WebhookID] {
+			continue
+		}
+
+		webhook, loaded := webhooks[delivery.WebhookID]
+		if !loaded {
+			webhook, err = s.sqlClient.GetWebhookByID(delivery.WebhookID)
+			if err != nil {
+				log.Printf("[WebhookService] WARNING: Failed to load webhook %d: %v", delivery.WebhookID, err)
+				continue
+			}
+			webhooks[delivery.WebhookID] = webhook
+		}
+
+		if !webhook.Enabled {
+			s.sqlClient.MarkWebhookDeliveryFailed(delivery.ID, 0, "webhook is disabled", nil)
+			continue
+		}
+		if !s.send(webhook, delivery) {
+			failing[delivery.WebhookID] = true
+		}
+	}
+}
+
+// send makes one attempt of a delivery and records its outcome, reporting whether it succeeded
+func (s *WebhookService) send(webhook *WebhookSubscription, delivery *WebhookDelivery) bool {
+	body, err := json.Marshal(WebhookPayload{
+		DeliveryID: delivery.ID,
+		EventID:    delivery.EventID,
+		Type:       delivery.EventType,
+		CreatedAt:  delivery.CreatedAt,
+		Data:       delivery.Payload,
+	})
+	if err != nil {
+		s.sqlClient.MarkWebhookDeliveryFailed(delivery.ID, 0, err.Error(), nil)
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, webhookTimeout)
+	defer cancel()
+	status, err := notify.PostSigned(ctx, s.client, notify.SignedDelivery{
+		URL:        webhook.URL,
+		Secret:     webhook.Secret,
+		EventType:  delivery.EventType,
+		DeliveryID: delivery.ID,
+		Body:       body,
+	})
+	if err == nil {
+		s.sqlClient.MarkWebhookDeliverySucceeded(delivery.ID, status)
+		return true
+	}
+
+	attempts := delivery.Attempts + 1
+	if attempts >= maxWebhookAttempts {
+		log.Printf("[WebhookService] Giving up on delivery %d of event %d to webhook %d after %d attempts: %v", delivery.ID, delivery.EventID, webhook.ID, attempts, err)
+		s.sqlClient.MarkWebhookDeliveryFailed(delivery.ID, status, err.Error(), nil)
+		return false
+	}
+
+	delay := webhookRetryDelay(attempts)
+	log.Printf("[WebhookService] Delivery %d of event %d to webhook %d failed (attempt %d), retrying in %v: %v", delivery.ID, delivery.EventID, webhook.ID, attempts, delay, err)
+	next := time.Now().Add(delay)
+	s.sqlClient.MarkWebhookDeliveryFailed(delivery.ID, status, err.Error(), &next)
+	return false
+}
+
+// webhookRetryDelay returns the delay before the next attempt after the given number of attempts
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := webhookRetryBaseDelay
+	for i := 1; i < attempts && delay < webhookRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > webhookRetryMaxDelay {
+		delay = webhookRetryMaxDelay
+	}
+	return delay
+}